@@ -0,0 +1,243 @@
+package cache
+
+import "container/list"
+
+// EvictionPolicy 淘汰策略, 决定缓存满了之后淘汰哪个 key
+// BuildInMapCache 只会在持有写锁的时候调用, 所以实现不需要考虑并发安全
+// 所有方法都必须是 O(1) 的, 因为每次读写缓存都会调用
+type EvictionPolicy interface {
+	// KeyAccessed key 被读取或者被覆盖
+	KeyAccessed(key string)
+	// KeyAdded 新增了 key
+	KeyAdded(key string)
+	// KeyDeleted key 被删除或者过期了, 不认识的 key 直接忽略
+	KeyDeleted(key string)
+	// Evict 选出要淘汰的 key, 并且不再跟踪它, 没有 key 的时候返回 false
+	Evict() (string, bool)
+	// EvictExcept 和 Evict 一样, 但是不会选出 key, key 的访问记录也保持不变
+	// 覆盖 key 需要腾出空间的时候使用, 除了 key 没有别的 key 的时候返回 false
+	EvictExcept(key string) (string, bool)
+}
+
+// BuildInMapCacheWithEviction 设置容量和淘汰策略
+// key 的数量达到 capacity 之后, 新增 key 会先淘汰一个 key, 淘汰的 key 同样会调用 onEvicted
+func BuildInMapCacheWithEviction(capacity int, policy EvictionPolicy) BuildInMapCacheOption {
+	return func(cache *BuildInMapCache) {
+		cache.capacity = capacity
+		cache.policy = policy
+	}
+}
+
+var (
+	_ EvictionPolicy = &LRUPolicy{}
+	_ EvictionPolicy = &LFUPolicy{}
+	_ EvictionPolicy = &FIFOPolicy{}
+)
+
+// LRUPolicy 淘汰最久没有访问的 key
+// 链表头部是最近访问的 key, 淘汰尾部的 key
+type LRUPolicy struct {
+	keys  map[string]*list.Element
+	order *list.List
+}
+
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{
+		keys:  make(map[string]*list.Element, 16),
+		order: list.New(),
+	}
+}
+
+func (p *LRUPolicy) KeyAccessed(key string) {
+	if e, ok := p.keys[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *LRUPolicy) KeyAdded(key string) {
+	if e, ok := p.keys[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.keys[key] = p.order.PushFront(key)
+}
+
+func (p *LRUPolicy) KeyDeleted(key string) {
+	if e, ok := p.keys[key]; ok {
+		p.order.Remove(e)
+		delete(p.keys, key)
+	}
+}
+
+func (p *LRUPolicy) Evict() (string, bool) {
+	return evictElement(p.keys, p.order, p.order.Back())
+}
+
+func (p *LRUPolicy) EvictExcept(key string) (string, bool) {
+	e := p.order.Back()
+	if e != nil && e.Value.(string) == key {
+		e = e.Prev()
+	}
+	return evictElement(p.keys, p.order, e)
+}
+
+// evictElement 淘汰 order 里面的 e, e 为 nil 的时候返回 false, LRU 和 FIFO 共用
+func evictElement(keys map[string]*list.Element, order *list.List, e *list.Element) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+	key := order.Remove(e).(string)
+	delete(keys, key)
+	return key, true
+}
+
+// FIFOPolicy 淘汰最早加入的 key, 访问不影响淘汰的顺序
+type FIFOPolicy struct {
+	keys  map[string]*list.Element
+	order *list.List
+}
+
+func NewFIFOPolicy() *FIFOPolicy {
+	return &FIFOPolicy{
+		keys:  make(map[string]*list.Element, 16),
+		order: list.New(),
+	}
+}
+
+func (p *FIFOPolicy) KeyAccessed(key string) {}
+
+func (p *FIFOPolicy) KeyAdded(key string) {
+	if _, ok := p.keys[key]; ok {
+		return
+	}
+	p.keys[key] = p.order.PushBack(key)
+}
+
+func (p *FIFOPolicy) KeyDeleted(key string) {
+	if e, ok := p.keys[key]; ok {
+		p.order.Remove(e)
+		delete(p.keys, key)
+	}
+}
+
+func (p *FIFOPolicy) Evict() (string, bool) {
+	return evictElement(p.keys, p.order, p.order.Front())
+}
+
+func (p *FIFOPolicy) EvictExcept(key string) (string, bool) {
+	e := p.order.Front()
+	if e != nil && e.Value.(string) == key {
+		e = e.Next()
+	}
+	return evictElement(p.keys, p.order, e)
+}
+
+// LFUPolicy 淘汰访问次数最少的 key, 次数一样的时候淘汰最久没有访问的
+// 参考 http://dhruvbird.com/lfu.pdf, 按照访问次数从小到大排列桶,
+// 每个桶里面是访问次数相同的 key, 访问的时候把 key 移到下一个桶, 所以都是 O(1) 的
+type LFUPolicy struct {
+	// keys value 是 lfuEntry 在桶里面的元素
+	keys map[string]*list.Element
+	// buckets 按照访问次数从小到大排列的 *lfuBucket
+	buckets *list.List
+}
+
+type lfuBucket struct {
+	freq int
+	// entries 头部是最近访问的 *lfuEntry
+	entries *list.List
+}
+
+type lfuEntry struct {
+	key string
+	// bucket 所在的桶在 buckets 里面的元素
+	bucket *list.Element
+}
+
+func NewLFUPolicy() *LFUPolicy {
+	return &LFUPolicy{
+		keys:    make(map[string]*list.Element, 16),
+		buckets: list.New(),
+	}
+}
+
+func (p *LFUPolicy) KeyAccessed(key string) {
+	e, ok := p.keys[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*lfuEntry)
+	cur := entry.bucket
+	freq := cur.Value.(*lfuBucket).freq + 1
+	next := cur.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != freq {
+		next = p.buckets.InsertAfter(&lfuBucket{freq: freq, entries: list.New()}, cur)
+	}
+	p.remove(e)
+	entry.bucket = next
+	p.keys[key] = next.Value.(*lfuBucket).entries.PushFront(entry)
+}
+
+func (p *LFUPolicy) KeyAdded(key string) {
+	if _, ok := p.keys[key]; ok {
+		p.KeyAccessed(key)
+		return
+	}
+	first := p.buckets.Front()
+	if first == nil || first.Value.(*lfuBucket).freq != 1 {
+		first = p.buckets.PushFront(&lfuBucket{freq: 1, entries: list.New()})
+	}
+	p.keys[key] = first.Value.(*lfuBucket).entries.PushFront(&lfuEntry{key: key, bucket: first})
+}
+
+func (p *LFUPolicy) KeyDeleted(key string) {
+	if e, ok := p.keys[key]; ok {
+		p.remove(e)
+		delete(p.keys, key)
+	}
+}
+
+func (p *LFUPolicy) Evict() (string, bool) {
+	first := p.buckets.Front()
+	if first == nil {
+		return "", false
+	}
+	return p.evict(first.Value.(*lfuBucket).entries.Back())
+}
+
+// EvictExcept 访问次数最少的桶里面只有 key 的时候, 从下一个桶里面选
+func (p *LFUPolicy) EvictExcept(key string) (string, bool) {
+	first := p.buckets.Front()
+	if first == nil {
+		return "", false
+	}
+	e := first.Value.(*lfuBucket).entries.Back()
+	if e.Value.(*lfuEntry).key == key {
+		e = e.Prev()
+		if e == nil {
+			next := first.Next()
+			if next == nil {
+				return "", false
+			}
+			e = next.Value.(*lfuBucket).entries.Back()
+		}
+	}
+	return p.evict(e)
+}
+
+func (p *LFUPolicy) evict(e *list.Element) (string, bool) {
+	key := e.Value.(*lfuEntry).key
+	p.remove(e)
+	delete(p.keys, key)
+	return key, true
+}
+
+// remove 把 e 从桶里面移除, 桶空了就把桶也移除
+func (p *LFUPolicy) remove(e *list.Element) {
+	bucket := e.Value.(*lfuEntry).bucket
+	entries := bucket.Value.(*lfuBucket).entries
+	entries.Remove(e)
+	if entries.Len() == 0 {
+		p.buckets.Remove(bucket)
+	}
+}
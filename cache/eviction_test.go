@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"geektime-go-study/cache/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestEvictionPolicy(t *testing.T) {
+	// ops: +key 新增, key 访问, -key 删除
+	ops := []string{"+a", "+b", "+c", "a", "a", "b", "+d", "-c", "+b"}
+	testCases := []struct {
+		name   string
+		policy EvictionPolicy
+		want   []string
+	}{
+		{
+			// 从最近访问到最久没有访问: b, d, a
+			name:   "lru",
+			policy: NewLRUPolicy(),
+			want:   []string{"a", "d", "b"},
+		},
+		{
+			// 访问次数: d 1, b 3, a 3, a 比 b 更久没有访问
+			name:   "lfu",
+			policy: NewLFUPolicy(),
+			want:   []string{"d", "a", "b"},
+		},
+		{
+			name:   "fifo",
+			policy: NewFIFOPolicy(),
+			want:   []string{"a", "b", "d"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, op := range ops {
+				switch op[0] {
+				case '+':
+					tc.policy.KeyAdded(op[1:])
+				case '-':
+					tc.policy.KeyDeleted(op[1:])
+				default:
+					tc.policy.KeyAccessed(op)
+				}
+			}
+			// 不认识的 key 直接忽略
+			tc.policy.KeyAccessed("unknown")
+			tc.policy.KeyDeleted("unknown")
+
+			var evicted []string
+			for {
+				key, ok := tc.policy.Evict()
+				if !ok {
+					break
+				}
+				evicted = append(evicted, key)
+			}
+			assert.Equal(t, tc.want, evicted)
+		})
+	}
+}
+
+// TestEvictionPolicy_evictExcept 跳过的 key 保留原来的位置, 下一次 Evict 还是先淘汰它
+func TestEvictionPolicy_evictExcept(t *testing.T) {
+	ops := []string{"+a", "+b", "+c", "a", "a", "b", "+d", "-c", "+b"}
+	testCases := []struct {
+		name   string
+		policy EvictionPolicy
+		except string
+		want   []string
+	}{
+		{name: "lru", policy: NewLRUPolicy(), except: "a", want: []string{"d", "a", "b"}},
+		{name: "lfu", policy: NewLFUPolicy(), except: "d", want: []string{"a", "d", "b"}},
+		{name: "fifo", policy: NewFIFOPolicy(), except: "a", want: []string{"b", "a", "d"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, op := range ops {
+				switch op[0] {
+				case '+':
+					tc.policy.KeyAdded(op[1:])
+				case '-':
+					tc.policy.KeyDeleted(op[1:])
+				default:
+					tc.policy.KeyAccessed(op)
+				}
+			}
+			key, ok := tc.policy.EvictExcept(tc.except)
+			require.True(t, ok)
+			evicted := []string{key}
+			for {
+				key, ok = tc.policy.Evict()
+				if !ok {
+					break
+				}
+				evicted = append(evicted, key)
+			}
+			assert.Equal(t, tc.want, evicted)
+
+			// 只剩下 key 自己的时候没有可以淘汰的
+			tc.policy.KeyAdded("x")
+			_, ok = tc.policy.EvictExcept("x")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestBuildInMapCache_Eviction(t *testing.T) {
+	var evicted []string
+	c := NewBuildInMapCache(time.Minute,
+		BuildInMapCacheWithEvicted(func(key string, val any) {
+			evicted = append(evicted, key)
+		}),
+		BuildInMapCacheWithEviction(2, NewLRUPolicy()))
+	defer func() {
+		_ = c.Close()
+	}()
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "a", 1, 0))
+	require.NoError(t, c.Set(ctx, "b", 2, 0))
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	// 覆盖不会淘汰
+	require.NoError(t, c.Set(ctx, "a", 3, 0))
+	assert.Empty(t, evicted)
+
+	require.NoError(t, c.Set(ctx, "c", 4, 0))
+	assert.Equal(t, []string{"b"}, evicted)
+	_, err = c.Get(ctx, "b")
+	assert.Equal(t, internal.NewErrKeyNotFound("b"), err)
+
+	// 删除之后有空位, 不需要淘汰
+	require.NoError(t, c.Delete(ctx, "a"))
+	require.NoError(t, c.Set(ctx, "d", 5, 0))
+	assert.Equal(t, []string{"b", "a"}, evicted)
+	val, err := c.Get(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, 4, val)
+}
+
+func TestMaxCntCache_Eviction(t *testing.T) {
+	ctx := context.Background()
+	c := NewMaxCntCache(NewBuildInMapCache(time.Minute), 1)
+	require.NoError(t, c.Set(ctx, "a", 1, 0))
+	assert.Equal(t, ErrOverCapacity, c.Set(ctx, "b", 2, 0))
+
+	// 有淘汰策略的时候淘汰而不是拒绝
+	c = NewMaxCntCache(NewBuildInMapCache(time.Minute, BuildInMapCacheWithEviction(0, NewFIFOPolicy())), 1)
+	require.NoError(t, c.Set(ctx, "a", 1, 0))
+	require.NoError(t, c.Set(ctx, "b", 2, 0))
+	_, err := c.Get(ctx, "a")
+	assert.Equal(t, internal.NewErrKeyNotFound("a"), err)
+	assert.Equal(t, int32(1), c.cnt)
+}
+
+// 在 cache 目录下执行
+// go test -run=^$ -bench=BenchmarkEvictionPolicy -benchmem
+// 输出
+// cpu: Intel(R) Xeon(R) Processor
+// BenchmarkEvictionPolicy/lru/s=1.01     1295678     969.8 ns/op    0.5229 hit-ratio    103 B/op    3 allocs/op
+// BenchmarkEvictionPolicy/lfu/s=1.01     1000000      1065 ns/op    0.6078 hit-ratio    201 B/op    5 allocs/op
+// BenchmarkEvictionPolicy/fifo/s=1.01    1255303      1151 ns/op    0.4815 hit-ratio    111 B/op    3 allocs/op
+// BenchmarkEvictionPolicy/lru/s=1.2      1866578     582.5 ns/op    0.7952 hit-ratio     44 B/op    1 allocs/op
+// BenchmarkEvictionPolicy/lfu/s=1.2      1471627     727.5 ns/op    0.8395 hit-ratio    173 B/op    4 allocs/op
+// BenchmarkEvictionPolicy/fifo/s=1.2     2579560     499.3 ns/op    0.7626 hit-ratio     51 B/op    1 allocs/op
+// 访问越集中, 命中率越高, LFU 的命中率最高, 代价是每次访问都要在桶之间移动
+func BenchmarkEvictionPolicy(b *testing.B) {
+	policies := []struct {
+		name string
+		new  func() EvictionPolicy
+	}{
+		{name: "lru", new: func() EvictionPolicy { return NewLRUPolicy() }},
+		{name: "lfu", new: func() EvictionPolicy { return NewLFUPolicy() }},
+		{name: "fifo", new: func() EvictionPolicy { return NewFIFOPolicy() }},
+	}
+	for _, s := range []float64{1.01, 1.2} {
+		for _, p := range policies {
+			b.Run(fmt.Sprintf("%s/s=%v", p.name, s), func(b *testing.B) {
+				benchmarkZipf(b, func(capacity int) Cache {
+					return NewBuildInMapCache(time.Minute, BuildInMapCacheWithEviction(capacity, p.new()))
+				}, s)
+			})
+		}
+	}
+}
+
+// benchmarkZipf 容量是 key 总数的 1%, key 的访问频率服从 Zipf 分布
+func benchmarkZipf(b *testing.B, newCache func(capacity int) Cache, s float64) {
+	const keys = 100000
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), s, 1, keys-1)
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("key_%d", i)
+	}
+	benchmarkHitRatio(b, newCache(keys/100), func(i int) string {
+		return names[zipf.Uint64()]
+	})
+}
+
+// benchmarkHitRatio 第 i 次访问 next(i), 没有命中的时候写入缓存, 报告命中率
+func benchmarkHitRatio(b *testing.B, c Cache, next func(i int) string) {
+	defer func() {
+		_ = c.Close()
+	}()
+	ctx := context.Background()
+	hits := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := next(i)
+		if _, err := c.Get(ctx, key); err == nil {
+			hits++
+			continue
+		}
+		if err := c.Set(ctx, key, i, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(hits)/float64(b.N), "hit-ratio")
+}
@@ -25,9 +25,15 @@ type BuildInMapCache struct {
 	close      chan struct{}
 	maxLoopCnt int                       // 每次轮询过期key 最大次数
 	onEvicted  func(key string, val any) // 当删除key的时候 执行
+	// capacity 最多多少个 key, 0 代表不限制, 超过之后由 policy 选出淘汰的 key
+	capacity int
+	policy   EvictionPolicy
 }
 
 func (c *BuildInMapCache) Get(ctx context.Context, key string) (any, error) {
+	if c.policy != nil {
+		return c.getAndAccess(key)
+	}
 	c.mutex.RLock()
 	res, ok := c.data[key]
 	c.mutex.RUnlock()
@@ -52,6 +58,22 @@ func (c *BuildInMapCache) Get(ctx context.Context, key string) (any, error) {
 	return res.val, nil
 }
 
+// getAndAccess 淘汰策略要记录每一次访问, 所以读也要加写锁
+func (c *BuildInMapCache) getAndAccess(key string) (any, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	res, ok := c.data[key]
+	if !ok {
+		return nil, internal.NewErrKeyNotFound(key)
+	}
+	if res.IsExpired(time.Now()) {
+		c.delete(key)
+		return nil, internal.NewErrKeyNotFound(key)
+	}
+	c.policy.KeyAccessed(key)
+	return res.val, nil
+}
+
 func (b *BuildInMapCache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
@@ -63,6 +85,19 @@ func (b *BuildInMapCache) set(key string, val any, expiration time.Duration) err
 	if expiration > 0 {
 		dl = time.Now().Add(expiration)
 	}
+	if b.policy != nil {
+		if _, ok := b.data[key]; ok {
+			b.policy.KeyAccessed(key)
+		} else {
+			// 满了先淘汰, 而不是拒绝写入
+			for b.capacity > 0 && len(b.data) >= b.capacity {
+				if !b.evict() {
+					break
+				}
+			}
+			b.policy.KeyAdded(key)
+		}
+	}
 	b.data[key] = &item{
 		val:      val,
 		deadline: dl,
@@ -70,6 +105,26 @@ func (b *BuildInMapCache) set(key string, val any, expiration time.Duration) err
 	return nil
 }
 
+// evict 淘汰一个 key, 没有可以淘汰的 key 返回 false
+func (b *BuildInMapCache) evict() bool {
+	key, ok := b.policy.Evict()
+	if !ok {
+		return false
+	}
+	b.delete(key)
+	return true
+}
+
+// evictExcept 淘汰一个不是 except 的 key
+func (b *BuildInMapCache) evictExcept(except string) bool {
+	key, ok := b.policy.EvictExcept(except)
+	if !ok {
+		return false
+	}
+	b.delete(key)
+	return true
+}
+
 func (c *BuildInMapCache) Delete(ctx context.Context, key string) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -88,6 +143,9 @@ func (c *BuildInMapCache) delete(k string) {
 		return
 	}
 	delete(c.data, k)
+	if c.policy != nil {
+		c.policy.KeyDeleted(k)
+	}
 	c.onEvicted(k, itm.val)
 }
 
@@ -11,6 +11,8 @@ var (
 	ErrOverCapacity = errors.New("cache: 超过容量限制")
 )
 
+// MaxCntCache 限制 key 的数量
+// 满了之后, 如果 BuildInMapCache 设置了淘汰策略就淘汰一个 key, 否则返回 ErrOverCapacity
 type MaxCntCache struct {
 	*BuildInMapCache
 	cnt    int32
@@ -39,7 +41,7 @@ func (c *MaxCntCache) Set(ctx context.Context, key string, val any, expiration t
 	defer c.mutex.Unlock()
 	_, ok := c.data[key]
 	if !ok {
-		if c.cnt+1 > c.maxCnt {
+		if c.cnt+1 > c.maxCnt && (c.policy == nil || !c.evict()) {
 			return ErrOverCapacity
 		}
 		err := c.set(key, val, expiration)
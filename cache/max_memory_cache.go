@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// MaxMemoryCache 限制缓存占用的内存, 每个 key 占用的内存是 key 的长度加上 Sizer 估算的值的大小
+// 超过限制之后, 如果 BuildInMapCache 设置了淘汰策略就一直淘汰到不超过限制为止, 否则返回 ErrOverCapacity
+type MaxMemoryCache struct {
+	*BuildInMapCache
+	sizer     Sizer
+	maxMemory int64
+	used      int64
+	// sizes 写入的时候计算的大小, 删除的时候按照它扣减, 这样值在写入之后被修改也不会算错
+	sizes map[string]int64
+}
+
+type MaxMemoryCacheOption func(cache *MaxMemoryCache)
+
+// MaxMemoryCacheWithSizer 设置估算大小的方式, 默认是 ReflectSizer
+func MaxMemoryCacheWithSizer(sizer Sizer) MaxMemoryCacheOption {
+	return func(cache *MaxMemoryCache) {
+		cache.sizer = sizer
+	}
+}
+
+// NewMaxMemoryCache maxMemory 的单位是字节
+func NewMaxMemoryCache(b *BuildInMapCache, maxMemory int64, opts ...MaxMemoryCacheOption) *MaxMemoryCache {
+	res := &MaxMemoryCache{
+		BuildInMapCache: b,
+		sizer:           ReflectSizer,
+		maxMemory:       maxMemory,
+		sizes:           make(map[string]int64, 10),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	// 过期清理的 goroutine 已经在运行了, 它持有锁读取 onEvicted, 所以替换的时候也要持有锁
+	// 调用 onEvicted 的时候已经持有锁了
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	origin := b.onEvicted
+	b.onEvicted = func(key string, val any) {
+		res.used -= res.sizes[key]
+		delete(res.sizes, key)
+		if origin != nil {
+			origin(key, val)
+		}
+	}
+	return res
+}
+
+func (c *MaxMemoryCache) Set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	size := int64(len(key)) + c.sizer.Size(val)
+	if size > c.maxMemory {
+		return ErrOverCapacity
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// 覆盖的时候原来的值占用的内存会被释放, 但是不能淘汰 key 自己
+	for c.used-c.sizes[key]+size > c.maxMemory {
+		if c.policy == nil || !c.evictExcept(key) {
+			return ErrOverCapacity
+		}
+	}
+	err := c.set(key, val, expiration)
+	if err != nil {
+		return err
+	}
+	c.used += size - c.sizes[key]
+	c.sizes[key] = size
+	return nil
+}
+
+// Used 当前占用的内存, 单位是字节
+func (c *MaxMemoryCache) Used() int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.used
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"geektime-go-study/cache/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type sizerNode struct {
+	Name string
+	next *sizerNode
+}
+
+func TestSizer(t *testing.T) {
+	// 两个节点互相引用, 每个节点只计算一次
+	a, b := &sizerNode{Name: "aa"}, &sizerNode{Name: "bbb"}
+	a.next, b.next = b, a
+	nodeSize := int64(24)
+
+	testCases := []struct {
+		name  string
+		sizer Sizer
+		val   any
+		want  int64
+	}{
+		{name: "bytes", sizer: BytesSizer, val: make([]byte, 10, 32), want: 10},
+		{name: "string", sizer: StringSizer, val: "hello", want: 5},
+		{name: "bytes fallback", sizer: BytesSizer, val: "hello", want: 16 + 5},
+		{name: "nil", sizer: ReflectSizer, val: nil, want: 0},
+		{name: "int", sizer: ReflectSizer, val: 10, want: 8},
+		{name: "reflect bytes", sizer: ReflectSizer, val: make([]byte, 10, 32), want: 24 + 32},
+		{name: "strings", sizer: ReflectSizer, val: []string{"a", "bc"}, want: 24 + 2*16 + 3},
+		{name: "pointer cycle", sizer: ReflectSizer, val: a, want: 8 + 2*nodeSize + 5},
+		{name: "map", sizer: ReflectSizer, val: map[string]int{"ab": 1}, want: 8 + 16 + 2 + 8},
+		{
+			name:  "func",
+			sizer: SizerFunc(func(val any) int64 { return 100 }),
+			val:   "hello",
+			want:  100,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.sizer.Size(tc.val))
+		})
+	}
+}
+
+func TestMaxMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewMaxMemoryCache(NewBuildInMapCache(time.Minute,
+		BuildInMapCacheWithEvicted(func(key string, val any) {
+			evicted = append(evicted, key)
+		}),
+		BuildInMapCacheWithEviction(0, NewLRUPolicy())), 10, MaxMemoryCacheWithSizer(StringSizer))
+	defer func() {
+		_ = c.Close()
+	}()
+
+	require.NoError(t, c.Set(ctx, "a", "1234", 0))
+	require.NoError(t, c.Set(ctx, "b", "12", 0))
+	assert.Equal(t, int64(8), c.Used())
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+
+	// 覆盖按照新的值计算, 不会淘汰
+	require.NoError(t, c.Set(ctx, "b", "1", 0))
+	assert.Equal(t, int64(7), c.Used())
+	assert.Empty(t, evicted)
+
+	// 超过限制, 按照 LRU 淘汰到不超过限制为止
+	require.NoError(t, c.Set(ctx, "c", "12345", 0))
+	assert.Equal(t, []string{"a"}, evicted)
+	assert.Equal(t, int64(8), c.Used())
+	_, err = c.Get(ctx, "a")
+	assert.Equal(t, internal.NewErrKeyNotFound("a"), err)
+
+	require.NoError(t, c.Set(ctx, "d", "123456789", 0))
+	assert.Equal(t, []string{"a", "b", "c"}, evicted)
+	assert.Equal(t, int64(10), c.Used())
+
+	require.NoError(t, c.Delete(ctx, "d"))
+	assert.Equal(t, int64(0), c.Used())
+
+	// 覆盖的时候不会淘汰自己, 即使它是最久没有访问的
+	require.NoError(t, c.Set(ctx, "x", "12", 0))
+	require.NoError(t, c.Set(ctx, "d", "123", 0))
+	_, err = c.Get(ctx, "x")
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "d", "1234567", 0))
+	assert.Equal(t, []string{"a", "b", "c", "d", "x"}, evicted)
+	assert.Equal(t, int64(8), c.Used())
+	val, err := c.Get(ctx, "d")
+	require.NoError(t, err)
+	assert.Equal(t, "1234567", val)
+	require.NoError(t, c.Delete(ctx, "d"))
+
+	// 比整个缓存还大的值直接拒绝
+	assert.Equal(t, ErrOverCapacity, c.Set(ctx, "e", "1234567890", 0))
+	assert.Equal(t, int64(0), c.Used())
+}
+
+// TestMaxMemoryCache_overwriteFIFO FIFO 里面覆盖不算访问, 被覆盖的 key 同样不能被淘汰
+func TestMaxMemoryCache_overwriteFIFO(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewMaxMemoryCache(NewBuildInMapCache(time.Minute,
+		BuildInMapCacheWithEvicted(func(key string, val any) {
+			evicted = append(evicted, key)
+		}),
+		BuildInMapCacheWithEviction(0, NewFIFOPolicy())), 10, MaxMemoryCacheWithSizer(StringSizer))
+	defer func() {
+		_ = c.Close()
+	}()
+
+	require.NoError(t, c.Set(ctx, "a", "123", 0))
+	require.NoError(t, c.Set(ctx, "b", "12", 0))
+	require.NoError(t, c.Set(ctx, "a", "1234567", 0))
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, int64(8), c.Used())
+	val, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1234567", val)
+}
+
+// TestMaxMemoryCache_overwriteLFU 覆盖的时候 key 的访问次数保持不变, 热点 key 不会因为覆盖被淘汰
+func TestMaxMemoryCache_overwriteLFU(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewMaxMemoryCache(NewBuildInMapCache(time.Minute,
+		BuildInMapCacheWithEvicted(func(key string, val any) {
+			evicted = append(evicted, key)
+		}),
+		BuildInMapCacheWithEviction(0, NewLFUPolicy())), 10, MaxMemoryCacheWithSizer(StringSizer))
+	defer func() {
+		_ = c.Close()
+	}()
+
+	// 访问次数 a 4, b 2, c 1
+	require.NoError(t, c.Set(ctx, "a", "1", 0))
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(ctx, "a")
+		require.NoError(t, err)
+	}
+	require.NoError(t, c.Set(ctx, "b", "1", 0))
+	_, err := c.Get(ctx, "b")
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "c", "1", 0))
+
+	// 覆盖 a 需要腾出空间, 淘汰访问次数最少的 c
+	require.NoError(t, c.Set(ctx, "a", "123456", 0))
+	assert.Equal(t, []string{"c"}, evicted)
+
+	// a 的访问次数还是比 b 多, 所以淘汰的是 b
+	require.NoError(t, c.Set(ctx, "d", "1", 0))
+	assert.Equal(t, []string{"c", "b"}, evicted)
+	val, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "123456", val)
+}
+
+func TestMaxMemoryCache_noPolicy(t *testing.T) {
+	ctx := context.Background()
+	c := NewMaxMemoryCache(NewBuildInMapCache(time.Minute), 10, MaxMemoryCacheWithSizer(BytesSizer))
+	defer func() {
+		_ = c.Close()
+	}()
+	require.NoError(t, c.Set(ctx, "a", []byte("1234"), 0))
+	assert.Equal(t, ErrOverCapacity, c.Set(ctx, "b", []byte("12345"), 0))
+	assert.Equal(t, int64(5), c.Used())
+
+	// 过期删除之后释放内存
+	require.NoError(t, c.Set(ctx, "a", []byte("1234"), time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	_, err := c.Get(ctx, "a")
+	assert.Equal(t, internal.NewErrKeyNotFound("a"), err)
+	require.NoError(t, c.Set(ctx, "b", []byte("12345"), 0))
+	assert.Equal(t, int64(6), c.Used())
+}
@@ -0,0 +1,105 @@
+package cache
+
+import "reflect"
+
+// Sizer 估算缓存的值占用多少字节
+type Sizer interface {
+	Size(val any) int64
+}
+
+// SizerFunc 把函数转成 Sizer
+type SizerFunc func(val any) int64
+
+func (f SizerFunc) Size(val any) int64 {
+	return f(val)
+}
+
+var (
+	// BytesSizer 值是 []byte 的时候就是它的长度, 否则使用 ReflectSizer
+	BytesSizer Sizer = SizerFunc(func(val any) int64 {
+		if b, ok := val.([]byte); ok {
+			return int64(len(b))
+		}
+		return ReflectSizer.Size(val)
+	})
+	// StringSizer 值是 string 的时候就是它的长度, 否则使用 ReflectSizer
+	StringSizer Sizer = SizerFunc(func(val any) int64 {
+		if s, ok := val.(string); ok {
+			return int64(len(s))
+		}
+		return ReflectSizer.Size(val)
+	})
+	// ReflectSizer 用反射递归计算值本身和它引用的内存, 同一块内存只计算一次
+	// 只是估算, 不包括 map 的桶, 内存对齐之类的额外开销, 也不会进入 chan 和 func
+	ReflectSizer Sizer = SizerFunc(func(val any) int64 {
+		if val == nil {
+			return 0
+		}
+		return deepSize(reflect.ValueOf(val), make(map[uintptr]struct{}, 8))
+	})
+)
+
+// deepSize v 本身的大小加上它引用的内存的大小
+func deepSize(v reflect.Value, seen map[uintptr]struct{}) int64 {
+	return int64(v.Type().Size()) + indirectSize(v, seen)
+}
+
+// indirectSize v 引用的内存的大小, 不包括 v 本身
+func indirectSize(v reflect.Value, seen map[uintptr]struct{}) int64 {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || !visit(v.Pointer(), seen) {
+			return 0
+		}
+		return deepSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return deepSize(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || !visit(v.Pointer(), seen) {
+			return 0
+		}
+		res := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			res += indirectSize(v.Index(i), seen)
+		}
+		return res
+	case reflect.Array:
+		var res int64
+		for i := 0; i < v.Len(); i++ {
+			res += indirectSize(v.Index(i), seen)
+		}
+		return res
+	case reflect.Struct:
+		var res int64
+		for i := 0; i < v.NumField(); i++ {
+			res += indirectSize(v.Field(i), seen)
+		}
+		return res
+	case reflect.Map:
+		if v.IsNil() || !visit(v.Pointer(), seen) {
+			return 0
+		}
+		var res int64
+		iter := v.MapRange()
+		for iter.Next() {
+			res += deepSize(iter.Key(), seen) + deepSize(iter.Value(), seen)
+		}
+		return res
+	default:
+		return 0
+	}
+}
+
+// visit 第一次遇到 ptr 返回 true
+func visit(ptr uintptr, seen map[uintptr]struct{}) bool {
+	if _, ok := seen[ptr]; ok {
+		return false
+	}
+	seen[ptr] = struct{}{}
+	return true
+}
@@ -0,0 +1,118 @@
+package cache
+
+import "hash/maphash"
+
+// frequencySketch 估算 key 最近的访问频率, 由 count-min sketch 和 doorkeeper 组成
+// 只访问过一次的 key 记录在 doorkeeper 里面, 第二次访问才会计入 count-min sketch
+// 这样大量只访问一次的 key 不会占满 count-min sketch 的计数
+type frequencySketch struct {
+	seed maphash.Seed
+	// counters count-min sketch 的 4 行计数, 每个计数最大 15
+	counters [4][]uint8
+	mask     uint64
+	// doorkeeper 布隆过滤器
+	doorkeeper []uint64
+	doorMask   uint64
+	// additions 记录的次数, 达到 sampleSize 之后所有计数减半并且清空 doorkeeper
+	// 这样过去的热点会慢慢冷却
+	additions  int
+	sampleSize int
+}
+
+const maxFrequency = 15
+
+// newFrequencySketch capacity 是缓存的容量, 计数的个数是不小于它的 2 的幂
+func newFrequencySketch(capacity int) *frequencySketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &frequencySketch{
+		seed:       maphash.MakeSeed(),
+		mask:       uint64(width - 1),
+		doorkeeper: make([]uint64, width/8),
+		doorMask:   uint64(width*8 - 1),
+		sampleSize: 10 * width,
+	}
+	for i := range s.counters {
+		s.counters[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index 第 i 个哈希函数的结果, 用 splitmix64 把一个哈希值打散成多个互相独立的哈希值
+func index(h uint64, i int) uint64 {
+	h += uint64(i+1) * 0x9e3779b97f4a7c15
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	return h ^ h>>31
+}
+
+// increment 记录一次访问
+func (s *frequencySketch) increment(key string) {
+	h := maphash.String(s.seed, key)
+	if !s.admitDoor(h) {
+		return
+	}
+	for i := range s.counters {
+		idx := index(h, i) & s.mask
+		if s.counters[i][idx] < maxFrequency {
+			s.counters[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate 估算访问次数, 取 4 行计数的最小值, 在 doorkeeper 里面的再加 1
+func (s *frequencySketch) estimate(key string) int {
+	h := maphash.String(s.seed, key)
+	res := uint8(maxFrequency)
+	for i := range s.counters {
+		if c := s.counters[i][index(h, i)&s.mask]; c < res {
+			res = c
+		}
+	}
+	if s.inDoor(h) {
+		return int(res) + 1
+	}
+	return int(res)
+}
+
+// admitDoor 已经在 doorkeeper 里面返回 true, 否则加入 doorkeeper 并返回 false
+func (s *frequencySketch) admitDoor(h uint64) bool {
+	if s.inDoor(h) {
+		return true
+	}
+	for i := len(s.counters); i < len(s.counters)+2; i++ {
+		bit := index(h, i) & s.doorMask
+		s.doorkeeper[bit/64] |= 1 << (bit % 64)
+	}
+	return false
+}
+
+// inDoor doorkeeper 用的哈希函数和 count-min sketch 的不一样
+func (s *frequencySketch) inDoor(h uint64) bool {
+	for i := len(s.counters); i < len(s.counters)+2; i++ {
+		bit := index(h, i) & s.doorMask
+		if s.doorkeeper[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// reset 老化, 所有计数减半
+func (s *frequencySketch) reset() {
+	for i := range s.counters {
+		for j := range s.counters[i] {
+			s.counters[i][j] >>= 1
+		}
+	}
+	for i := range s.doorkeeper {
+		s.doorkeeper[i] = 0
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,171 @@
+package cache
+
+import "container/list"
+
+// BuildInMapCacheWithWTinyLFU 使用 W-TinyLFU 淘汰策略, 最多 capacity 个 key
+// 适合有大量只访问一次的 key 的场景, 例如扫描, 这些 key 不会把热点挤出缓存
+func BuildInMapCacheWithWTinyLFU(capacity int) BuildInMapCacheOption {
+	return BuildInMapCacheWithEviction(capacity, NewWTinyLFUPolicy(capacity))
+}
+
+var _ EvictionPolicy = &WTinyLFUPolicy{}
+
+// segment key 所在的区域
+type segment uint8
+
+const (
+	segWindow segment = iota
+	segProbation
+	segProtected
+)
+
+type tinyLFUEntry struct {
+	key string
+	seg segment
+}
+
+// WTinyLFUPolicy Window-TinyLFU, 参考 https://arxiv.org/abs/1512.00727
+// 新的 key 先进入占容量 1% 的 window LRU, 从 window 出来之后要和 main 的淘汰对象比较访问频率,
+// 频率更高才能进入 main, 否则被淘汰
+// main 是分段 LRU, 新进入的 key 在 probation, 再次访问之后进入 protected, protected 最多占 main 的 80%
+// 访问频率由 frequencySketch 估算
+type WTinyLFUPolicy struct {
+	keys      map[string]*list.Element
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	// windowCap window 的容量, protectedCap protected 的容量
+	windowCap    int
+	protectedCap int
+	sketch       *frequencySketch
+}
+
+func NewWTinyLFUPolicy(capacity int) *WTinyLFUPolicy {
+	windowCap := capacity / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	return &WTinyLFUPolicy{
+		keys:         make(map[string]*list.Element, capacity),
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		windowCap:    windowCap,
+		protectedCap: (capacity - windowCap) * 8 / 10,
+		sketch:       newFrequencySketch(capacity),
+	}
+}
+
+func (p *WTinyLFUPolicy) KeyAccessed(key string) {
+	p.sketch.increment(key)
+	e, ok := p.keys[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*tinyLFUEntry)
+	switch entry.seg {
+	case segWindow:
+		p.window.MoveToFront(e)
+	case segProtected:
+		p.protected.MoveToFront(e)
+	case segProbation:
+		// 再次访问, 晋升到 protected, protected 满了就把最久没有访问的降级到 probation
+		p.probation.Remove(e)
+		entry.seg = segProtected
+		p.keys[key] = p.protected.PushFront(entry)
+		if p.protected.Len() > p.protectedCap {
+			p.moveTo(p.protected.Back(), segProbation)
+		}
+	}
+}
+
+func (p *WTinyLFUPolicy) KeyAdded(key string) {
+	if _, ok := p.keys[key]; ok {
+		p.KeyAccessed(key)
+		return
+	}
+	p.sketch.increment(key)
+	p.keys[key] = p.window.PushFront(&tinyLFUEntry{key: key, seg: segWindow})
+	// 还没有满的时候, 从 window 出来的 key 直接进入 main
+	if p.window.Len() > p.windowCap {
+		p.moveTo(p.window.Back(), segProbation)
+	}
+}
+
+func (p *WTinyLFUPolicy) KeyDeleted(key string) {
+	e, ok := p.keys[key]
+	if !ok {
+		return
+	}
+	p.list(e.Value.(*tinyLFUEntry).seg).Remove(e)
+	delete(p.keys, key)
+}
+
+// Evict 缓存满了的时候, window 里面最久没有访问的 key 是候选者, probation 里面最久没有访问的 key 是淘汰对象
+// 候选者的访问频率比淘汰对象高, 就淘汰淘汰对象, 候选者进入 main, 否则淘汰候选者
+func (p *WTinyLFUPolicy) Evict() (string, bool) {
+	victim := p.probation.Back()
+	if victim == nil {
+		victim = p.protected.Back()
+	}
+	return p.evict(p.window.Back(), victim)
+}
+
+// EvictExcept 候选者或者淘汰对象是 key 的时候, 换成同一个区域里面前一个 key
+func (p *WTinyLFUPolicy) EvictExcept(key string) (string, bool) {
+	victim := p.except(p.probation.Back(), key)
+	if victim == nil {
+		victim = p.except(p.protected.Back(), key)
+	}
+	return p.evict(p.except(p.window.Back(), key), victim)
+}
+
+func (p *WTinyLFUPolicy) except(e *list.Element, key string) *list.Element {
+	if e != nil && e.Value.(*tinyLFUEntry).key == key {
+		return e.Prev()
+	}
+	return e
+}
+
+func (p *WTinyLFUPolicy) evict(candidate, victim *list.Element) (string, bool) {
+	switch {
+	case candidate == nil && victim == nil:
+		return "", false
+	case victim == nil:
+		return p.remove(candidate), true
+	case candidate == nil:
+		return p.remove(victim), true
+	}
+	if p.sketch.estimate(candidate.Value.(*tinyLFUEntry).key) > p.sketch.estimate(victim.Value.(*tinyLFUEntry).key) {
+		key := p.remove(victim)
+		p.moveTo(candidate, segProbation)
+		return key, true
+	}
+	return p.remove(candidate), true
+}
+
+func (p *WTinyLFUPolicy) list(seg segment) *list.List {
+	switch seg {
+	case segWindow:
+		return p.window
+	case segProbation:
+		return p.probation
+	default:
+		return p.protected
+	}
+}
+
+// moveTo 把 e 移到 seg 的头部
+func (p *WTinyLFUPolicy) moveTo(e *list.Element, seg segment) {
+	entry := e.Value.(*tinyLFUEntry)
+	p.list(entry.seg).Remove(e)
+	entry.seg = seg
+	p.keys[entry.key] = p.list(seg).PushFront(entry)
+}
+
+func (p *WTinyLFUPolicy) remove(e *list.Element) string {
+	entry := e.Value.(*tinyLFUEntry)
+	p.list(entry.seg).Remove(e)
+	delete(p.keys, entry.key)
+	return entry.key
+}
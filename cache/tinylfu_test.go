@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWTinyLFUPolicy(t *testing.T) {
+	// window 1 个, protected 最多 7 个
+	p := NewWTinyLFUPolicy(10)
+	for i := 0; i < 10; i++ {
+		p.KeyAdded(strconv.Itoa(i))
+	}
+	assert.Equal(t, 1, p.window.Len())
+	assert.Equal(t, 9, p.probation.Len())
+
+	// 再次访问的 key 晋升到 protected, 超过 7 个之后最久没有访问的降级
+	for i := 1; i < 10; i++ {
+		p.KeyAccessed(strconv.Itoa(i))
+	}
+	p.KeyAccessed("9")
+	p.KeyAccessed("9")
+	assert.Equal(t, 7, p.protected.Len())
+	assert.Equal(t, 2, p.probation.Len())
+	assert.Equal(t, "8", p.protected.Front().Value.(*tinyLFUEntry).key)
+
+	// 候选者 9 访问过四次, 淘汰对象 0 只访问过一次, 淘汰 0, 9 进入 probation
+	key, ok := p.Evict()
+	require.True(t, ok)
+	assert.Equal(t, "0", key)
+	assert.Equal(t, 0, p.window.Len())
+	assert.Equal(t, "9", p.probation.Front().Value.(*tinyLFUEntry).key)
+
+	// 没有候选者的时候直接淘汰 probation 里面最久没有访问的
+	p.KeyDeleted("9")
+	key, ok = p.Evict()
+	require.True(t, ok)
+	assert.Equal(t, "1", key)
+	assert.Equal(t, 7, len(p.keys))
+}
+
+func TestWTinyLFUPolicy_evictExcept(t *testing.T) {
+	// window 里面是 9, probation 从旧到新是 0 到 8
+	p := NewWTinyLFUPolicy(10)
+	for i := 0; i < 10; i++ {
+		p.KeyAdded(strconv.Itoa(i))
+	}
+
+	// 候选者是 9 自己, 相当于没有候选者, 直接淘汰 probation 里面的 0
+	key, ok := p.EvictExcept("9")
+	require.True(t, ok)
+	assert.Equal(t, "0", key)
+	assert.Equal(t, "9", p.window.Back().Value.(*tinyLFUEntry).key)
+
+	// 淘汰对象换成 2, 候选者 9 的频率不比 2 高, 淘汰 9
+	key, ok = p.EvictExcept("1")
+	require.True(t, ok)
+	assert.Equal(t, "9", key)
+	// 1 还在 probation 的末尾
+	assert.Equal(t, "1", p.probation.Back().Value.(*tinyLFUEntry).key)
+}
+
+func TestFrequencySketch(t *testing.T) {
+	s := newFrequencySketch(1024)
+	// 第一次只记录在 doorkeeper 里面
+	s.increment("a")
+	assert.Equal(t, 1, s.estimate("a"))
+	for i := 0; i < 20; i++ {
+		s.increment("a")
+	}
+	// 计数最大 15, 再加上 doorkeeper 的 1
+	assert.Equal(t, maxFrequency+1, s.estimate("a"))
+	assert.Equal(t, 0, s.estimate("b"))
+
+	// 老化之后计数减半, doorkeeper 清空
+	s.reset()
+	assert.Equal(t, maxFrequency/2, s.estimate("a"))
+}
+
+// TestBuildInMapCache_WTinyLFU 扫描不会把热点挤出缓存, LRU 会
+func TestBuildInMapCache_WTinyLFU(t *testing.T) {
+	testCases := []struct {
+		name    string
+		opt     BuildInMapCacheOption
+		minHits int
+		maxHits int
+	}{
+		{
+			name:    "w-tinylfu",
+			opt:     BuildInMapCacheWithWTinyLFU(100),
+			minHits: 60,
+			maxHits: 99,
+		},
+		{
+			name:    "lru",
+			opt:     BuildInMapCacheWithEviction(100, NewLRUPolicy()),
+			minHits: 0,
+			maxHits: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewBuildInMapCache(time.Minute, tc.opt)
+			defer func() {
+				_ = c.Close()
+			}()
+			ctx := context.Background()
+			for i := 0; i < 99; i++ {
+				key := fmt.Sprintf("hot_%d", i)
+				require.NoError(t, c.Set(ctx, key, i, 0))
+				for j := 0; j < 3; j++ {
+					_, err := c.Get(ctx, key)
+					require.NoError(t, err)
+				}
+			}
+			for i := 0; i < 500; i++ {
+				require.NoError(t, c.Set(ctx, fmt.Sprintf("scan_%d", i), i, 0))
+			}
+			hits := 0
+			for i := 0; i < 99; i++ {
+				if _, err := c.Get(ctx, fmt.Sprintf("hot_%d", i)); err == nil {
+					hits++
+				}
+			}
+			assert.GreaterOrEqual(t, hits, tc.minHits)
+			assert.LessOrEqual(t, hits, tc.maxHits)
+		})
+	}
+}
+
+// 在 cache 目录下执行
+// go test -run=^$ -bench=BenchmarkWTinyLFU -benchmem
+// 输出
+// cpu: Intel(R) Xeon(R) Processor
+// BenchmarkWTinyLFU/lru/zipf                1417098    1233 ns/op    0.5229 hit-ratio    103 B/op    3 allocs/op
+// BenchmarkWTinyLFU/lru/zipf+scan            987844    1659 ns/op    0.2166 hit-ratio    180 B/op    6 allocs/op
+// BenchmarkWTinyLFU/lru/shifting            1000000    1186 ns/op    0.5218 hit-ratio    103 B/op    3 allocs/op
+// BenchmarkWTinyLFU/w-tinylfu/zipf          1000000    1196 ns/op    0.6100 hit-ratio     88 B/op    2 allocs/op
+// BenchmarkWTinyLFU/w-tinylfu/zipf+scan      848154    1739 ns/op    0.2943 hit-ratio    170 B/op    5 allocs/op
+// BenchmarkWTinyLFU/w-tinylfu/shifting      1000000    1307 ns/op    0.5627 hit-ratio     99 B/op    3 allocs/op
+// 扫描会把 LRU 里面的热点挤出去, W-TinyLFU 的命中率高了三分之一, 热点变化的时候老化保证了命中率不会下降
+func BenchmarkWTinyLFU(b *testing.B) {
+	policies := []struct {
+		name string
+		opt  func(capacity int) BuildInMapCacheOption
+	}{
+		{
+			name: "lru",
+			opt: func(capacity int) BuildInMapCacheOption {
+				return BuildInMapCacheWithEviction(capacity, NewLRUPolicy())
+			},
+		},
+		{name: "w-tinylfu", opt: BuildInMapCacheWithWTinyLFU},
+	}
+	const keys = 100000
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("key_%d", i)
+	}
+	for _, p := range policies {
+		newCache := func(capacity int) Cache {
+			return NewBuildInMapCache(time.Minute, p.opt(capacity))
+		}
+		b.Run(p.name+"/zipf", func(b *testing.B) {
+			benchmarkZipf(b, newCache, 1.01)
+		})
+		// 一半的访问是只访问一次的扫描
+		b.Run(p.name+"/zipf+scan", func(b *testing.B) {
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, keys-1)
+			benchmarkHitRatio(b, newCache(keys/100), func(i int) string {
+				if i%2 == 0 {
+					return "scan_" + strconv.Itoa(i)
+				}
+				return names[zipf.Uint64()]
+			})
+		})
+		// 热点每 10 万次访问换一批, 考察老化
+		b.Run(p.name+"/shifting", func(b *testing.B) {
+			zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, keys-1)
+			benchmarkHitRatio(b, newCache(keys/100), func(i int) string {
+				return names[(zipf.Uint64()+uint64(i/100000)*1000)%keys]
+			})
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package orm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"geektime-go-study/orm/model"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type AuditOp string
+
+const (
+	AuditInsert AuditOp = "INSERT"
+	AuditUpdate AuditOp = "UPDATE"
+	AuditDelete AuditOp = "DELETE"
+)
+
+// AuditRecord 一条写操作的审计记录, 一行数据对应一条记录
+type AuditRecord struct {
+	Table string
+	// PrimaryKey 主键的值, 模型没有主键或者拿不到自增主键的时候为 nil
+	PrimaryKey any
+	Op         AuditOp
+	// Old 修改之前的值, key 是列名
+	// 只有 UnitOfWork 的 UPDATE 和 DELETE 才拿得到旧值
+	Old map[string]any
+	// New 修改之后的值, key 是列名, DELETE 的时候为 nil
+	New map[string]any
+	// Actor 操作人, 通过 WithActor 放进 context
+	Actor any
+	Time  time.Time
+}
+
+// AuditSink 审计记录写到哪里
+// sess 是执行写操作的 Session, 在事务中的写操作 sess 就是事务
+type AuditSink interface {
+	Write(ctx context.Context, sess Session, records []AuditRecord) error
+}
+
+// AuditSkipper 模型实现了这个接口并且返回 true 的时候, 不记录审计
+type AuditSkipper interface {
+	SkipAudit() bool
+}
+
+type actorKey struct{}
+
+// WithActor 把操作人放进 context, 审计记录里面的 Actor 从这里来
+func WithActor(ctx context.Context, actor any) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFrom(ctx context.Context) (any, bool) {
+	actor := ctx.Value(actorKey{})
+	return actor, actor != nil
+}
+
+// DBWithAudit 开启审计, 覆盖 Inserter (包括批量插入) 和 UnitOfWork.Commit 发起的写操作
+// 其它的写操作不会记录, 例如直接通过 sql.DB 执行的语句
+// 不在事务中的 Inserter 会开一个事务, 写 sink 失败的时候插入的数据会回滚
+func DBWithAudit(sink AuditSink) DBOption {
+	return func(db *DB) {
+		db.auditSink = sink
+	}
+}
+
+// audit 补上操作人和时间, 然后写到 sink
+// 写 sink 失败会返回错误, 在事务中会导致事务回滚
+func (db *DB) audit(ctx context.Context, sess Session, records []AuditRecord) error {
+	if db.auditSink == nil || len(records) == 0 {
+		return nil
+	}
+	actor, _ := ActorFrom(ctx)
+	now := time.Now()
+	for i := range records {
+		records[i].Actor = actor
+		records[i].Time = now
+	}
+	return db.auditSink.Write(ctx, sess, records)
+}
+
+// auditEnabled 没有开启审计, 或者模型不需要审计的时候返回 false
+func (db *DB) auditEnabled(val any) bool {
+	if db.auditSink == nil {
+		return false
+	}
+	if s, ok := val.(AuditSkipper); ok && s.SkipAudit() {
+		return false
+	}
+	return true
+}
+
+// auditMask 加密字段在审计记录里面的值, 审计记录不能泄露明文, 密文也没有意义
+const auditMask = "******"
+
+// auditValues 把字段的值转为列名到值的 map
+func auditValues(fields []*model.Field, vals []any) map[string]any {
+	res := make(map[string]any, len(fields))
+	for i, fd := range fields {
+		if fd.Encrypt != model.EncryptNone {
+			res[fd.ColName] = auditMask
+			continue
+		}
+		res[fd.ColName] = vals[i]
+	}
+	return res
+}
+
+// auditPK 取出主键, 没有主键返回 nil
+func auditPK(m *model.Model, val any) any {
+	if m.PrimaryKey == nil {
+		return nil
+	}
+	return reflect.ValueOf(val).Elem().FieldByName(m.PrimaryKey.FieldName).Interface()
+}
+
+// AuditLog 审计表, 配合 NewTableAuditSink 使用
+//
+//	CREATE TABLE audit_log(
+//	    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+//	    table_name VARCHAR(128),
+//	    primary_key VARCHAR(128),
+//	    op VARCHAR(16),
+//	    old_values TEXT,
+//	    new_values TEXT,
+//	    actor VARCHAR(128),
+//	    created_at DATETIME
+//	)
+type AuditLog struct {
+	Id         int64
+	TableName  string
+	PrimaryKey string
+	Op         string
+	// OldValues 和 NewValues 是 JSON
+	OldValues string
+	NewValues string
+	Actor     string
+	CreatedAt time.Time
+}
+
+// SkipAudit 审计表本身不需要审计
+func (AuditLog) SkipAudit() bool {
+	return true
+}
+
+type tableAuditSink struct{}
+
+// NewTableAuditSink 通过 ORM 把记录写到 audit_log 表
+// 在事务中的写操作, 审计记录也在同一个事务里面写入
+func NewTableAuditSink() AuditSink {
+	return tableAuditSink{}
+}
+
+func (tableAuditSink) Write(ctx context.Context, sess Session, records []AuditRecord) error {
+	logs := make([]*AuditLog, 0, len(records))
+	for _, r := range records {
+		l := &AuditLog{
+			TableName: r.Table,
+			Op:        string(r.Op),
+			CreatedAt: r.Time,
+		}
+		if r.PrimaryKey != nil {
+			l.PrimaryKey = fmt.Sprint(r.PrimaryKey)
+		}
+		if r.Actor != nil {
+			l.Actor = fmt.Sprint(r.Actor)
+		}
+		var err error
+		if l.OldValues, err = auditJSON(r.Old); err != nil {
+			return err
+		}
+		if l.NewValues, err = auditJSON(r.New); err != nil {
+			return err
+		}
+		logs = append(logs, l)
+	}
+	_, err := NewInserter[AuditLog](sess).
+		Columns("TableName", "PrimaryKey", "Op", "OldValues", "NewValues", "Actor", "CreatedAt").
+		Values(logs...).Exec(ctx)
+	return err
+}
+
+func auditJSON(vals map[string]any) (string, error) {
+	if vals == nil {
+		return "", nil
+	}
+	bs, err := json.Marshal(vals)
+	return string(bs), err
+}
+
+type jsonLinesAuditSink struct {
+	mutex sync.Mutex
+	enc   *json.Encoder
+}
+
+// NewJSONLinesAuditSink 每条记录写一行 JSON
+// 写入之间是互斥的, 所以 w 不需要是并发安全的
+func NewJSONLinesAuditSink(w io.Writer) AuditSink {
+	return &jsonLinesAuditSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonLinesAuditSink) Write(ctx context.Context, sess Session, records []AuditRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, r := range records {
+		if err := s.enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type chanAuditSink struct {
+	ch chan<- AuditRecord
+}
+
+// NewChanAuditSink 把记录发送到 ch, 由用户自己消费
+// ch 满了会阻塞写操作, 直到 ctx 过期
+func NewChanAuditSink(ch chan<- AuditRecord) AuditSink {
+	return chanAuditSink{ch: ch}
+}
+
+func (s chanAuditSink) Write(ctx context.Context, sess Session, records []AuditRecord) error {
+	for _, r := range records {
+		select {
+		case s.ch <- r:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type AuditUser struct {
+	Id   int64
+	Name string
+	Age  int
+}
+
+type AuditSession struct {
+	Id    int64
+	Token string
+}
+
+func (AuditSession) SkipAudit() bool {
+	return true
+}
+
+func prepareAuditDB(t *testing.T, name string, sink AuditSink) *DB {
+	db, err := Open("sqlite3", "file:"+name+".db?cache=shared&mode=memory", DBWithAudit(sink))
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE audit_user(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, age INTEGER)",
+		"CREATE TABLE audit_session(id INTEGER PRIMARY KEY, token TEXT)",
+		`CREATE TABLE audit_log(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    table_name TEXT,
+    primary_key TEXT,
+    op TEXT,
+    old_values TEXT,
+    new_values TEXT,
+    actor TEXT,
+    created_at DATETIME
+)`,
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func TestAudit_chan(t *testing.T) {
+	ch := make(chan AuditRecord, 10)
+	db := prepareAuditDB(t, "audit_chan", NewChanAuditSink(ch))
+	ctx := WithActor(context.Background(), "admin")
+
+	// 不插入主键, 审计记录里面是自增主键
+	_, err := NewInserter[AuditUser](db).Columns("Name", "Age").Values(&AuditUser{Name: "Tom", Age: 18}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = NewInserter[AuditUser](db).Values(&AuditUser{Id: 2, Name: "Jerry"}, &AuditUser{Id: 3, Name: "Jack"}).Exec(ctx)
+	require.NoError(t, err)
+	// 不需要审计的模型
+	_, err = NewInserter[AuditSession](db).Values(&AuditSession{Id: 1, Token: "abc"}).Exec(ctx)
+	require.NoError(t, err)
+
+	uow := NewSession(db)
+	u, err := NewSelector[AuditUser](uow).Where(C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+	u.Age = 19
+	jerry, err := NewSelector[AuditUser](uow).Where(C("Id").EQ(2)).Get(ctx)
+	require.NoError(t, err)
+	require.NoError(t, uow.Remove(jerry, &AuditUser{Id: 3}))
+	require.NoError(t, uow.Commit(ctx))
+	close(ch)
+
+	var records []AuditRecord
+	for r := range ch {
+		assert.False(t, r.Time.IsZero())
+		r.Time = time.Time{}
+		records = append(records, r)
+	}
+	assert.Equal(t, []AuditRecord{
+		{
+			Table: "audit_user", PrimaryKey: int64(1), Op: AuditInsert, Actor: "admin",
+			New: map[string]any{"name": "Tom", "age": 18},
+		},
+		{
+			Table: "audit_user", PrimaryKey: int64(2), Op: AuditInsert, Actor: "admin",
+			New: map[string]any{"id": int64(2), "name": "Jerry", "age": 0},
+		},
+		{
+			Table: "audit_user", PrimaryKey: int64(3), Op: AuditInsert, Actor: "admin",
+			New: map[string]any{"id": int64(3), "name": "Jack", "age": 0},
+		},
+		{
+			Table: "audit_user", PrimaryKey: int64(1), Op: AuditUpdate, Actor: "admin",
+			Old: map[string]any{"age": 18}, New: map[string]any{"age": 19},
+		},
+		{
+			Table: "audit_user", PrimaryKey: int64(2), Op: AuditDelete, Actor: "admin",
+			Old: map[string]any{"id": int64(2), "name": "Jerry", "age": 0},
+		},
+		{
+			// 没有被跟踪的实体拿不到旧值
+			Table: "audit_user", PrimaryKey: int64(3), Op: AuditDelete, Actor: "admin",
+		},
+	}, records)
+}
+
+func TestAudit_table(t *testing.T) {
+	db := prepareAuditDB(t, "audit_table", NewTableAuditSink())
+	ctx := WithActor(context.Background(), 12)
+
+	uow := NewSession(db)
+	require.NoError(t, uow.Add(&AuditUser{Name: "Tom"}))
+	require.NoError(t, uow.Commit(ctx))
+
+	logs, err := NewSelector[AuditLog](db).GetMulti(ctx)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.False(t, logs[0].CreatedAt.IsZero())
+	logs[0].CreatedAt = time.Time{}
+	assert.Equal(t, &AuditLog{
+		Id:         1,
+		TableName:  "audit_user",
+		PrimaryKey: "1",
+		Op:         "INSERT",
+		NewValues:  `{"age":0,"name":"Tom"}`,
+		Actor:      "12",
+	}, logs[0])
+}
+
+type failAuditSink struct{}
+
+func (failAuditSink) Write(ctx context.Context, sess Session, records []AuditRecord) error {
+	return errors.New("sink 不可用")
+}
+
+func TestAudit_sinkFailed(t *testing.T) {
+	db := prepareAuditDB(t, "audit_fail", failAuditSink{})
+	ctx := context.Background()
+
+	// 写 sink 失败, 插入的数据也要回滚
+	_, err := NewInserter[AuditUser](db).Values(&AuditUser{Id: 1, Name: "Tom"}).Exec(ctx)
+	assert.Equal(t, errors.New("sink 不可用"), err)
+	_, err = NewSelector[AuditUser](db).Where(C("Id").EQ(1)).Get(ctx)
+	assert.Equal(t, ErrNoRows, err)
+
+	// 不需要审计的模型不受影响
+	_, err = NewInserter[AuditSession](db).Values(&AuditSession{Id: 1, Token: "abc"}).Exec(ctx)
+	require.NoError(t, err)
+}
+
+func TestAudit_jsonLines(t *testing.T) {
+	buf := &bytes.Buffer{}
+	db := prepareAuditDB(t, "audit_json", NewJSONLinesAuditSink(buf))
+	_, err := NewInserter[AuditUser](db).
+		Values(&AuditUser{Id: 1, Name: "Tom"}, &AuditUser{Id: 2, Name: "Jerry"}).Exec(context.Background())
+	require.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var r AuditRecord
+	require.NoError(t, json.Unmarshal(lines[1], &r))
+	assert.Equal(t, "audit_user", r.Table)
+	assert.Equal(t, AuditInsert, r.Op)
+	assert.Equal(t, float64(2), r.PrimaryKey)
+	assert.Equal(t, map[string]any{"id": float64(2), "name": "Jerry", "age": float64(0)}, r.New)
+}
@@ -0,0 +1,219 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"geektime-go-study/orm/internal/errs"
+	"strings"
+	"sync"
+)
+
+// BatchOptions 批量插入的选项
+type BatchOptions struct {
+	// Columns 插入的字段, 为空则插入全部字段
+	Columns []string
+	// ChunkSize 每一批的行数, 0 则按照方言的占位符上限尽量多放
+	// 超过占位符上限的时候以上限为准
+	ChunkSize int
+	// InTx 所有批次在同一个事务里面执行, 任何一批失败都会回滚
+	// sess 本身就是 *Tx 的时候, 总是在这个事务里面执行
+	InTx bool
+	// Concurrency 不在事务里面的时候, 最多同时执行多少批, 默认是 1
+	Concurrency int
+}
+
+// BatchResult 批量插入的结果
+type BatchResult struct {
+	// RowsAffected 成功的批次影响的行数之和
+	RowsAffected int64
+	// Chunks 分成了多少批
+	Chunks int
+}
+
+// ChunkError 一批数据插入失败
+type ChunkError struct {
+	// Index 第几批, 从 0 开始
+	Index int
+	// Start 和 End 这一批数据在 rows 中的范围 [Start, End)
+	Start int
+	End   int
+	Err   error
+}
+
+func (e ChunkError) Error() string {
+	return fmt.Sprintf("orm: 第 %d 批 [%d, %d) 插入失败: %v", e.Index, e.Start, e.End, e.Err)
+}
+
+func (e ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError 批量插入中失败的批次, 按照 Index 排序
+// 在事务中执行的时候, 遇到第一个失败的批次就会回滚, 所以只有一个
+type BatchError struct {
+	Chunks []ChunkError
+}
+
+func (e *BatchError) Error() string {
+	msgs := make([]string, 0, len(e.Chunks))
+	for _, c := range e.Chunks {
+		msgs = append(msgs, c.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap 返回第一个失败批次的错误, 方便用 errors.Is 判断, 例如 ErrDuplicateKey
+func (e *BatchError) Unwrap() error {
+	return e.Chunks[0].Err
+}
+
+// chunk 一批数据
+type chunk struct {
+	index      int
+	start, end int
+}
+
+// BatchInsert 分批插入 rows
+// 数据库对一条语句里面的占位符数量有限制, 例如 SQLite 是 32766, MySQL 是 65535
+// 所以按照插入的列数计算每一批最多多少行
+// 每一批都是一个 Inserter, 所以租户, 钩子, 加密和审计的处理和 Inserter 一致
+func BatchInsert[T any](ctx context.Context, sess Session, rows []*T, opts BatchOptions) (BatchResult, error) {
+	if len(rows) == 0 {
+		return BatchResult{}, errs.ErrInsertZeroRow
+	}
+	db := sess.getDB()
+	m, err := db.r.Get(rows[0])
+	if err != nil {
+		return BatchResult{}, err
+	}
+	cols := len(m.Fields)
+	if len(opts.Columns) > 0 {
+		// 可能会多插入一个租户字段, 按照多一列计算
+		cols = len(opts.Columns)
+		if m.Tenant != nil {
+			cols++
+		}
+	}
+	size := db.dialect.maxPlaceholders() / cols
+	if opts.ChunkSize > 0 && opts.ChunkSize < size {
+		size = opts.ChunkSize
+	}
+	if size < 1 {
+		size = 1
+	}
+	chunks := make([]chunk, 0, (len(rows)+size-1)/size)
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunks = append(chunks, chunk{index: len(chunks), start: start, end: end})
+	}
+
+	b := batchInserter[T]{rows: rows, cols: opts.Columns, chunks: chunks}
+	if tx, ok := sess.(*Tx); ok {
+		return b.runInTx(ctx, tx)
+	}
+	if opts.InTx {
+		var res BatchResult
+		err = db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+			res, err = b.runInTx(ctx, tx)
+			return err
+		}, nil)
+		if err != nil {
+			// 事务回滚了, 前面成功的批次也不算数
+			return BatchResult{Chunks: len(chunks)}, err
+		}
+		return res, nil
+	}
+	return b.run(ctx, sess, opts.Concurrency)
+}
+
+type batchInserter[T any] struct {
+	rows   []*T
+	cols   []string
+	chunks []chunk
+}
+
+func (b batchInserter[T]) exec(ctx context.Context, sess Session, c chunk) (int64, error) {
+	res, err := NewInserter[T](sess).Columns(b.cols...).Values(b.rows[c.start:c.end]...).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// runInTx 按顺序执行, 遇到失败的批次就返回
+func (b batchInserter[T]) runInTx(ctx context.Context, tx *Tx) (BatchResult, error) {
+	res := BatchResult{Chunks: len(b.chunks)}
+	for _, c := range b.chunks {
+		affected, err := b.exec(ctx, tx, c)
+		if err != nil {
+			return res, &BatchError{Chunks: []ChunkError{
+				{Index: c.index, Start: c.start, End: c.end, Err: err},
+			}}
+		}
+		res.RowsAffected += affected
+	}
+	return res, nil
+}
+
+// run 最多 concurrency 批同时执行, 失败的批次不影响其它批次
+func (b batchInserter[T]) run(ctx context.Context, sess Session, concurrency int) (BatchResult, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		res    = BatchResult{Chunks: len(b.chunks)}
+		failed = make([]*ChunkError, len(b.chunks))
+		sem    = make(chan struct{}, concurrency)
+	)
+	for _, c := range b.chunks {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(c chunk) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			affected, err := b.exec(ctx, sess, c)
+			if err != nil {
+				// 每个批次只写自己的位置, 不需要加锁
+				failed[c.index] = &ChunkError{Index: c.index, Start: c.start, End: c.end, Err: err}
+				return
+			}
+			mutex.Lock()
+			res.RowsAffected += affected
+			mutex.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	var chunkErrs []ChunkError
+	for _, e := range failed {
+		if e != nil {
+			chunkErrs = append(chunkErrs, *e)
+		}
+	}
+	if len(chunkErrs) > 0 {
+		return res, &BatchError{Chunks: chunkErrs}
+	}
+	return res, nil
+}
+
+// maxPlaceholders SQLite 3.32.0 之后是 32766, 之前是 999
+func (sqlite3Dialect) maxPlaceholders() int {
+	return 32766
+}
+
+// maxPlaceholders MySQL 的预编译语句最多 65535 个参数
+func (mysqlDialect) maxPlaceholders() int {
+	return 65535
+}
+
+// maxPlaceholders PostgreSQL 的协议用两个字节表示参数个数
+func (postgresDialect) maxPlaceholders() int {
+	return 65535
+}
@@ -0,0 +1,163 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type BatchUser struct {
+	Id   int64
+	Name string
+}
+
+func prepareBatchDB(t *testing.T, name string) *DB {
+	db, err := Open("sqlite3", "file:"+name+".db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	// 共享缓存的内存数据库并发写会报 table is locked
+	db.db.SetMaxOpenConns(1)
+	_, err = db.db.Exec("CREATE TABLE batch_user(id INTEGER PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	return db
+}
+
+func batchUsers(n int) []*BatchUser {
+	res := make([]*BatchUser, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, &BatchUser{Id: int64(i), Name: "Tom"})
+	}
+	return res
+}
+
+func countBatchUsers(t *testing.T, db *DB) int {
+	var cnt int
+	require.NoError(t, db.db.QueryRow("SELECT COUNT(*) FROM batch_user").Scan(&cnt))
+	return cnt
+}
+
+func TestBatchInsert(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		name string
+		// 先插入的数据, 用来制造主键冲突
+		existing []*BatchUser
+		// tx 为 true 的时候, sess 是事务
+		tx      bool
+		rows    []*BatchUser
+		opts    BatchOptions
+		wantRes BatchResult
+		// wantChunks 失败的批次
+		wantChunks []int
+		wantCnt    int
+	}{
+		{
+			// 两列, 每批最多 32766 / 2 行
+			name:    "placeholder limit",
+			rows:    batchUsers(40000),
+			wantRes: BatchResult{RowsAffected: 40000, Chunks: 3},
+			wantCnt: 40000,
+		},
+		{
+			name:    "chunk size",
+			rows:    batchUsers(10),
+			opts:    BatchOptions{ChunkSize: 3},
+			wantRes: BatchResult{RowsAffected: 10, Chunks: 4},
+			wantCnt: 10,
+		},
+		{
+			// 一列, 每批最多 32766 行, 比 ChunkSize 小
+			name:    "chunk size over limit",
+			rows:    batchUsers(40000),
+			opts:    BatchOptions{Columns: []string{"Id"}, ChunkSize: 40000},
+			wantRes: BatchResult{RowsAffected: 40000, Chunks: 2},
+			wantCnt: 40000,
+		},
+		{
+			name:       "chunk failed",
+			existing:   []*BatchUser{{Id: 5}, {Id: 10}},
+			rows:       batchUsers(10),
+			opts:       BatchOptions{ChunkSize: 3},
+			wantRes:    BatchResult{RowsAffected: 6, Chunks: 4},
+			wantChunks: []int{1, 3},
+			wantCnt:    8,
+		},
+		{
+			name:       "concurrency",
+			existing:   []*BatchUser{{Id: 5}, {Id: 10}},
+			rows:       batchUsers(10),
+			opts:       BatchOptions{ChunkSize: 3, Concurrency: 4},
+			wantRes:    BatchResult{RowsAffected: 6, Chunks: 4},
+			wantChunks: []int{1, 3},
+			wantCnt:    8,
+		},
+		{
+			// 事务回滚, 只剩下原本的数据
+			name:       "in tx",
+			existing:   []*BatchUser{{Id: 5}},
+			rows:       batchUsers(10),
+			opts:       BatchOptions{ChunkSize: 3, InTx: true},
+			wantRes:    BatchResult{Chunks: 4},
+			wantChunks: []int{1},
+			wantCnt:    1,
+		},
+		{
+			// 在用户的事务里面执行, 失败之后由用户决定要不要回滚
+			name:       "tx",
+			existing:   []*BatchUser{{Id: 5}},
+			tx:         true,
+			rows:       batchUsers(10),
+			opts:       BatchOptions{ChunkSize: 3, Concurrency: 4},
+			wantRes:    BatchResult{RowsAffected: 3, Chunks: 4},
+			wantChunks: []int{1},
+			wantCnt:    4,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := prepareBatchDB(t, "batch_"+string(rune('a'+i)))
+			if len(tc.existing) > 0 {
+				_, err := NewInserter[BatchUser](db).Values(tc.existing...).Exec(ctx)
+				require.NoError(t, err)
+			}
+			var sess Session = db
+			var tx *Tx
+			if tc.tx {
+				var err error
+				tx, err = db.BeginTx(ctx, nil)
+				require.NoError(t, err)
+				sess = tx
+			}
+
+			res, err := BatchInsert[BatchUser](ctx, sess, tc.rows, tc.opts)
+			assert.Equal(t, tc.wantRes, res)
+			if tx != nil {
+				require.NoError(t, tx.Commit())
+			}
+			assert.Equal(t, tc.wantCnt, countBatchUsers(t, db))
+			if len(tc.wantChunks) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			var batchErr *BatchError
+			require.True(t, errors.As(err, &batchErr))
+			chunks := make([]int, 0, len(batchErr.Chunks))
+			for _, c := range batchErr.Chunks {
+				chunks = append(chunks, c.Index)
+				assert.Equal(t, c.Index*3, c.Start)
+			}
+			assert.Equal(t, tc.wantChunks, chunks)
+			assert.True(t, errors.Is(err, ErrDuplicateKey))
+		})
+	}
+}
+
+func TestBatchInsert_empty(t *testing.T) {
+	db, err := OpenDB(nil)
+	require.NoError(t, err)
+	_, err = BatchInsert[BatchUser](context.Background(), db, nil, BatchOptions{})
+	assert.Equal(t, errs.ErrInsertZeroRow, err)
+}
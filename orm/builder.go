@@ -0,0 +1,224 @@
+package orm
+
+import (
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/internal/valuer"
+	"geektime-go-study/orm/model"
+	"strings"
+)
+
+// builder 是 Selector, Inserter 等构造 SQL 的公共部分
+// 把拼接 SQL 和收集参数的逻辑放在一起, 避免各个 QueryBuilder 重复实现
+type builder struct {
+	sb   strings.Builder
+	args []any
+	m    *model.Model
+	// cipher 加密查询条件里面加密字段的值
+	cipher valuer.Cipher
+	// dialect 决定引号和 JSON 函数这些差异, 为 nil 的时候按照 MySQL 处理
+	dialect Dialect
+}
+
+// reset 重置 builder, 保证多次调用 Build 的结果一致
+func (b *builder) reset() {
+	b.sb.Reset()
+	b.args = nil
+}
+
+func (b *builder) getDialect() Dialect {
+	if b.dialect == nil {
+		return DialectMySQL
+	}
+	return b.dialect
+}
+
+func (b *builder) quote(name string) {
+	q := b.getDialect().quoter()
+	b.sb.WriteByte(q)
+	b.sb.WriteString(name)
+	b.sb.WriteByte(q)
+}
+
+func (b *builder) addArgs(args ...any) {
+	b.args = append(b.args, args...)
+}
+
+func (b *builder) buildExpression(e Expression) error {
+	switch exp := e.(type) {
+	case Predicate:
+		// WhereEntity 和 WhereMap 需要根据模型展开
+		if ex, ok := exp.right.(example); ok {
+			return b.buildExample(ex)
+		}
+		// 只有左边的 Predicate, 例如 JSONContains
+		if exp.op == "" && exp.right == nil {
+			return b.buildExpression(exp.left)
+		}
+		if c, ok := exp.left.(Column); ok && b.m != nil {
+			if _, fd, ok := b.m.FieldOf(c.name); ok && fd.Encrypt != model.EncryptNone {
+				return b.buildEncryptedPredicate(fd, exp)
+			}
+		}
+		_, lp := exp.left.(Predicate)
+		if lp {
+			b.sb.WriteByte('(')
+		}
+		if err := b.buildExpression(exp.left); err != nil {
+			return err
+		}
+		if lp {
+			b.sb.WriteByte(')')
+		}
+
+		b.sb.WriteByte(' ')
+		b.sb.WriteString(exp.op.String())
+		b.sb.WriteByte(' ')
+		_, rp := exp.right.(Predicate)
+		if rp {
+			b.sb.WriteByte('(')
+		}
+		if err := b.buildExpression(exp.right); err != nil {
+			return err
+		}
+		if rp {
+			b.sb.WriteByte(')')
+		}
+	case Column:
+		return b.buildColumn(exp)
+	case JSONExpr:
+		return b.getDialect().buildJSON(b, exp)
+	case value:
+		b.sb.WriteByte('?')
+		b.addArgs(exp.val)
+	case likeValue:
+		b.sb.WriteString("? ESCAPE '")
+		b.sb.WriteByte(likeEscape)
+		b.sb.WriteByte('\'')
+		b.addArgs(exp.pattern)
+	case values:
+		b.sb.WriteByte('(')
+		for i, val := range exp.vals {
+			if i > 0 {
+				b.sb.WriteByte(',')
+			}
+			b.sb.WriteByte('?')
+			b.addArgs(val)
+		}
+		b.sb.WriteByte(')')
+	case nil:
+		return nil
+	default:
+		return errs.NewErrUnsupportedExpressionType(exp)
+	}
+	return nil
+}
+
+// buildEncryptedPredicate 加密字段只能在确定性加密的模式下使用 EQ 和 IN
+// 查询的值用每一个密钥都加密一次, 这样密钥轮换之后旧数据也能查到, 这个时候 EQ 会变成 IN
+func (b *builder) buildEncryptedPredicate(fd *model.Field, p Predicate) error {
+	if fd.Encrypt != model.EncryptDeterministic || (p.op != opEQ && p.op != opIN) {
+		return errs.NewErrEncryptedPredicate(fd.FieldName)
+	}
+	var plains []any
+	switch r := p.right.(type) {
+	case value:
+		plains = []any{r.val}
+	case values:
+		plains = r.vals
+	default:
+		return errs.NewErrEncryptedPredicate(fd.FieldName)
+	}
+	args := make([]any, 0, len(plains))
+	for _, plain := range plains {
+		cts, err := valuer.EncryptLookup(b.cipher, fd, plain)
+		if err != nil {
+			return err
+		}
+		args = append(args, cts...)
+	}
+
+	if err := b.buildExpression(p.left); err != nil {
+		return err
+	}
+	if p.op == opEQ && len(args) == 1 {
+		b.sb.WriteString(" = ?")
+		b.addArgs(args[0])
+		return nil
+	}
+	b.sb.WriteString(" IN (")
+	for i, arg := range args {
+		if i > 0 {
+			b.sb.WriteByte(',')
+		}
+		b.sb.WriteByte('?')
+		b.addArgs(arg)
+	}
+	b.sb.WriteByte(')')
+	return nil
+}
+
+func (b *builder) buildColumn(c Column) error {
+	// 没有元数据, 例如 DynamicSelector, 直接把名字当做列名
+	if b.m == nil {
+		b.quote(c.name)
+		return nil
+	}
+	n, field, ok := b.m.FieldOf(c.name)
+	if !ok {
+		return errs.NewErrUnknownField(c.name)
+	}
+	// 嵌套的结构体的字段要加上表的别名
+	if n != nil {
+		b.quote(n.Alias)
+		b.sb.WriteByte('.')
+	}
+	b.quote(field.ColName)
+	return nil
+}
+
+func (b *builder) buildSelectable(c Selectable) error {
+	switch sel := c.(type) {
+	case Column:
+		if err := b.buildColumn(sel); err != nil {
+			return err
+		}
+		if b.m != nil {
+			if n, fd, _ := b.m.FieldOf(sel.name); n != nil {
+				b.buildNestedAlias(n, fd)
+			}
+		}
+		return nil
+	case Window:
+		return b.buildWindow(sel)
+	case JSONExpr:
+		return b.getDialect().buildJSON(b, sel)
+	case rawSelectable:
+		b.sb.WriteString(string(sel))
+		return nil
+	default:
+		return errs.NewErrUnsupportedSelectable(sel)
+	}
+}
+
+// buildPredicates 用 And 合并多个Predicate
+func (b *builder) buildPredicates(ps []Predicate) error {
+	p := ps[0]
+	for i := 1; i < len(ps); i++ {
+		p = p.And(ps[i])
+	}
+	return b.buildExpression(p)
+}
+
+func (b *builder) buildOrderBy(obs []OrderBy) error {
+	for i, ob := range obs {
+		if i > 0 {
+			b.sb.WriteByte(',')
+		}
+		if err := b.buildColumn(C(ob.col)); err != nil {
+			return err
+		}
+		b.sb.WriteByte(' ')
+		b.sb.WriteString(ob.order)
+	}
+	return nil
+}
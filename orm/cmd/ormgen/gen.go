@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed ormgen.tmpl
+var genTpl string
+
+// File 代表一个模型文件, 是模板的输入
+type File struct {
+	Package string
+	Models  []Model
+}
+
+// Model 代表一个结构体
+type Model struct {
+	Name   string
+	Fields []Field
+}
+
+// Field 代表结构体的一个字段
+// 列名在运行时从模型的元数据里面找, 所以这里不需要
+type Field struct {
+	Name    string
+	Pointer bool // 指针字段, 读取的时候需要处理 nil
+}
+
+// ValuerName 生成的 Valuer 的类型名, 例如 userValuer
+func (m Model) ValuerName() string {
+	return strings.ToLower(m.Name[:1]) + m.Name[1:] + "Valuer"
+}
+
+// parseFile 用 go/ast 解析模型文件, 文件中每一个结构体都被当做模型
+func parseFile(filename string, src any) (*File, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	res := &File{Package: f.Name.Name}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || ts.TypeParams != nil {
+				continue
+			}
+			m, err := parseModel(ts.Name.Name, st)
+			if err != nil {
+				return nil, err
+			}
+			res.Models = append(res.Models, m)
+		}
+	}
+	return res, nil
+}
+
+// parseModel 跳过的字段和 model.registry 保持一致
+func parseModel(name string, st *ast.StructType) (Model, error) {
+	res := Model{Name: name}
+	for _, fd := range st.Fields.List {
+		// 组合的字段在 model.registry 里面是嵌套的结构体, 同样不是列
+		if len(fd.Names) == 0 {
+			continue
+		}
+		tags, err := parseTag(fd.Tag)
+		if err != nil {
+			return Model{}, err
+		}
+		// 关联字段和声明了 alias 的嵌套结构体都不是列
+		if tags.isRelation || tags.isNested {
+			continue
+		}
+		_, ptr := fd.Type.(*ast.StarExpr)
+		for _, n := range fd.Names {
+			res.Fields = append(res.Fields, Field{Name: n.Name, Pointer: ptr})
+		}
+	}
+	return res, nil
+}
+
+type ormTag struct {
+	isRelation bool
+	isNested   bool
+}
+
+func parseTag(lit *ast.BasicLit) (ormTag, error) {
+	var res ormTag
+	if lit == nil {
+		return res, nil
+	}
+	tag, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return res, err
+	}
+	for _, pair := range strings.Split(reflect.StructTag(tag).Get("orm"), ",") {
+		key, _, _ := strings.Cut(pair, "=")
+		switch key {
+		case "has_one", "has_many", "belongs_to":
+			res.isRelation = true
+		case "alias":
+			res.isNested = true
+		}
+	}
+	return res, nil
+}
+
+// gen 生成代码并格式化
+func gen(w io.Writer, f *File) error {
+	tpl, err := template.New("ormgen").Parse(genTpl)
+	if err != nil {
+		return err
+	}
+	bs := &bytes.Buffer{}
+	if err = tpl.Execute(bs, f); err != nil {
+		return err
+	}
+	res, err := format.Source(bs.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(res)
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+// TestGen 同时保证 testmodel 里面的生成代码是最新的
+func TestGen(t *testing.T) {
+	f, err := parseFile("../../internal/testmodel/user.go", nil)
+	require.NoError(t, err)
+	bs := &bytes.Buffer{}
+	require.NoError(t, gen(bs, f))
+
+	want, err := os.ReadFile("../../internal/testmodel/user.gen.go")
+	require.NoError(t, err)
+	assert.Equal(t, string(want), bs.String())
+}
+
+func TestParseFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		wantFile *File
+		wantErr  bool
+	}{
+		{
+			name: "column tag and relation",
+			src: `
+package model
+
+type Order struct {
+	Id, BuyerId int64
+	Name *string ` + "`orm:\"column=order_name\"`" + `
+	Items []*Item ` + "`orm:\"has_many,foreign_key=OrderId\"`" + `
+}
+
+type OrderWithBuyer struct {
+	Order ` + "`orm:\"alias=o\"`" + `
+	Buyer *User ` + "`orm:\"alias=u\"`" + `
+	Remark string
+}
+
+type List[T any] struct {
+	Items []T
+}
+
+type Status int
+`,
+			wantFile: &File{
+				Package: "model",
+				Models: []Model{
+					{
+						Name: "Order",
+						Fields: []Field{
+							{Name: "Id"},
+							{Name: "BuyerId"},
+							{Name: "Name", Pointer: true},
+						},
+					},
+					{
+						Name:   "OrderWithBuyer",
+						Fields: []Field{{Name: "Remark"}},
+					},
+				},
+			},
+		},
+		{
+			name:    "invalid source",
+			src:     "package model\n type User struct {",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := parseFile("model.go", tc.src)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantFile, f)
+		})
+	}
+}
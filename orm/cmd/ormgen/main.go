@@ -0,0 +1,43 @@
+// ormgen 根据模型文件生成类型安全的列和不依赖反射的 Valuer
+//
+// 用法: ormgen -src user.go
+// 默认输出到同目录的 user.gen.go, 可以通过 -dst 指定
+// 一般配合 go:generate 使用:
+//
+//	//go:generate go run geektime-go-study/orm/cmd/ormgen -src user.go
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	src := flag.String("src", "", "模型文件")
+	dst := flag.String("dst", "", "输出文件, 默认是 xxx.gen.go")
+	flag.Parse()
+	if *src == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *dst == "" {
+		*dst = strings.TrimSuffix(*src, ".go") + ".gen.go"
+	}
+
+	f, err := parseFile(*src, nil)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	out, err := os.Create(*dst)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+	if err = gen(out, f); err != nil {
+		log.Fatalln(err)
+	}
+}
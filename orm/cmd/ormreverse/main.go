@@ -0,0 +1,78 @@
+// ormreverse 根据已有的数据库表结构生成模型
+//
+// 用法: ormreverse -driver sqlite3 -dsn file:test.db -pkg model -dst model.go
+// 默认输出到标准输出, 可以通过 -tables 只生成部分表
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	driver := flag.String("driver", "sqlite3", "驱动, 支持 sqlite3 和 mysql")
+	dsn := flag.String("dsn", "", "数据源")
+	pkg := flag.String("pkg", "model", "生成代码的包名")
+	dst := flag.String("dst", "", "输出文件, 默认是标准输出")
+	tables := flag.String("tables", "", "只生成这些表, 用逗号分隔, 默认是全部表")
+	flag.Parse()
+	if *dsn == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	reader, err := readerOf(*driver)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db, err := sql.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	ts, err := reader.tables(context.Background(), db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *tables != "" {
+		ts = filterTables(ts, strings.Split(*tables, ","))
+	}
+
+	var out io.Writer = os.Stdout
+	if *dst != "" {
+		f, err := os.Create(*dst)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		out = f
+	}
+	if err = gen(out, newFile(*pkg, ts)); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func filterTables(ts []Table, names []string) []Table {
+	want := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		want[strings.TrimSpace(n)] = struct{}{}
+	}
+	res := make([]Table, 0, len(names))
+	for _, t := range ts {
+		if _, ok := want[t.Name]; ok {
+			res = append(res, t)
+		}
+	}
+	return res
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"geektime-go-study/orm/internal/util"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+//go:embed ormreverse.tmpl
+var reverseTpl string
+
+// File 生成的文件, 是模板的输入
+type File struct {
+	Package string
+	Imports []string
+	Models  []Model
+}
+
+// Model 一张表对应的结构体
+type Model struct {
+	Name      string
+	TableName string
+	// NeedTableName 按照结构体名推导出来的表名和真实的表名不一致, 需要生成 TableName 方法
+	NeedTableName bool
+	// Comment 没办法用标签表达的信息, 例如联合主键
+	Comment string
+	Fields  []Field
+}
+
+// Field 一列对应的字段
+type Field struct {
+	Name string
+	Type string
+	// Tag orm 标签的内容, 例如 column=UserID,primary_key
+	Tag string
+}
+
+// nullTypes 可以为 NULL 的列使用的类型, 没有对应 sql.NullXXX 的类型使用指针
+var nullTypes = map[string]string{
+	"string":    "sql.NullString",
+	"int64":     "sql.NullInt64",
+	"int32":     "sql.NullInt32",
+	"int16":     "sql.NullInt16",
+	"bool":      "sql.NullBool",
+	"float64":   "sql.NullFloat64",
+	"time.Time": "sql.NullTime",
+	"[]byte":    "[]byte",
+}
+
+// dbTypes 数据库类型到 Go 类型, 没有列出来的类型见 goType
+var dbTypes = map[string]string{
+	"tinyint":    "int8",
+	"smallint":   "int16",
+	"mediumint":  "int32",
+	"int":        "int32",
+	"integer":    "int64",
+	"bigint":     "int64",
+	"bool":       "bool",
+	"boolean":    "bool",
+	"float":      "float32",
+	"double":     "float64",
+	"real":       "float64",
+	"decimal":    "string",
+	"numeric":    "string",
+	"char":       "string",
+	"varchar":    "string",
+	"tinytext":   "string",
+	"text":       "string",
+	"mediumtext": "string",
+	"longtext":   "string",
+	"json":       "string",
+	"enum":       "string",
+	"set":        "string",
+	"binary":     "[]byte",
+	"varbinary":  "[]byte",
+	"tinyblob":   "[]byte",
+	"blob":       "[]byte",
+	"mediumblob": "[]byte",
+	"longblob":   "[]byte",
+	"date":       "time.Time",
+	"datetime":   "time.Time",
+	"timestamp":  "time.Time",
+	"time":       "string",
+	"year":       "int16",
+}
+
+// goType 列对应的 Go 类型
+// 不认识的类型按照 SQLite 的类型亲和性推导, 参考 https://www.sqlite.org/datatype3.html
+func goType(c Column) string {
+	typ, ok := dbTypes[c.Type]
+	if !ok {
+		switch {
+		case strings.Contains(c.Type, "int"):
+			typ = "int64"
+		case strings.Contains(c.Type, "char"), strings.Contains(c.Type, "clob"), strings.Contains(c.Type, "text"):
+			typ = "string"
+		case c.Type == "", strings.Contains(c.Type, "blob"):
+			typ = "[]byte"
+		case strings.Contains(c.Type, "real"), strings.Contains(c.Type, "floa"), strings.Contains(c.Type, "doub"):
+			typ = "float64"
+		default:
+			typ = "string"
+		}
+	}
+	if c.Unsigned && strings.HasPrefix(typ, "int") {
+		typ = "u" + typ
+	}
+	if !c.Nullable {
+		return typ
+	}
+	if nt, ok := nullTypes[typ]; ok {
+		return nt
+	}
+	return "*" + typ
+}
+
+// goName 下划线转驼峰, 例如 user_id 转为 UserId
+// 不能出现在标识符里面的字符当做分隔符
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sb := strings.Builder{}
+	for _, p := range parts {
+		rs := []rune(p)
+		rs[0] = unicode.ToUpper(rs[0])
+		sb.WriteString(string(rs))
+	}
+	res := sb.String()
+	if res == "" {
+		return "Col"
+	}
+	if unicode.IsDigit([]rune(res)[0]) {
+		return "C" + res
+	}
+	return res
+}
+
+// uniqueName 重名的时候加上数字后缀, 例如 UserId2
+func uniqueName(seen map[string]bool, name string) string {
+	res := name
+	for i := 2; seen[res]; i++ {
+		res = name + strconv.Itoa(i)
+	}
+	seen[res] = true
+	return res
+}
+
+// newModel 把表转为结构体, name 是结构体名
+// 只有 util.CamelToUnderline 推导不出来真实名字的时候, 才生成 column 标签和 TableName 方法
+func newModel(t Table, name string) Model {
+	res := Model{Name: name, TableName: t.Name}
+	res.NeedTableName = util.CamelToUnderline(res.Name) != t.Name
+
+	var pks []string
+	for _, c := range t.Columns {
+		if c.PrimaryKey {
+			pks = append(pks, c.Name)
+		}
+	}
+	if len(pks) > 1 {
+		res.Comment = "联合主键 (" + strings.Join(pks, ", ") + "), orm 只支持单列主键, 所以没有生成 primary_key 标签"
+		// 没有 primary_key 标签的时候 orm 会把 Id 当做主键, 要明确提醒
+		for _, c := range t.Columns {
+			if goName(c.Name) == "Id" {
+				res.Comment += "\n// 注意: orm 会按照约定把 Id 当做主键, 但是 Id 不是完整的主键, 不要用 UnitOfWork 跟踪这个模型"
+				break
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(t.Columns)+1)
+	// 字段和 TableName 方法不能同名, 例如 table_name 列
+	if res.NeedTableName {
+		seen["TableName"] = true
+	}
+	for _, c := range t.Columns {
+		// 不同的列转出来同样的字段名, 例如 user_id 和 UserId
+		name := uniqueName(seen, goName(c.Name))
+		var tags []string
+		if util.CamelToUnderline(name) != c.Name {
+			tags = append(tags, "column="+c.Name)
+		}
+		// 没有声明主键的时候, orm 约定 Id 是主键
+		if c.PrimaryKey && len(pks) == 1 && name != "Id" {
+			tags = append(tags, "primary_key")
+		}
+		res.Fields = append(res.Fields, Field{
+			Name: name,
+			Type: goType(c),
+			Tag:  strings.Join(tags, ","),
+		})
+	}
+	return res
+}
+
+func newFile(pkg string, tables []Table) *File {
+	res := &File{Package: pkg}
+	imports := map[string]struct{}{}
+	names := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		// 不同的表转出来同样的结构体名, 例如 user_order 和 UserOrder
+		m := newModel(t, uniqueName(names, goName(t.Name)))
+		for _, fd := range m.Fields {
+			if strings.Contains(fd.Type, "sql.") {
+				imports["database/sql"] = struct{}{}
+			}
+			if strings.Contains(fd.Type, "time.") {
+				imports["time"] = struct{}{}
+			}
+		}
+		res.Models = append(res.Models, m)
+	}
+	for imp := range imports {
+		res.Imports = append(res.Imports, imp)
+	}
+	sort.Strings(res.Imports)
+	return res
+}
+
+// gen 生成代码并格式化
+func gen(w io.Writer, f *File) error {
+	tpl, err := template.New("ormreverse").Parse(reverseTpl)
+	if err != nil {
+		return err
+	}
+	bs := &bytes.Buffer{}
+	if err = tpl.Execute(bs, f); err != nil {
+		return err
+	}
+	res, err := format.Source(bs.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(res)
+	return err
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestReverse_sqlite3(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:reverse.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	for _, stmt := range []string{
+		`CREATE TABLE user(
+    id INTEGER PRIMARY KEY,
+    first_name VARCHAR(64) NOT NULL,
+    nickname TEXT,
+    age TINYINT,
+    score DOUBLE NOT NULL,
+    avatar BLOB,
+    created_at DATETIME
+)`,
+		// 主键不是 Id, 列名和表名推导不出来
+		`CREATE TABLE LegacyOrder(
+    OrderNo VARCHAR(32) PRIMARY KEY,
+    buyer_id BIGINT NOT NULL,
+    amount DECIMAL(10, 2),
+    "2fa" BOOLEAN NOT NULL,
+    paid_at DATETIME NOT NULL
+)`,
+		`CREATE TABLE order_item(
+    order_no VARCHAR(32),
+    sku_id INTEGER,
+    PRIMARY KEY (order_no, sku_id)
+)`,
+		// 联合主键里面有 id
+		`CREATE TABLE tag_map(
+    id INTEGER NOT NULL,
+    tag VARCHAR(16) NOT NULL,
+    PRIMARY KEY (id, tag)
+)`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	tables, err := sqlite3Reader{}.tables(context.Background(), db)
+	require.NoError(t, err)
+	bs := &bytes.Buffer{}
+	require.NoError(t, gen(bs, newFile("model", tables)))
+	assert.Equal(t, "// Code generated by ormreverse from the database schema.\n"+
+		"// 生成之后可以按需修改, 例如加上关联关系\n"+
+		`
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+type LegacyOrder struct {
+	OrderNo string `+"`"+`orm:"column=OrderNo,primary_key"`+"`"+`
+	BuyerId int64
+	Amount  sql.NullString
+	C2fa    bool `+"`"+`orm:"column=2fa"`+"`"+`
+	PaidAt  time.Time
+}
+
+func (LegacyOrder) TableName() string {
+	return "LegacyOrder"
+}
+
+// OrderItem 联合主键 (order_no, sku_id), orm 只支持单列主键, 所以没有生成 primary_key 标签
+type OrderItem struct {
+	OrderNo string
+	SkuId   int64
+}
+
+// TagMap 联合主键 (id, tag), orm 只支持单列主键, 所以没有生成 primary_key 标签
+// 注意: orm 会按照约定把 Id 当做主键, 但是 Id 不是完整的主键, 不要用 UnitOfWork 跟踪这个模型
+type TagMap struct {
+	Id  int64
+	Tag string
+}
+
+type User struct {
+	Id        int64
+	FirstName string
+	Nickname  sql.NullString
+	Age       *int8
+	Score     float64
+	Avatar    []byte
+	CreatedAt sql.NullTime
+}
+`, bs.String())
+}
+
+func TestGoType(t *testing.T) {
+	testCases := []struct {
+		name string
+		col  Column
+		want string
+	}{
+		{
+			name: "unsigned",
+			col:  Column{Type: "int", Unsigned: true},
+			want: "uint32",
+		},
+		{
+			name: "nullable unsigned",
+			col:  Column{Type: "bigint", Unsigned: true, Nullable: true},
+			want: "*uint64",
+		},
+		{
+			name: "nullable int",
+			col:  Column{Type: "int", Nullable: true},
+			want: "sql.NullInt32",
+		},
+		{
+			name: "nullable time",
+			col:  Column{Type: "timestamp", Nullable: true},
+			want: "sql.NullTime",
+		},
+		{
+			// SQLite 的类型亲和性
+			name: "affinity int",
+			col:  Column{Type: "unsigned big int"},
+			want: "int64",
+		},
+		{
+			name: "affinity text",
+			col:  Column{Type: "nvarchar"},
+			want: "string",
+		},
+		{
+			name: "no type",
+			col:  Column{},
+			want: "[]byte",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, goType(tc.col))
+		})
+	}
+}
+
+func TestBaseType(t *testing.T) {
+	typ, unsigned := baseType("INT(11) UNSIGNED")
+	assert.Equal(t, "int", typ)
+	assert.True(t, unsigned)
+	typ, unsigned = baseType("varchar(255)")
+	assert.Equal(t, "varchar", typ)
+	assert.False(t, unsigned)
+}
+
+func TestNewFile_nameConflict(t *testing.T) {
+	testCases := []struct {
+		name       string
+		tables     []Table
+		wantModels []Model
+	}{
+		{
+			// 生成了 TableName 方法, table_name 列就不能叫 TableName
+			name: "table name column",
+			tables: []Table{
+				{Name: "Tags", Columns: []Column{{Name: "id", Type: "integer", PrimaryKey: true}, {Name: "table_name", Type: "text"}}},
+				{Name: "tags", Columns: []Column{{Name: "table_name", Type: "text"}}},
+			},
+			wantModels: []Model{
+				{Name: "Tags", TableName: "Tags", NeedTableName: true, Fields: []Field{
+					{Name: "Id", Type: "int64"},
+					{Name: "TableName2", Type: "string", Tag: "column=table_name"},
+				}},
+				{Name: "Tags2", TableName: "tags", NeedTableName: true, Fields: []Field{
+					{Name: "TableName2", Type: "string", Tag: "column=table_name"},
+				}},
+			},
+		},
+		{
+			// 表名推导得出来的时候没有 TableName 方法, 不需要改名
+			name: "no table name method",
+			tables: []Table{
+				{Name: "tag", Columns: []Column{{Name: "table_name", Type: "text"}}},
+			},
+			wantModels: []Model{
+				{Name: "Tag", TableName: "tag", Fields: []Field{
+					{Name: "TableName", Type: "string"},
+				}},
+			},
+		},
+		{
+			name: "struct name",
+			tables: []Table{
+				{Name: "UserOrder", Columns: []Column{{Name: "id", Type: "integer"}}},
+				{Name: "user_order", Columns: []Column{{Name: "id", Type: "integer"}}},
+				{Name: "user_order2", Columns: []Column{{Name: "id", Type: "integer"}}},
+			},
+			wantModels: []Model{
+				{Name: "UserOrder", TableName: "UserOrder", NeedTableName: true, Fields: []Field{{Name: "Id", Type: "int64"}}},
+				{Name: "UserOrder2", TableName: "user_order", NeedTableName: true, Fields: []Field{{Name: "Id", Type: "int64"}}},
+				{Name: "UserOrder22", TableName: "user_order2", NeedTableName: true, Fields: []Field{{Name: "Id", Type: "int64"}}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFile("model", tc.tables)
+			assert.Equal(t, tc.wantModels, f.Models)
+			// 生成的代码必须可以通过 go/format, 也就是语法正确
+			require.NoError(t, gen(&bytes.Buffer{}, f))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Table 数据库里面的一张表
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+// Column 表的一列
+type Column struct {
+	Name string
+	// Type 去掉长度和精度之后的类型, 小写, 例如 varchar, bigint
+	Type       string
+	Unsigned   bool
+	Nullable   bool
+	PrimaryKey bool
+}
+
+// schemaReader 读取表结构, 不同的数据库读取的方式不一样
+type schemaReader interface {
+	tables(ctx context.Context, db *sql.DB) ([]Table, error)
+}
+
+func readerOf(driver string) (schemaReader, error) {
+	switch driver {
+	case "sqlite3":
+		return sqlite3Reader{}, nil
+	case "mysql":
+		return mysqlReader{}, nil
+	default:
+		return nil, fmt.Errorf("ormreverse: 不支持的驱动 %s", driver)
+	}
+}
+
+type sqlite3Reader struct{}
+
+func (sqlite3Reader) tables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make([]Table, 0, len(names))
+	for _, name := range names {
+		t, err := sqlite3Table(ctx, db, name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// sqlite3Table 通过 PRAGMA table_info 读取列
+// 返回的列是 cid, name, type, notnull, dflt_value, pk
+func sqlite3Table(ctx context.Context, db *sql.DB, name string) (Table, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info(`"+name+"`)")
+	if err != nil {
+		return Table{}, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	res := Table{Name: name}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			colName, typ     string
+			dflt             sql.NullString
+		)
+		if err = rows.Scan(&cid, &colName, &typ, &notNull, &dflt, &pk); err != nil {
+			return Table{}, err
+		}
+		typ, unsigned := baseType(typ)
+		res.Columns = append(res.Columns, Column{
+			Name:     colName,
+			Type:     typ,
+			Unsigned: unsigned,
+			// SQLite 的主键可以是 NULL, 但是 INTEGER PRIMARY KEY 不可能是 NULL
+			// 所以主键一律当做 NOT NULL
+			Nullable:   notNull == 0 && pk == 0,
+			PrimaryKey: pk > 0,
+		})
+	}
+	return res, rows.Err()
+}
+
+type mysqlReader struct{}
+
+// tables 读取 DSN 里面指定的数据库的所有表
+func (mysqlReader) tables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	rows, err := db.QueryContext(ctx, `SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY
+FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE()
+ORDER BY TABLE_NAME, ORDINAL_POSITION`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var res []Table
+	for rows.Next() {
+		var tbl, colName, typ, nullable, key string
+		if err = rows.Scan(&tbl, &colName, &typ, &nullable, &key); err != nil {
+			return nil, err
+		}
+		if len(res) == 0 || res[len(res)-1].Name != tbl {
+			res = append(res, Table{Name: tbl})
+		}
+		typ, unsigned := baseType(typ)
+		t := &res[len(res)-1]
+		t.Columns = append(t.Columns, Column{
+			Name:       colName,
+			Type:       typ,
+			Unsigned:   unsigned,
+			Nullable:   nullable == "YES",
+			PrimaryKey: key == "PRI",
+		})
+	}
+	return res, rows.Err()
+}
+
+// baseType 去掉长度, 精度这些修饰, 例如 INT(11) UNSIGNED 返回 int 和 true
+func baseType(typ string) (string, bool) {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	unsigned := strings.Contains(typ, "unsigned")
+	if idx := strings.IndexAny(typ, "( "); idx >= 0 {
+		typ = typ[:idx]
+	}
+	return typ, unsigned
+}
@@ -12,6 +12,13 @@ func valueOf(val any) value {
 	}
 }
 
+// values 代表 IN 右边的一组值, 渲染为 (?,?,?)
+type values struct {
+	vals []any
+}
+
+func (values) expr() {}
+
 // Column 代表 某个列名
 type Column struct {
 	name string
@@ -51,3 +58,22 @@ func (c Column) GT(arg any) Predicate {
 		right: exprOf(arg),
 	}
 }
+
+// Like 例如 C("name").Like("%Tom%")
+func (c Column) Like(pattern string) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opLIKE,
+		right: valueOf(pattern),
+	}
+}
+
+// In 例如 C("id").In(1, 2, 3)
+// 注意 vals 不能为空, 否则会生成非法的 SQL
+func (c Column) In(vals ...any) Predicate {
+	return Predicate{
+		left:  c,
+		op:    opIN,
+		right: values{vals: vals},
+	}
+}
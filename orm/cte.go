@@ -0,0 +1,66 @@
+package orm
+
+import "strings"
+
+// cte 公共表表达式, 即 WITH name AS (...)
+type cte struct {
+	name      string
+	q         QueryBuilder
+	recursive bool
+}
+
+// With 声明一个 CTE, 在主查询里面通过 From(name) 使用, 例如
+//
+//	recent := NewSelector[Order](db).Where(C("CreateTime").GT(t))
+//	NewSelector[Order](db).With("recent", recent).From("recent")
+//
+// 生成 WITH `recent` AS (SELECT ...) SELECT * FROM recent
+// 主查询仍然按照 T 的元数据来解析字段, 所以 CTE 返回的列要和 T 对得上
+func (s *Selector[T]) With(name string, q QueryBuilder) *Selector[T] {
+	s.ctes = append(s.ctes, cte{name: name, q: q})
+	return s
+}
+
+// WithRecursive 声明一个递归的 CTE, q 一般是 UNION ALL 的形式
+// 只要有一个 CTE 是递归的, 就会生成 WITH RECURSIVE
+func (s *Selector[T]) WithRecursive(name string, q QueryBuilder) *Selector[T] {
+	s.ctes = append(s.ctes, cte{name: name, q: q, recursive: true})
+	return s
+}
+
+// tenantInheritor 作为子查询的 Selector 沿用外层查询的租户
+type tenantInheritor interface {
+	inherit(parent tenantScope)
+}
+
+func (s *Selector[T]) buildWith() error {
+	if len(s.ctes) == 0 {
+		return nil
+	}
+	s.sb.WriteString("WITH ")
+	for _, c := range s.ctes {
+		if c.recursive {
+			s.sb.WriteString("RECURSIVE ")
+			break
+		}
+	}
+	for i, c := range s.ctes {
+		if i > 0 {
+			s.sb.WriteByte(',')
+		}
+		if ti, ok := c.q.(tenantInheritor); ok {
+			ti.inherit(s.tenantScope)
+		}
+		query, err := c.q.Build()
+		if err != nil {
+			return err
+		}
+		s.quote(c.name)
+		s.sb.WriteString(" AS (")
+		s.sb.WriteString(strings.TrimSuffix(query.SQL, ";"))
+		s.sb.WriteByte(')')
+		s.addArgs(query.Args...)
+	}
+	s.sb.WriteByte(' ')
+	return nil
+}
@@ -0,0 +1,110 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// rawQuery 直接返回写好的 SQL, 用来构造 Selector 还表达不了的 CTE
+type rawQuery Query
+
+func (r rawQuery) Build() (*Query, error) {
+	q := Query(r)
+	return &q, nil
+}
+
+func TestSelector_With(t *testing.T) {
+	db := memoryDB(t)
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "with",
+			q: NewSelector[WindowOrder](db).
+				With("big", NewSelector[WindowOrder](db).Where(C("Amount").GT(100))).
+				From("big").Where(C("UserId").EQ(1)),
+			wantQuery: &Query{
+				SQL:  "WITH `big` AS (SELECT * FROM `window_order` WHERE `amount` > ?) SELECT * FROM big WHERE `user_id` = ?;",
+				Args: []any{100, 1},
+			},
+		},
+		{
+			name: "multiple",
+			q: NewSelector[WindowOrder](db).
+				With("a", NewSelector[WindowOrder](db).Where(C("Id").GT(1))).
+				With("b", NewSelector[WindowOrder](db).From("a").Where(C("Id").LT(9))).
+				From("b"),
+			wantQuery: &Query{
+				SQL:  "WITH `a` AS (SELECT * FROM `window_order` WHERE `id` > ?),`b` AS (SELECT * FROM a WHERE `id` < ?) SELECT * FROM b;",
+				Args: []any{1, 9},
+			},
+		},
+		{
+			name: "recursive",
+			q: NewSelector[WindowOrder](db).
+				With("a", NewSelector[WindowOrder](db)).
+				WithRecursive("b", rawQuery{SQL: "SELECT * FROM a"}).
+				From("b"),
+			wantQuery: &Query{
+				SQL: "WITH RECURSIVE `a` AS (SELECT * FROM `window_order`),`b` AS (SELECT * FROM a) SELECT * FROM b;",
+			},
+		},
+		{
+			name: "invalid cte",
+			q: NewSelector[WindowOrder](db).
+				With("a", NewSelector[WindowOrder](db).Where(C("Invalid").EQ(1))),
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestSelector_With_sqlite(t *testing.T) {
+	db, err := Open("sqlite3", "file:cte.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE window_order(id INTEGER PRIMARY KEY, user_id INTEGER, amount INTEGER)",
+		"INSERT INTO window_order VALUES (1, 1, 10), (2, 1, 30), (3, 2, 20), (4, 2, 50), (5, 2, 40)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+
+	// 每个用户金额最大的订单
+	ranked := NewSelector[WindowOrder](db).Select(C("Id"), C("UserId"), C("Amount"),
+		RowNumber().Over(PartitionBy("UserId"), Desc("Amount")).As("rn"))
+	res, err := NewSelector[WindowOrder](db).With("ranked", ranked).From("ranked").
+		Where(C("Rn").EQ(1)).OrderBy(Asc("UserId")).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*WindowOrder{
+		{Id: 2, UserId: 1, Amount: 30, Rn: 1},
+		{Id: 4, UserId: 2, Amount: 50, Rn: 1},
+	}, res)
+
+	// 生成 1 到 3 的序列
+	seq := rawQuery{
+		SQL:  "SELECT ? AS id UNION ALL SELECT id + 1 FROM seq WHERE id < ?",
+		Args: []any{1, 3},
+	}
+	res, err = NewSelector[WindowOrder](db).WithRecursive("seq", seq).
+		From("seq").Select(C("Id")).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*WindowOrder{{Id: 1}, {Id: 2}, {Id: 3}}, res)
+}
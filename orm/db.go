@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"geektime-go-study/orm/internal/valuer"
 	"geektime-go-study/orm/model"
@@ -10,13 +11,28 @@ type DB struct {
 	r          model.Registry // 元数据注册中心
 	db         *sql.DB
 	valCreator valuer.Creator // 负责创建结构体的抽象(反射 or unsafe 实现, 默认unsafe实现)
+	// generatedValuer 优先使用 ormgen 生成的 Valuer, 默认开启
+	generatedValuer bool
+	dialect         Dialect
+	fullScan        *fullScanCheck // 全表扫描检测, 为 nil 则不检测
+	auditSink       AuditSink      // 审计, 为 nil 则不记录
+	stmtHooks       []StatementHook
+	cipher          valuer.Cipher // 加密字段, 为 nil 则不能读写加密字段
 }
 
 type DBOption func(*DB)
 
+// DBWithReflectValuer 使用反射实现, 同时不再使用 ormgen 生成的 Valuer
 func DBWithReflectValuer() DBOption {
 	return func(db *DB) {
 		db.valCreator = valuer.NewReflectValue
+		db.generatedValuer = false
+	}
+}
+
+func DBWithDialect(d Dialect) DBOption {
+	return func(db *DB) {
+		db.dialect = d
 	}
 }
 
@@ -26,20 +42,35 @@ func DBWithRegistry(r model.Registry) DBOption {
 	}
 }
 
+// StatementHook 每条语句执行之前调用, 用于记录日志, 测试里面断言执行过的语句这些场景
+// query 不能修改
+type StatementHook func(ctx context.Context, query *Query)
+
+// DBWithStatementHook 可以多次使用, 按照顺序调用
+func DBWithStatementHook(hook StatementHook) DBOption {
+	return func(db *DB) {
+		db.stmtHooks = append(db.stmtHooks, hook)
+	}
+}
+
 func Open(driver string, dsn string, opts ...DBOption) (*DB, error) {
 	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
 
+	// 根据驱动名选择默认的方言, 用户传入的 DBWithDialect 会覆盖它
+	opts = append([]DBOption{DBWithDialect(dialectOf(driver))}, opts...)
 	return OpenDB(db, opts...)
 }
 
 func OpenDB(db *sql.DB, opts ...DBOption) (*DB, error) {
 	ret := &DB{
-		r:          model.NewRegistry(),
-		db:         db,
-		valCreator: valuer.NewUnsafeValue,
+		r:               model.NewRegistry(),
+		db:              db,
+		valCreator:      valuer.NewUnsafeValue,
+		generatedValuer: true,
+		dialect:         DialectMySQL,
 	}
 
 	for _, opt := range opts {
@@ -59,6 +90,29 @@ func MustOpen(driver string, dsn string, opts ...DBOption) *DB {
 	return ret
 }
 
+var _ Session = &DB{}
+
+// Model 返回 val 的元数据, 主要给 ormtest 这种需要根据模型生成 SQL 的工具使用
+func (db *DB) Model(val any) (*model.Model, error) {
+	return db.r.Get(val)
+}
+
+func (db *DB) getDB() *DB {
+	return db
+}
+
+func (db *DB) conn() sqlConn {
+	return db.db
+}
+
+func (db *DB) queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return queryContext(ctx, db, db.db, query, args...)
+}
+
+func (db *DB) execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execContext(ctx, db, db.db, query, args...)
+}
+
 //// 按理说 NewSelector 之类的东西应该是定义在 DB 之上的
 //// 但是因为泛型的限制不能采用这种方法
 //func (d *DB) NewSelector[T any]() Selector[T] {
@@ -0,0 +1,186 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"strconv"
+	"strings"
+)
+
+// Dialect 方言, 屏蔽不同数据库之间的差异
+type Dialect interface {
+	// translateErr 把驱动返回的错误翻译为 orm 的 sentinel error
+	// 不认识的错误原样返回
+	translateErr(err error) error
+	// explain 返回 query 的执行计划
+	// aliases 是别名到表名的映射, 用来把执行计划里面的别名还原为表名, 可以为 nil
+	explain(ctx context.Context, db sqlConn, query *Query, aliases map[string]string) (Plan, error)
+	// buildLock 构造 FOR UPDATE 这种行锁的子句
+	buildLock(b *builder, lock lockClause) error
+	// maxPlaceholders 一条语句最多可以有多少个占位符
+	maxPlaceholders() int
+	// quoter 表名和列名使用的引号
+	quoter() byte
+	// rebind 把构造 SQL 的时候使用的 ? 转为数据库的占位符
+	// 在执行之前调用, 所以 Build 返回的 SQL 里面的占位符总是 ?
+	rebind(query string) string
+	// buildJSON 构造 JSON 列上的表达式
+	buildJSON(b *builder, e JSONExpr) error
+	// returningID 驱动不支持 LastInsertId, 需要通过 RETURNING 拿到自增主键
+	returningID() bool
+}
+
+var (
+	DialectMySQL      Dialect = mysqlDialect{}
+	DialectSQLite     Dialect = sqlite3Dialect{}
+	DialectPostgreSQL Dialect = postgresDialect{}
+)
+
+// dialectOf 根据驱动名找方言, 找不到就用 MySQL
+func dialectOf(driver string) Dialect {
+	switch driver {
+	case "sqlite3":
+		return DialectSQLite
+	case "postgres", "pgx":
+		return DialectPostgreSQL
+	default:
+		return DialectMySQL
+	}
+}
+
+type mysqlDialect struct{}
+
+// mysqlErrs key 是 MySQL 的错误码
+// 参考 https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+var mysqlErrs = map[uint16]error{
+	1062: errs.ErrDuplicateKey,        // ER_DUP_ENTRY
+	1586: errs.ErrDuplicateKey,        // ER_DUP_ENTRY_WITH_KEY_NAME
+	1216: errs.ErrForeignKeyViolation, // ER_NO_REFERENCED_ROW
+	1217: errs.ErrForeignKeyViolation, // ER_ROW_IS_REFERENCED
+	1451: errs.ErrForeignKeyViolation, // ER_ROW_IS_REFERENCED_2
+	1452: errs.ErrForeignKeyViolation, // ER_NO_REFERENCED_ROW_2
+	1213: errs.ErrDeadlock,            // ER_LOCK_DEADLOCK
+	1205: errs.ErrLockTimeout,         // ER_LOCK_WAIT_TIMEOUT
+	3572: errs.ErrLockTimeout,         // ER_LOCK_NOWAIT
+	3819: errs.ErrCheckViolation,      // ER_CHECK_CONSTRAINT_VIOLATED
+}
+
+func (mysqlDialect) quoter() byte {
+	return '`'
+}
+
+func (mysqlDialect) rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) returningID() bool {
+	return false
+}
+
+func (mysqlDialect) translateErr(err error) error {
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) {
+		return err
+	}
+	if sentinel, ok := mysqlErrs[me.Number]; ok {
+		return errs.NewDriverError(sentinel, err)
+	}
+	return err
+}
+
+type sqlite3Dialect struct{}
+
+// sqlite3ExtendedErrs 约束相关的错误要看扩展错误码才能区分
+// 参考 https://www.sqlite.org/rescode.html
+var sqlite3ExtendedErrs = map[sqlite3.ErrNoExtended]error{
+	sqlite3.ErrConstraintUnique:     errs.ErrDuplicateKey,
+	sqlite3.ErrConstraintPrimaryKey: errs.ErrDuplicateKey,
+	sqlite3.ErrConstraintForeignKey: errs.ErrForeignKeyViolation,
+	sqlite3.ErrConstraintCheck:      errs.ErrCheckViolation,
+}
+
+// sqlite3Errs SQLite 是库级别的锁, 没有死锁的说法, 拿不到锁都算作锁超时
+var sqlite3Errs = map[sqlite3.ErrNo]error{
+	sqlite3.ErrBusy:   errs.ErrLockTimeout,
+	sqlite3.ErrLocked: errs.ErrLockTimeout,
+}
+
+func (sqlite3Dialect) quoter() byte {
+	return '`'
+}
+
+func (sqlite3Dialect) rebind(query string) string {
+	return query
+}
+
+func (sqlite3Dialect) returningID() bool {
+	return false
+}
+
+func (sqlite3Dialect) translateErr(err error) error {
+	var se sqlite3.Error
+	if !errors.As(err, &se) {
+		return err
+	}
+	if sentinel, ok := sqlite3ExtendedErrs[se.ExtendedCode]; ok {
+		return errs.NewDriverError(sentinel, err)
+	}
+	if sentinel, ok := sqlite3Errs[se.Code]; ok {
+		return errs.NewDriverError(sentinel, err)
+	}
+	return err
+}
+
+// postgresDialect 目前只支持构造和执行语句, 以及 JSON 列上的查询
+// 错误翻译, 执行计划和行锁都不支持
+type postgresDialect struct{}
+
+func (postgresDialect) quoter() byte {
+	return '"'
+}
+
+// returningID lib/pq 和 pgx 都不支持 LastInsertId
+func (postgresDialect) returningID() bool {
+	return true
+}
+
+// rebind PostgreSQL 的占位符是 $1, $2
+// 字符串和带引号的标识符里面的 ? 不是占位符
+func (postgresDialect) rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var (
+		sb    strings.Builder
+		n     int
+		quote byte
+	)
+	sb.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			// 引号里面的引号是两个连在一起, 例如 'it''s', 退出再进入引号的结果是一样的
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// translateErr PostgreSQL 的错误暂时不做翻译, 原样返回
+func (postgresDialect) translateErr(err error) error {
+	return err
+}
@@ -0,0 +1,310 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDialect_translateErr(t *testing.T) {
+	testCases := []struct {
+		name    string
+		dialect Dialect
+		err     error
+		wantErr error
+	}{
+		{
+			name:    "mysql duplicate key",
+			dialect: DialectMySQL,
+			err:     &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"},
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			name:    "mysql foreign key",
+			dialect: DialectMySQL,
+			err:     &mysql.MySQLError{Number: 1452},
+			wantErr: ErrForeignKeyViolation,
+		},
+		{
+			name:    "mysql deadlock",
+			dialect: DialectMySQL,
+			err:     &mysql.MySQLError{Number: 1213},
+			wantErr: ErrDeadlock,
+		},
+		{
+			name:    "mysql lock timeout",
+			dialect: DialectMySQL,
+			err:     &mysql.MySQLError{Number: 1205},
+			wantErr: ErrLockTimeout,
+		},
+		{
+			name:    "mysql check",
+			dialect: DialectMySQL,
+			err:     &mysql.MySQLError{Number: 3819},
+			wantErr: ErrCheckViolation,
+		},
+		{
+			name:    "sqlite busy",
+			dialect: DialectSQLite,
+			err:     sqlite3.Error{Code: sqlite3.ErrBusy},
+			wantErr: ErrLockTimeout,
+		},
+		{
+			name:    "sqlite check",
+			dialect: DialectSQLite,
+			err: sqlite3.Error{Code: sqlite3.ErrConstraint,
+				ExtendedCode: sqlite3.ErrConstraintCheck},
+			wantErr: ErrCheckViolation,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.dialect.translateErr(tc.err)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			// 原始的错误还在
+			assert.True(t, errors.Is(err, tc.err))
+		})
+	}
+
+	// 不认识的错误原样返回
+	unknown := &mysql.MySQLError{Number: 1064}
+	assert.Same(t, unknown, DialectMySQL.translateErr(unknown))
+	assert.Equal(t, context.Canceled, DialectSQLite.translateErr(context.Canceled))
+	// 别的驱动的错误也原样返回
+	assert.Same(t, unknown, DialectSQLite.translateErr(unknown))
+	assert.Same(t, unknown, DialectPostgreSQL.translateErr(unknown))
+}
+
+func TestPostgres_rebind(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "no args",
+			query: "SELECT * FROM \"user\";",
+			want:  "SELECT * FROM \"user\";",
+		},
+		{
+			name:  "args",
+			query: "SELECT * FROM \"user\" WHERE \"age\" > ? AND \"id\" IN (?,?);",
+			want:  "SELECT * FROM \"user\" WHERE \"age\" > $1 AND \"id\" IN ($2,$3);",
+		},
+		{
+			// 引号里面的 ? 不是占位符
+			name:  "quoted",
+			query: "SELECT 'a?b', \"c?\" FROM \"user\" WHERE \"id\" = ?;",
+			want:  "SELECT 'a?b', \"c?\" FROM \"user\" WHERE \"id\" = $1;",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, DialectPostgreSQL.rebind(tc.query))
+		})
+	}
+}
+
+func TestDB_rebind_postgres(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectPostgreSQL))
+	require.NoError(t, err)
+
+	// 执行的时候才转换占位符
+	mock.ExpectQuery(`SELECT \* FROM "dialect_user" WHERE "id" = \$1;`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	res, err := NewSelector[DialectUser](db).Where(C("Id").EQ(1)).Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Id)
+}
+
+func TestDB_returning_postgres(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectPostgreSQL))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// 驱动不支持 LastInsertId, 通过 RETURNING 拿到主键
+	mock.ExpectQuery(`INSERT INTO "dialect_user"\("id","email","age","group_id"\) VALUES \(\$1,\$2,\$3,\$4\) RETURNING "id";`).
+		WithArgs(int64(0), "a@b.com", 18, int64(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	res, err := NewInserter[DialectUser](db).Values(&DialectUser{Email: "a@b.com", Age: 18}).Exec(ctx)
+	require.NoError(t, err)
+	id, err := res.LastInsertId()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), id)
+	affected, err := res.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	// 工作单元把自增主键写回实体
+	uow := NewSession(db)
+	u := &DialectUser{Email: "c@d.com"}
+	require.NoError(t, uow.Add(u))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "dialect_user"\("email","age","group_id"\) VALUES \(\$1,\$2,\$3\) RETURNING "id";`).
+		WithArgs("c@d.com", 0, int64(0)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+	require.NoError(t, uow.Commit(ctx))
+	assert.Equal(t, int64(7), u.Id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgres_unsupported(t *testing.T) {
+	db, err := OpenDB(nil, DBWithDialect(DialectPostgreSQL))
+	require.NoError(t, err)
+	_, err = NewSelector[DialectUser](db).Explain(context.Background())
+	assert.Equal(t, errs.NewErrUnsupportedExplain("PostgreSQL"), err)
+	assert.Equal(t, errs.NewErrUnsupportedLock("PostgreSQL"), DialectPostgreSQL.buildLock(&builder{}, lockClause{}))
+}
+
+type DialectUser struct {
+	Id      int64
+	Email   string
+	Age     int
+	GroupId int64
+}
+
+func TestDB_translateErr_sqlite(t *testing.T) {
+	db, err := Open("sqlite3", "file:translate_err.db?cache=shared&mode=memory&_foreign_keys=on")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE dialect_group(id INTEGER PRIMARY KEY)",
+		`CREATE TABLE dialect_user(
+    id INTEGER PRIMARY KEY,
+    email TEXT UNIQUE,
+    age INTEGER CHECK (age >= 0),
+    group_id INTEGER REFERENCES dialect_group(id)
+)`,
+		"INSERT INTO dialect_group VALUES (1)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+	_, err = NewInserter[DialectUser](db).Values(&DialectUser{Id: 1, Email: "a@b.c", GroupId: 1}).Exec(ctx)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		val     *DialectUser
+		wantErr error
+	}{
+		{
+			name:    "duplicate primary key",
+			val:     &DialectUser{Id: 1, Email: "b@b.c", GroupId: 1},
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			name:    "duplicate unique key",
+			val:     &DialectUser{Id: 2, Email: "a@b.c", GroupId: 1},
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			name:    "check",
+			val:     &DialectUser{Id: 2, Email: "b@b.c", Age: -1, GroupId: 1},
+			wantErr: ErrCheckViolation,
+		},
+		{
+			name:    "foreign key",
+			val:     &DialectUser{Id: 2, Email: "b@b.c", GroupId: 2},
+			wantErr: ErrForeignKeyViolation,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewInserter[DialectUser](db).Values(tc.val).Exec(ctx)
+			assert.True(t, errors.Is(err, tc.wantErr))
+			var se sqlite3.Error
+			assert.True(t, errors.As(err, &se))
+		})
+	}
+}
+
+func TestDB_translateErr_mysql(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectMySQL))
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT .*").WillReturnError(&mysql.MySQLError{Number: 1213})
+	_, err = NewSelector[DialectUser](db).Get(context.Background())
+	assert.True(t, errors.Is(err, ErrDeadlock))
+	var me *mysql.MySQLError
+	require.True(t, errors.As(err, &me))
+	assert.Equal(t, uint16(1213), me.Number)
+}
+
+// TestDB_translateErr_rows 遍历结果集的时候出错, 同样需要翻译
+func TestDB_translateErr_rows(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query func(db *DB) error
+	}{
+		{
+			name: "get",
+			query: func(db *DB) error {
+				_, err := NewSelector[DialectUser](db).Get(context.Background())
+				return err
+			},
+		},
+		{
+			name: "get multi",
+			query: func(db *DB) error {
+				_, err := NewSelector[DialectUser](db).GetMulti(context.Background())
+				return err
+			},
+		},
+		{
+			name: "pluck",
+			query: func(db *DB) error {
+				_, err := Pluck[DialectUser, int64](context.Background(), NewSelector[DialectUser](db), C("Id"))
+				return err
+			},
+		},
+		{
+			name: "count",
+			query: func(db *DB) error {
+				_, err := NewSelector[DialectUser](db).Count(context.Background())
+				return err
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func() {
+				_ = mockDB.Close()
+			}()
+			db, err := OpenDB(mockDB, DBWithDialect(DialectMySQL))
+			require.NoError(t, err)
+
+			rows := sqlmock.NewRows([]string{"id"}).AddRow(1).
+				RowError(0, &mysql.MySQLError{Number: 1213})
+			mock.ExpectQuery("SELECT .*").WillReturnRows(rows)
+			assert.True(t, errors.Is(tc.query(db), ErrDeadlock))
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"geektime-go-study/orm/model"
+	"reflect"
+	"strings"
+)
+
+// DynamicSelector 不需要结构体的查询, 用于管理后台, 数据导出这种没有对应模型的场景
+// 条件仍然使用 Predicate, 不同的是 C 里面传入的是列名而不是字段名
+//
+//	rows, err := NewDynamicSelector(db, "user").Select("id", "name").
+//		Where(C("age").GT(18)).GetMaps(ctx)
+//
+// 默认不校验列名, 调用 Introspect 之后会校验列名是否存在
+type DynamicSelector struct {
+	builder
+	db   *DB
+	sess Session
+
+	table   string
+	columns []string
+	where   []Predicate
+	orderBy []OrderBy
+	limit   int
+	offset  int
+
+	// schema 是 Introspect 查询到的表结构, 字段名就是列名
+	schema *model.Model
+}
+
+func NewDynamicSelector(sess Session, table string) *DynamicSelector {
+	return &DynamicSelector{
+		db:    sess.getDB(),
+		sess:  sess,
+		table: table,
+	}
+}
+
+// Select 指定列名, 不调用的话就是 SELECT *
+func (d *DynamicSelector) Select(cols ...string) *DynamicSelector {
+	d.columns = cols
+	return d
+}
+
+func (d *DynamicSelector) Where(ps ...Predicate) *DynamicSelector {
+	d.where = ps
+	return d
+}
+
+func (d *DynamicSelector) OrderBy(obs ...OrderBy) *DynamicSelector {
+	d.orderBy = obs
+	return d
+}
+
+func (d *DynamicSelector) Limit(limit int) *DynamicSelector {
+	d.limit = limit
+	return d
+}
+
+func (d *DynamicSelector) Offset(offset int) *DynamicSelector {
+	d.offset = offset
+	return d
+}
+
+// Introspect 查询表结构, 之后构造 SQL 的时候会校验列名
+// 通过 SELECT * FROM table LIMIT 0 拿到列的信息, 所以不依赖具体的数据库
+func (d *DynamicSelector) Introspect(ctx context.Context) ([]*sql.ColumnType, error) {
+	b := builder{dialect: d.db.dialect}
+	b.sb.WriteString("SELECT * FROM ")
+	b.quote(d.table)
+	b.sb.WriteString(" LIMIT 0;")
+	rows, err := d.sess.queryContext(ctx, b.sb.String())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model.Model{
+		TableName: d.table,
+		Fields:    make([]*model.Field, 0, len(cts)),
+		FieldMap:  make(map[string]*model.Field, len(cts)),
+		ColMap:    make(map[string]*model.Field, len(cts)),
+	}
+	for _, ct := range cts {
+		fd := &model.Field{
+			ColName:   ct.Name(),
+			FieldName: ct.Name(),
+			FieldType: ct.ScanType(),
+		}
+		m.Fields = append(m.Fields, fd)
+		m.FieldMap[fd.FieldName] = fd
+		m.ColMap[fd.ColName] = fd
+	}
+	d.schema = m
+	return cts, nil
+}
+
+func (d *DynamicSelector) Build() (*Query, error) {
+	d.reset()
+	d.dialect = d.db.dialect
+	// m 为 nil 的时候, buildColumn 直接把名字当做列名
+	d.m = d.schema
+	d.sb.WriteString("SELECT ")
+	if len(d.columns) == 0 {
+		d.sb.WriteByte('*')
+	} else {
+		for i, c := range d.columns {
+			if i > 0 {
+				d.sb.WriteByte(',')
+			}
+			if err := d.buildColumn(C(c)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	d.sb.WriteString(" FROM ")
+	d.quote(d.table)
+
+	if len(d.where) > 0 {
+		d.sb.WriteString(" WHERE ")
+		if err := d.buildPredicates(d.where); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.orderBy) > 0 {
+		d.sb.WriteString(" ORDER BY ")
+		if err := d.buildOrderBy(d.orderBy); err != nil {
+			return nil, err
+		}
+	}
+	if d.limit > 0 {
+		d.sb.WriteString(" LIMIT ?")
+		d.addArgs(d.limit)
+	}
+	if d.offset > 0 {
+		d.sb.WriteString(" OFFSET ?")
+		d.addArgs(d.offset)
+	}
+	d.sb.WriteByte(';')
+	return &Query{
+		SQL:  d.sb.String(),
+		Args: d.args,
+	}, nil
+}
+
+// GetMaps 每一行是一个 map, key 是列名
+func (d *DynamicSelector) GetMaps(ctx context.Context) ([]map[string]any, error) {
+	cols, vals, err := d.GetSlices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]map[string]any, 0, len(vals))
+	for _, row := range vals {
+		m := make(map[string]any, len(cols))
+		for i, c := range cols {
+			m[c] = row[i]
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// GetSlices 返回列名和每一行的值, 值的顺序和列名一致
+// 比 GetMaps 省内存, 也保留了列的顺序, 适合导出 CSV 这种场景
+// 值的类型根据 rows.ColumnTypes() 决定, NULL 是 nil
+func (d *DynamicSelector) GetSlices(ctx context.Context) ([]string, [][]any, error) {
+	query, err := d.Build()
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := d.sess.queryContext(ctx, query.SQL, query.Args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	cols := make([]string, 0, len(cts))
+	for _, ct := range cts {
+		cols = append(cols, ct.Name())
+	}
+
+	res := make([][]any, 0, 8)
+	for rows.Next() {
+		dests := make([]any, 0, len(cts))
+		for _, ct := range cts {
+			dests = append(dests, scanDest(ct))
+		}
+		if err = rows.Scan(dests...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]any, 0, len(cts))
+		for i, dest := range dests {
+			val, err := scannedValue(cts[i], dest)
+			if err != nil {
+				return nil, nil, err
+			}
+			row = append(row, val)
+		}
+		res = append(res, row)
+	}
+	return cols, res, d.db.dialect.translateErr(rows.Err())
+}
+
+var rawBytesType = reflect.TypeOf(sql.RawBytes{})
+
+// scanDest 根据驱动给出的类型创建 Scan 的目标
+// 驱动不知道类型的时候, 例如 SQLite 里面表达式的列, 用 any 接收
+func scanDest(ct *sql.ColumnType) any {
+	typ := ct.ScanType()
+	if typ == nil || typ.Kind() == reflect.Interface || typ.Kind() == reflect.Ptr {
+		return new(any)
+	}
+	// RawBytes 在下一次 Next 之后就失效了, 所以用 []byte 复制一份
+	if typ == rawBytesType {
+		return new([]byte)
+	}
+	return reflect.New(typ).Interface()
+}
+
+// binaryTypes 这些类型的列保留 []byte, 其余的 []byte 都转为 string
+var binaryTypes = map[string]struct{}{
+	"BLOB":       {},
+	"TINYBLOB":   {},
+	"MEDIUMBLOB": {},
+	"LONGBLOB":   {},
+	"BINARY":     {},
+	"VARBINARY":  {},
+	"BIT":        {},
+	"GEOMETRY":   {},
+}
+
+// scannedValue 把 sql.NullInt64 这种类型还原为 int64 或者 nil
+func scannedValue(ct *sql.ColumnType, dest any) (any, error) {
+	// 驱动自己决定的类型, 原样返回
+	if val, ok := dest.(*any); ok {
+		return *val, nil
+	}
+	val := reflect.ValueOf(dest).Elem().Interface()
+	if valuer, ok := val.(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	if bs, ok := val.([]byte); ok {
+		if bs == nil {
+			return nil, nil
+		}
+		if _, ok = binaryTypes[strings.ToUpper(ct.DatabaseTypeName())]; !ok {
+			return string(bs), nil
+		}
+	}
+	return val, nil
+}
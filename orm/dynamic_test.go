@@ -0,0 +1,136 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDynamicSelector_Build(t *testing.T) {
+	db := memoryDB(t)
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "all",
+			q:    NewDynamicSelector(db, "audit_log"),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM `audit_log`;",
+			},
+		},
+		{
+			name: "columns and where",
+			q: NewDynamicSelector(db, "audit_log").Select("id", "action").
+				Where(C("user_id").EQ(1).And(C("action").Like("del%"))).
+				OrderBy(Desc("id")).Limit(10).Offset(20),
+			wantQuery: &Query{
+				SQL:  "SELECT `id`,`action` FROM `audit_log` WHERE (`user_id` = ?) AND (`action` LIKE ?) ORDER BY `id` DESC LIMIT ? OFFSET ?;",
+				Args: []any{1, "del%", 10, 20},
+			},
+		},
+		{
+			// 没有模型, map 的 key 直接作为列名
+			name: "where map",
+			q:    NewDynamicSelector(db, "audit_log").Where(WhereMap(map[string]any{"user_id": 1})),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `audit_log` WHERE `user_id` = ?;",
+				Args: []any{1},
+			},
+		},
+		{
+			// 没有模型, 不知道结构体的字段对应哪一列
+			name:    "where entity",
+			q:       NewDynamicSelector(db, "audit_log").Where(WhereEntity(&TestModel{Age: 18})),
+			wantErr: errs.ErrExampleWithoutModel,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestDynamicSelector_sqlite(t *testing.T) {
+	db, err := Open("sqlite3", "file:dynamic.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`CREATE TABLE audit_log(
+    id INTEGER PRIMARY KEY,
+    action TEXT,
+    amount REAL,
+    payload BLOB,
+    created_at DATETIME
+)`,
+		"INSERT INTO audit_log VALUES (1, 'create', 1.5, x'0102', '2022-10-01 10:00:00')",
+		"INSERT INTO audit_log VALUES (2, NULL, NULL, NULL, NULL)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+
+	res, err := NewDynamicSelector(db, "audit_log").OrderBy(Asc("id")).GetMaps(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{
+			"id":         int64(1),
+			"action":     "create",
+			"amount":     1.5,
+			"payload":    []byte{1, 2},
+			"created_at": time.Date(2022, 10, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{"id": int64(2), "action": nil, "amount": nil, "payload": nil, "created_at": nil},
+	}, res)
+
+	cols, vals, err := NewDynamicSelector(db, "audit_log").Select("action", "id").
+		Where(C("id").EQ(1)).GetSlices(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"action", "id"}, cols)
+	assert.Equal(t, [][]any{{"create", int64(1)}}, vals)
+
+	// 校验列名
+	ds := NewDynamicSelector(db, "audit_log").Where(C("invalid").EQ(1))
+	cts, err := ds.Introspect(ctx)
+	require.NoError(t, err)
+	assert.Len(t, cts, 5)
+	assert.Equal(t, "created_at", cts[4].Name())
+	_, err = ds.Build()
+	assert.Equal(t, errs.NewErrUnknownField("invalid"), err)
+}
+
+func TestDynamicSelector_mysql(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectMySQL))
+	require.NoError(t, err)
+
+	rows := mock.NewRowsWithColumnDefinition(
+		sqlmock.NewColumn("id").OfType("BIGINT", int64(0)),
+		sqlmock.NewColumn("name").OfType("VARCHAR", []byte{}),
+		sqlmock.NewColumn("avatar").OfType("BLOB", []byte{}),
+	).AddRow(int64(1), []byte("Tom"), []byte{1})
+	mock.ExpectQuery("SELECT \\* FROM `user`;").WillReturnRows(rows)
+
+	res, err := NewDynamicSelector(db, "user").GetMaps(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{"id": int64(1), "name": "Tom", "avatar": []byte{1}},
+	}, res)
+}
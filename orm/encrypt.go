@@ -0,0 +1,205 @@
+package orm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/internal/valuer"
+	"geektime-go-study/orm/model"
+	"io"
+	"sort"
+)
+
+// KeyProvider 提供加密字段使用的密钥
+// 密钥的长度必须是 16, 24 或者 32, 分别对应 AES-128, AES-192 和 AES-256
+type KeyProvider interface {
+	// CurrentKeyId 加密使用的密钥
+	CurrentKeyId() string
+	// Key 根据 id 返回密钥, 解密的时候 id 来自密文
+	Key(id string) ([]byte, error)
+	// KeyIds 所有还能用于解密的密钥
+	// 确定性加密的字段作为查询条件的时候, 会用每一个密钥加密一次
+	KeyIds() []string
+}
+
+type staticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+	ids     []string
+}
+
+// NewStaticKeyProvider 密钥写死在配置里面
+// 轮换密钥的时候, 把新密钥加进 keys 并且设置为 current, 旧密钥要保留到数据全部重新加密为止
+func NewStaticKeyProvider(current string, keys map[string][]byte) KeyProvider {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		if id != current {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return &staticKeyProvider{
+		current: current,
+		keys:    keys,
+		ids:     append([]string{current}, ids...),
+	}
+}
+
+func (p *staticKeyProvider) CurrentKeyId() string {
+	return p.current
+}
+
+func (p *staticKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, errs.NewErrUnknownKey(id)
+	}
+	return key, nil
+}
+
+func (p *staticKeyProvider) KeyIds() []string {
+	return p.ids
+}
+
+// DBWithEncryption 开启 orm:"encrypt" 字段的加解密
+// 加密使用 AES-GCM, 字段的值在交给驱动之前加密, 扫描之后解密
+func DBWithEncryption(kp KeyProvider) DBOption {
+	return func(db *DB) {
+		db.cipher = &aesGCMCipher{kp: kp}
+	}
+}
+
+// hasEncrypted 模型是否有加密字段
+func hasEncrypted(m *model.Model) bool {
+	for _, fd := range m.Fields {
+		if fd.Encrypt != model.EncryptNone {
+			return true
+		}
+	}
+	return false
+}
+
+// ciphertextVersion 密文格式的版本, 方便以后修改格式
+// 密文的格式是 版本(1 字节) | 密钥 id 的长度(1 字节) | 密钥 id | nonce | AES-GCM 密文
+const ciphertextVersion = 1
+
+var _ valuer.Cipher = &aesGCMCipher{}
+
+type aesGCMCipher struct {
+	kp KeyProvider
+}
+
+func (c *aesGCMCipher) Encrypt(fd *model.Field, plain []byte) ([]byte, error) {
+	return c.seal(c.kp.CurrentKeyId(), fd, plain)
+}
+
+func (c *aesGCMCipher) EncryptAll(fd *model.Field, plain []byte) ([][]byte, error) {
+	ids := c.kp.KeyIds()
+	res := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		ct, err := c.seal(id, fd, plain)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ct)
+	}
+	return res, nil
+}
+
+func (c *aesGCMCipher) seal(id string, fd *model.Field, plain []byte) ([]byte, error) {
+	if len(id) > 255 {
+		return nil, errs.NewErrUnknownKey(id)
+	}
+	key, err := c.kp.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if fd.Encrypt == model.EncryptDeterministic {
+		// 确定性加密的 nonce 由明文决定, 同样的明文得到同样的密文
+		// 用派生出来的密钥计算 HMAC, 而不是直接用加密的密钥
+		mac := hmac.New(sha256.New, deriveKey(key, "orm nonce"))
+		mac.Write([]byte(fd.ColName))
+		mac.Write([]byte{0})
+		mac.Write(plain)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, 0, 2+len(id)+len(nonce)+len(plain)+aead.Overhead())
+	res = append(res, ciphertextVersion, byte(len(id)))
+	res = append(res, id...)
+	res = append(res, nonce...)
+	// 列名作为附加数据, 防止把一列的密文挪到另外一列
+	return aead.Seal(res, nonce, plain, []byte(fd.ColName)), nil
+}
+
+func (c *aesGCMCipher) Decrypt(fd *model.Field, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 2 || ciphertext[0] != ciphertextVersion {
+		return nil, errs.ErrInvalidCiphertext
+	}
+	idLen := int(ciphertext[1])
+	ciphertext = ciphertext[2:]
+	if len(ciphertext) < idLen {
+		return nil, errs.ErrInvalidCiphertext
+	}
+	key, err := c.kp.Key(string(ciphertext[:idLen]))
+	if err != nil {
+		return nil, err
+	}
+	ciphertext = ciphertext[idLen:]
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errs.ErrInvalidCiphertext
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, sealed, []byte(fd.ColName))
+	if err != nil {
+		return nil, errs.ErrInvalidCiphertext
+	}
+	// 区分空字符串和 NULL
+	if plain == nil {
+		plain = []byte{}
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func deriveKey(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// plainCipher 不加密, 见 DB.plainValuer
+type plainCipher struct{}
+
+func (plainCipher) Encrypt(fd *model.Field, plain []byte) ([]byte, error) {
+	return plain, nil
+}
+
+func (plainCipher) EncryptAll(fd *model.Field, plain []byte) ([][]byte, error) {
+	return [][]byte{plain}, nil
+}
+
+func (plainCipher) Decrypt(fd *model.Field, ciphertext []byte) ([]byte, error) {
+	return ciphertext, nil
+}
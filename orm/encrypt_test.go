@@ -0,0 +1,174 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type EncryptUser struct {
+	Id     int64
+	Phone  string  `orm:"encrypt=deterministic"`
+	Note   *string `orm:"encrypt"`
+	Secret []byte  `orm:"encrypt"`
+}
+
+var (
+	testKey1 = []byte("0123456789abcdef0123456789abcdef")
+	testKey2 = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestSelector_Encrypt_Build(t *testing.T) {
+	kp := NewStaticKeyProvider("k1", map[string][]byte{"k1": testKey1, "k2": testKey2})
+	db, err := OpenDB(nil, DBWithEncryption(kp))
+	require.NoError(t, err)
+	noCipher, err := OpenDB(nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		s        *Selector[EncryptUser]
+		wantSQL  string
+		wantArgs int
+		wantErr  error
+	}{
+		{
+			// 两个密钥, 每个密钥加密一次
+			name:     "eq",
+			s:        NewSelector[EncryptUser](db).Where(C("Phone").EQ("123")),
+			wantSQL:  "SELECT * FROM `encrypt_user` WHERE `phone` IN (?,?);",
+			wantArgs: 2,
+		},
+		{
+			name:     "in",
+			s:        NewSelector[EncryptUser](db).Where(C("Phone").In("123", "456")),
+			wantSQL:  "SELECT * FROM `encrypt_user` WHERE `phone` IN (?,?,?,?);",
+			wantArgs: 4,
+		},
+		{
+			name:    "random",
+			s:       NewSelector[EncryptUser](db).Where(C("Note").EQ("hello")),
+			wantErr: errs.NewErrEncryptedPredicate("Note"),
+		},
+		{
+			name:    "not eq",
+			s:       NewSelector[EncryptUser](db).Where(C("Phone").Like("1%")),
+			wantErr: errs.NewErrEncryptedPredicate("Phone"),
+		},
+		{
+			// 值的类型和字段不一致
+			name:    "not string",
+			s:       NewSelector[EncryptUser](db).Where(C("Phone").EQ(13800000000)),
+			wantErr: errs.NewErrEncryptedPredicate("Phone"),
+		},
+		{
+			name:    "no cipher",
+			s:       NewSelector[EncryptUser](noCipher).Where(C("Phone").EQ("123")),
+			wantErr: ErrNoCipher,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.s.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantSQL, query.SQL)
+			assert.Len(t, query.Args, tc.wantArgs)
+			assert.NotContains(t, query.Args, "123")
+		})
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []DBOption
+	}{
+		{name: "unsafe"},
+		{name: "reflect", opts: []DBOption{DBWithReflectValuer()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dsn := "file:encrypt_" + tc.name + ".db?cache=shared&mode=memory"
+			kp := NewStaticKeyProvider("k1", map[string][]byte{"k1": testKey1})
+			db, err := Open("sqlite3", dsn, append(tc.opts, DBWithEncryption(kp))...)
+			require.NoError(t, err)
+			_, err = db.db.Exec("CREATE TABLE encrypt_user(id INTEGER PRIMARY KEY, phone TEXT, note TEXT, secret BLOB)")
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			note := "hello"
+			tom := &EncryptUser{Id: 1, Phone: "123", Note: &note, Secret: []byte("secret")}
+			_, err = NewInserter[EncryptUser](db).Values(tom, &EncryptUser{Id: 2, Phone: "456"}).Exec(ctx)
+			require.NoError(t, err)
+
+			// 数据库里面是密文
+			var phone, rawNote string
+			err = db.db.QueryRow("SELECT phone, note FROM encrypt_user WHERE id = 1").Scan(&phone, &rawNote)
+			require.NoError(t, err)
+			assert.NotEqual(t, "123", phone)
+			assert.NotEqual(t, "hello", rawNote)
+
+			// 确定性加密可以查询, NULL 还是 NULL
+			res, err := NewSelector[EncryptUser](db).Where(C("Phone").EQ("123")).Get(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tom, res)
+			res, err = NewSelector[EncryptUser](db).Where(C("Phone").EQ("456")).Get(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, &EncryptUser{Id: 2, Phone: "456"}, res)
+
+			// 密钥轮换之后, 旧数据还能读出来, 也能查到
+			kp = NewStaticKeyProvider("k2", map[string][]byte{"k1": testKey1, "k2": testKey2})
+			rotated, err := Open("sqlite3", dsn, append(tc.opts, DBWithEncryption(kp))...)
+			require.NoError(t, err)
+			_, err = NewInserter[EncryptUser](rotated).Values(&EncryptUser{Id: 3, Phone: "123"}).Exec(ctx)
+			require.NoError(t, err)
+			users, err := NewSelector[EncryptUser](rotated).Where(C("Phone").EQ("123")).GetMulti(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []*EncryptUser{tom, {Id: 3, Phone: "123"}}, users)
+
+			// 没有新密钥的 DB 读不了新数据
+			_, err = NewSelector[EncryptUser](db).Where(C("Id").EQ(3)).Get(ctx)
+			assert.Equal(t, errs.NewErrUnknownKey("k2"), err)
+		})
+	}
+}
+
+func TestUnitOfWork_Encrypt(t *testing.T) {
+	kp := NewStaticKeyProvider("k1", map[string][]byte{"k1": testKey1})
+	ch := make(chan AuditRecord, 10)
+	db, err := Open("sqlite3", "file:encrypt_uow.db?cache=shared&mode=memory",
+		DBWithEncryption(kp), DBWithAudit(NewChanAuditSink(ch)))
+	require.NoError(t, err)
+	_, err = db.db.Exec("CREATE TABLE encrypt_user(id INTEGER PRIMARY KEY, phone TEXT, note TEXT, secret BLOB)")
+	require.NoError(t, err)
+	ctx := context.Background()
+	note := "hello"
+	_, err = NewInserter[EncryptUser](db).Values(&EncryptUser{Id: 1, Phone: "123", Note: &note}).Exec(ctx)
+	require.NoError(t, err)
+	<-ch
+
+	// 随机加密每次的密文都不一样, 但是没有修改的时候不会更新
+	sess := NewSession(db)
+	u, err := NewSelector[EncryptUser](sess).Where(C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+	changes, err := sess.changes()
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	u.Phone = "456"
+	require.NoError(t, sess.Commit(ctx))
+	res, err := NewSelector[EncryptUser](db).Where(C("Phone").EQ("456")).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &EncryptUser{Id: 1, Phone: "456", Note: &note}, res)
+
+	// 审计记录里面不能出现明文
+	record := <-ch
+	assert.Equal(t, map[string]any{"phone": auditMask}, record.Old)
+	assert.Equal(t, map[string]any{"phone": auditMask}, record.New)
+}
@@ -6,4 +6,43 @@ import "geektime-go-study/orm/internal/errs"
 var (
 	// ErrNoRows 代表没有找到数据
 	ErrNoRows = errs.ErrNoRows
+	// ErrTooManyReturnedColumns 代表返回的列比模型的字段多
+	// 主要给 ormgen 生成的代码使用
+	ErrTooManyReturnedColumns = errs.ErrTooManyReturnedColumns
+	// ErrNoTenant 模型声明了租户字段, 但是 context 中没有租户
+	ErrNoTenant = errs.ErrNoTenant
+	// ErrTenantMismatch 写入的数据属于别的租户
+	ErrTenantMismatch = errs.ErrTenantMismatch
+	// ErrLockOutsideTx 在事务之外使用了 ForUpdate 这些行锁
+	ErrLockOutsideTx = errs.ErrLockOutsideTx
+	// ErrNoCipher 模型有加密字段, 但是没有通过 DBWithEncryption 配置密钥
+	ErrNoCipher = errs.ErrNoCipher
+	// ErrInvalidCiphertext 密文被篡改, 或者不是用这里的密钥加密的
+	ErrInvalidCiphertext = errs.ErrInvalidCiphertext
+
+	// 下面这些是翻译之后的驱动错误, 用 errors.Is 判断
+	// 驱动原始的错误可以通过 errors.As 拿到, 例如 *mysql.MySQLError
+
+	// ErrDuplicateKey 唯一键冲突
+	ErrDuplicateKey = errs.ErrDuplicateKey
+	// ErrForeignKeyViolation 违反外键约束
+	ErrForeignKeyViolation = errs.ErrForeignKeyViolation
+	// ErrDeadlock 死锁
+	ErrDeadlock = errs.ErrDeadlock
+	// ErrLockTimeout 等待锁超时
+	ErrLockTimeout = errs.ErrLockTimeout
+	// ErrCheckViolation 违反 CHECK 约束
+	ErrCheckViolation = errs.ErrCheckViolation
 )
+
+// NewErrUnknownColumn 代表结果集里面有模型不认识的列
+// 主要给 ormgen 生成的代码使用
+func NewErrUnknownColumn(colName string) error {
+	return errs.NewErrUnknownColumn(colName)
+}
+
+// NewErrUnknownField 代表模型上没有这个字段
+// 主要给 ormgen 生成的代码使用
+func NewErrUnknownField(name string) error {
+	return errs.NewErrUnknownField(name)
+}
@@ -0,0 +1,130 @@
+package orm
+
+import (
+	"geektime-go-study/orm/internal/errs"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// example 查询样例, 构造 SQL 的时候才根据模型的元数据展开
+// 因为 WhereEntity 和 WhereMap 的时候还不知道模型, 没办法校验字段
+type example struct {
+	entity any            // WhereEntity 传入的结构体
+	fields map[string]any // WhereMap 传入的 map
+	cfg    exampleConfig
+}
+
+func (example) expr() {}
+
+type exampleConfig struct {
+	zero map[string]struct{} // 即便是零值也要作为条件的字段
+	like bool
+}
+
+type ExampleOption func(cfg *exampleConfig)
+
+// ExampleWithZero 即便是零值, 这些字段也作为条件
+// 例如查询 Age = 0 的数据
+func ExampleWithZero(fields ...string) ExampleOption {
+	return func(cfg *exampleConfig) {
+		for _, fd := range fields {
+			cfg.zero[fd] = struct{}{}
+		}
+	}
+}
+
+// ExampleWithLike string 类型的字段使用 LIKE '%val%' 而不是 =
+// val 里面的 % 和 _ 会被转义, 按照字面量匹配
+func ExampleWithLike() ExampleOption {
+	return func(cfg *exampleConfig) {
+		cfg.like = true
+	}
+}
+
+// WhereEntity 把结构体中非零值的字段转为 = 条件, 并用 AND 连接起来
+// 例如 WhereEntity(&User{Age: 18, FirstName: "Tom"}) 等价于
+// C("FirstName").EQ("Tom").And(C("Age").EQ(18))
+// 如果全部字段都是零值, 会生成 1 = 1
+func WhereEntity(entity any, opts ...ExampleOption) Predicate {
+	return Predicate{right: newExample(entity, nil, opts)}
+}
+
+// WhereMap 和 WhereEntity 类似, key 是字段名
+// map 里面的值都会作为条件, 不管是不是零值
+func WhereMap(fields map[string]any, opts ...ExampleOption) Predicate {
+	return Predicate{right: newExample(nil, fields, opts)}
+}
+
+func newExample(entity any, fields map[string]any, opts []ExampleOption) example {
+	cfg := exampleConfig{zero: map[string]struct{}{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return example{entity: entity, fields: fields, cfg: cfg}
+}
+
+// buildExample 把样例展开成 Predicate 再构造
+func (b *builder) buildExample(ex example) error {
+	var ps []Predicate
+	if ex.entity != nil {
+		// DynamicSelector 没有调用 Introspect 的时候没有模型
+		if b.m == nil {
+			return errs.ErrExampleWithoutModel
+		}
+		val := reflect.ValueOf(ex.entity)
+		for val.Kind() == reflect.Ptr {
+			val = val.Elem()
+		}
+		// 按照模型字段的顺序, 保证生成的 SQL 是稳定的
+		for _, fd := range b.m.Fields {
+			fdVal := val.FieldByName(fd.FieldName)
+			if !fdVal.IsValid() {
+				return errs.NewErrUnknownField(fd.FieldName)
+			}
+			if _, ok := ex.cfg.zero[fd.FieldName]; fdVal.IsZero() && !ok {
+				continue
+			}
+			ps = append(ps, ex.predicate(fd.FieldName, fdVal.Interface()))
+		}
+	} else {
+		names := make([]string, 0, len(ex.fields))
+		for name := range ex.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ps = append(ps, ex.predicate(name, ex.fields[name]))
+		}
+	}
+
+	if len(ps) == 0 {
+		b.sb.WriteString("1 = 1")
+		return nil
+	}
+	return b.buildPredicates(ps)
+}
+
+func (ex example) predicate(name string, val any) Predicate {
+	if str, ok := val.(string); ok && ex.cfg.like {
+		return Predicate{
+			left:  C(name),
+			op:    opLIKE,
+			right: likeValue{pattern: "%" + likeEscaper.Replace(str) + "%"},
+		}
+	}
+	return C(name).EQ(val)
+}
+
+// likeEscape LIKE 的转义字符, 没有用 \ 是因为 MySQL 的字符串里面 \ 本身也要转义
+const likeEscape = '!'
+
+// likeEscaper 用户输入的 % 和 _ 要按照字面量匹配, 而不是通配符
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likeValue LIKE 右边的模式, 里面的通配符已经用 likeEscape 转义, 渲染为 ? ESCAPE '!'
+type likeValue struct {
+	pattern string
+}
+
+func (likeValue) expr() {}
@@ -0,0 +1,162 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWhereExample(t *testing.T) {
+	db, err := OpenDB(nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "entity",
+			q:    NewSelector[TestModel](db).Where(WhereEntity(&TestModel{Age: 18, FirstName: "Tom"})),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE (`first_name` = ?) AND (`age` = ?);",
+				Args: []any{"Tom", int8(18)},
+			},
+		},
+		{
+			name: "entity single field",
+			q:    NewSelector[TestModel](db).Where(WhereEntity(TestModel{Age: 18})),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `age` = ?;",
+				Args: []any{int8(18)},
+			},
+		},
+		{
+			name: "entity pointer field",
+			q: NewSelector[TestModel](db).Where(WhereEntity(&TestModel{
+				LastName: &sql.NullString{String: "Ming", Valid: true}})),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `last_name` = ?;",
+				Args: []any{&sql.NullString{String: "Ming", Valid: true}},
+			},
+		},
+		{
+			name: "entity all zero",
+			q:    NewSelector[TestModel](db).Where(WhereEntity(&TestModel{})),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM `test_model` WHERE 1 = 1;",
+			},
+		},
+		{
+			name: "entity with zero",
+			q: NewSelector[TestModel](db).Where(WhereEntity(&TestModel{FirstName: "Tom"},
+				ExampleWithZero("Age"))),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE (`first_name` = ?) AND (`age` = ?);",
+				Args: []any{"Tom", int8(0)},
+			},
+		},
+		{
+			name: "entity with like",
+			q: NewSelector[TestModel](db).Where(WhereEntity(&TestModel{FirstName: "Tom", Age: 18},
+				ExampleWithLike())),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE (`first_name` LIKE ? ESCAPE '!') AND (`age` = ?);",
+				Args: []any{"%Tom%", int8(18)},
+			},
+		},
+		{
+			name: "entity and predicate",
+			q: NewSelector[TestModel](db).Where(WhereEntity(&TestModel{FirstName: "Tom"}),
+				C("Id").GT(10)),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE (`first_name` = ?) AND (`id` > ?);",
+				Args: []any{"Tom", 10},
+			},
+		},
+		{
+			name: "entity of other model",
+			q: NewSelector[TestModel](db).Where(WhereEntity(&struct {
+				FirstName string
+			}{FirstName: "Tom"})),
+			wantErr: errs.NewErrUnknownField("Id"),
+		},
+		{
+			name: "map",
+			q: NewSelector[TestModel](db).Where(WhereMap(map[string]any{
+				"FirstName": "Tom",
+				"Age":       0,
+			})),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE (`age` = ?) AND (`first_name` = ?);",
+				Args: []any{0, "Tom"},
+			},
+		},
+		{
+			name: "map with like",
+			q: NewSelector[TestModel](db).Where(WhereMap(map[string]any{
+				"FirstName": "Tom",
+			}, ExampleWithLike())),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `first_name` LIKE ? ESCAPE '!';",
+				Args: []any{"%Tom%"},
+			},
+		},
+		{
+			// 用户输入的通配符按照字面量匹配
+			name: "like escape",
+			q: NewSelector[TestModel](db).Where(WhereMap(map[string]any{
+				"FirstName": "50%_off!",
+			}, ExampleWithLike())),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `first_name` LIKE ? ESCAPE '!';",
+				Args: []any{"%50!%!_off!!%"},
+			},
+		},
+		{
+			name: "map unknown field",
+			q: NewSelector[TestModel](db).Where(WhereMap(map[string]any{
+				"first_name": "Tom",
+			})),
+			wantErr: errs.NewErrUnknownField("first_name"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestWhereExample_likeEscape_sqlite(t *testing.T) {
+	db, err := Open("sqlite3", "file:example_like.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE test_model(id INTEGER PRIMARY KEY, first_name TEXT, age INTEGER, last_name TEXT)",
+		"INSERT INTO test_model(id, first_name, age) VALUES (1, '50% off', 0), (2, '500 off', 0), (3, 'a_b', 0), (4, 'axb', 0)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+
+	res, err := NewSelector[TestModel](db).Where(WhereEntity(&TestModel{FirstName: "0%"}, ExampleWithLike())).GetMulti(ctx)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, int64(1), res[0].Id)
+
+	res, err = NewSelector[TestModel](db).Where(WhereEntity(&TestModel{FirstName: "_"}, ExampleWithLike())).GetMulti(ctx)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, int64(3), res[0].Id)
+}
@@ -0,0 +1,250 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"log"
+	"regexp"
+	"strconv"
+)
+
+// PlanRow 执行计划中的一行, 对应对一张表的访问
+type PlanRow struct {
+	Table string
+	// Access 访问方式
+	// MySQL 是 type 列, 例如 ALL, ref, const
+	// SQLite 是 SCAN 或者 SEARCH
+	Access string
+	// Index 使用的索引, 没有使用索引则为空
+	Index string
+	// Rows 预估扫描的行数
+	// MySQL 是 rows 列
+	// SQLite 没有预估, 所以全表扫描的时候用表的行数代替, 其余情况为 0
+	Rows int64
+	// FullScan 是否是全表扫描
+	FullScan bool
+	// Detail 原始的描述, 方便排查问题
+	Detail string
+}
+
+// Plan 执行计划
+type Plan []PlanRow
+
+// Explain 返回查询的执行计划
+// SQLite 执行的是 EXPLAIN QUERY PLAN, MySQL 执行的是 EXPLAIN, PostgreSQL 暂时不支持
+func (s *Selector[T]) Explain(ctx context.Context) (Plan, error) {
+	s.from(ctx)
+	query, err := s.Build()
+	if err != nil {
+		return nil, err
+	}
+	// 在事务中的时候 EXPLAIN 也要在事务中执行, 否则看不到事务中的修改, 还可能被事务持有的锁阻塞
+	return s.db.dialect.explain(ctx, s.sess.conn(), query, s.aliases())
+}
+
+// aliases JOIN 的时候执行计划里面是嵌套结构体的别名, 例如 `order` AS `o` 里面的 o
+func (s *Selector[T]) aliases() map[string]string {
+	if len(s.m.Nested) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(s.m.Nested))
+	for _, n := range s.m.Nested {
+		res[n.Alias] = n.Model.TableName
+	}
+	return res
+}
+
+// FullScanHandler 发现全表扫描的时候调用, 返回 error 会拒绝这个查询
+type FullScanHandler func(ctx context.Context, query *Query, row PlanRow) error
+
+// LogFullScan 只是输出日志
+func LogFullScan(ctx context.Context, query *Query, row PlanRow) error {
+	log.Printf("orm: 全表扫描 %s, 预估行数 %d, SQL: %s", row.Table, row.Rows, query.SQL)
+	return nil
+}
+
+// RejectFullScan 拒绝全表扫描的查询, 适合在 CI 里面发现漏掉的索引
+func RejectFullScan(ctx context.Context, query *Query, row PlanRow) error {
+	return errs.NewErrFullScan(row.Table, row.Rows)
+}
+
+type fullScanCheck struct {
+	minRows int64
+	handler FullScanHandler
+}
+
+// DBWithFullScanCheck 在每个查询之前执行 EXPLAIN
+// 如果发现对行数不小于 minRows 的表做了全表扫描, 就调用 handler
+// 每个查询都要多执行一次 EXPLAIN, 所以一般只在测试环境开启
+func DBWithFullScanCheck(minRows int64, handler FullScanHandler) DBOption {
+	return func(db *DB) {
+		db.fullScan = &fullScanCheck{
+			minRows: minRows,
+			handler: handler,
+		}
+	}
+}
+
+// checkFullScan 在 conn 上执行 EXPLAIN, 事务中的查询也在事务中执行 EXPLAIN
+func (db *DB) checkFullScan(ctx context.Context, conn sqlConn, query string, args []any) error {
+	q := &Query{SQL: query, Args: args}
+	plan, err := db.dialect.explain(ctx, conn, q, nil)
+	if err != nil {
+		return err
+	}
+	for _, row := range plan {
+		if row.FullScan && row.Rows >= db.fullScan.minRows {
+			if err = db.fullScan.handler(ctx, q, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sqlite3Plan 匹配 EXPLAIN QUERY PLAN 的 detail 列, 例如
+// SCAN user
+// SEARCH user USING INDEX idx_age (age=?)
+// SEARCH user USING INTEGER PRIMARY KEY (rowid=?)
+// 老版本的 SQLite 是 SCAN TABLE user 的形式
+var sqlite3Plan = regexp.MustCompile(`^(SCAN|SEARCH)(?: TABLE)? (\S+)(?: USING (?:COVERING )?INDEX (\S+)| USING (INTEGER PRIMARY KEY))?`)
+
+// explain 执行计划里面的名字可能是别名, CTE 或者 CONSTANT ROW 这种不是表的名字
+// 别名还原为表名, 不是表的直接忽略, 所以只有真实存在的表才会用 COUNT(*) 查询行数
+func (d sqlite3Dialect) explain(ctx context.Context, db sqlConn, query *Query, aliases map[string]string) (Plan, error) {
+	rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query.SQL, query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var res Plan
+	for rows.Next() {
+		var (
+			id, parent, notUsed int
+			detail              string
+		)
+		if err = rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, err
+		}
+		// 排序, 临时表这些不是对表的访问, 直接忽略
+		matches := sqlite3Plan.FindStringSubmatch(detail)
+		if matches == nil {
+			continue
+		}
+		table := matches[2]
+		if t, ok := aliases[table]; ok {
+			table = t
+		}
+		row := PlanRow{
+			Access: matches[1],
+			Table:  table,
+			Index:  matches[3] + matches[4],
+			Detail: detail,
+		}
+		row.FullScan = row.Access == "SCAN" && row.Index == ""
+		res = append(res, row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if res, err = d.realTables(ctx, db, res); err != nil {
+		return nil, err
+	}
+
+	// SQLite 没有预估的行数, 全表扫描的行数就是表的行数
+	for i := range res {
+		if !res[i].FullScan {
+			continue
+		}
+		b := builder{dialect: d}
+		b.sb.WriteString("SELECT COUNT(*) FROM ")
+		b.quote(res[i].Table)
+		b.sb.WriteByte(';')
+		err = db.QueryRowContext(ctx, b.sb.String()).Scan(&res[i].Rows)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// realTables 去掉不是表的行, 例如 CTE 和 SCAN CONSTANT ROW
+func (sqlite3Dialect) realTables(ctx context.Context, db sqlConn, plan Plan) (Plan, error) {
+	tables := make(map[string]bool, len(plan))
+	res := plan[:0]
+	for _, row := range plan {
+		isTable, ok := tables[row.Table]
+		if !ok {
+			var cnt int
+			err := db.QueryRowContext(ctx,
+				"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?;", row.Table).Scan(&cnt)
+			if err != nil {
+				return nil, err
+			}
+			isTable = cnt > 0
+			tables[row.Table] = isTable
+		}
+		if isTable {
+			res = append(res, row)
+		}
+	}
+	return res, nil
+}
+
+func (mysqlDialect) explain(ctx context.Context, db sqlConn, query *Query, aliases map[string]string) (Plan, error) {
+	rows, err := db.QueryContext(ctx, "EXPLAIN "+query.SQL, query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	// 不同版本的 MySQL 返回的列不一样, 所以按照列名来取
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var res Plan
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		colVals := make(map[string]string, len(cols))
+		for i, c := range cols {
+			colVals[c] = vals[i].String
+		}
+		table := colVals["table"]
+		if t, ok := aliases[table]; ok {
+			table = t
+		}
+		row := PlanRow{
+			Table:  table,
+			Access: colVals["type"],
+			Index:  colVals["key"],
+			Detail: colVals["Extra"],
+		}
+		if colVals["rows"] != "" {
+			if row.Rows, err = strconv.ParseInt(colVals["rows"], 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		row.FullScan = row.Access == "ALL"
+		res = append(res, row)
+	}
+	return res, rows.Err()
+}
+
+// explain PostgreSQL 暂时不支持
+func (postgresDialect) explain(ctx context.Context, db sqlConn, query *Query, aliases map[string]string) (Plan, error) {
+	return nil, errs.NewErrUnsupportedExplain("PostgreSQL")
+}
@@ -0,0 +1,194 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type ExplainUser struct {
+	Id   int64
+	Age  int
+	Name string
+}
+
+type ExplainOrder struct {
+	Id     int64
+	UserId int64
+}
+
+type ExplainOrderWithUser struct {
+	ExplainOrder `orm:"alias=o"`
+	User         *ExplainUser `orm:"alias=u"`
+}
+
+func prepareExplainDB(t *testing.T, dsn string, opts ...DBOption) *DB {
+	db, err := Open("sqlite3", dsn, opts...)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE explain_user(id INTEGER PRIMARY KEY, age INTEGER, name TEXT)",
+		"CREATE INDEX idx_age ON explain_user(age)",
+		"CREATE TABLE explain_order(id INTEGER PRIMARY KEY, user_id INTEGER)",
+		"INSERT INTO explain_order VALUES (1, 1), (2, 2)",
+		"INSERT INTO explain_user VALUES (1, 18, 'Tom'), (2, 19, 'Jerry'), (3, 20, 'Jack')",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func TestSelector_Explain_sqlite(t *testing.T) {
+	db := prepareExplainDB(t, "file:explain.db?cache=shared&mode=memory")
+
+	testCases := []struct {
+		name     string
+		s        *Selector[ExplainUser]
+		wantPlan Plan
+	}{
+		{
+			name: "full scan",
+			s:    NewSelector[ExplainUser](db).Where(C("Name").EQ("Tom")),
+			wantPlan: Plan{
+				{Table: "explain_user", Access: "SCAN", Rows: 3, FullScan: true, Detail: "SCAN explain_user"},
+			},
+		},
+		{
+			name: "primary key",
+			s:    NewSelector[ExplainUser](db).Where(C("Id").EQ(1)),
+			wantPlan: Plan{
+				{Table: "explain_user", Access: "SEARCH", Index: "INTEGER PRIMARY KEY",
+					Detail: "SEARCH explain_user USING INTEGER PRIMARY KEY (rowid=?)"},
+			},
+		},
+		{
+			name: "index",
+			s:    NewSelector[ExplainUser](db).Where(C("Age").GT(18)),
+			wantPlan: Plan{
+				{Table: "explain_user", Access: "SEARCH", Index: "idx_age",
+					Detail: "SEARCH explain_user USING INDEX idx_age (age>?)"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := tc.s.Explain(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPlan, plan)
+		})
+	}
+}
+
+// TestSelector_Explain_sqlite_join 执行计划里面是别名, 要还原为表名之后才能查询行数
+func TestSelector_Explain_sqlite_join(t *testing.T) {
+	db := prepareExplainDB(t, "file:explain_join.db?cache=shared&mode=memory")
+	plan, err := NewSelector[ExplainOrderWithUser](db).
+		Join("User", C("ExplainOrder.UserId").EQ(C("User.Id"))).Explain(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Plan{
+		{Table: "explain_order", Access: "SCAN", Rows: 2, FullScan: true, Detail: "SCAN o"},
+		{Table: "explain_user", Access: "SEARCH", Index: "INTEGER PRIMARY KEY",
+			Detail: "SEARCH u USING INTEGER PRIMARY KEY (rowid=?)"},
+	}, plan)
+}
+
+// TestSelector_Explain_sqlite_cte CTE 不是表, 直接忽略
+func TestSelector_Explain_sqlite_cte(t *testing.T) {
+	db := prepareExplainDB(t, "file:explain_cte.db?cache=shared&mode=memory")
+	young := NewSelector[ExplainUser](db).Where(C("Age").LT(20)).
+		Union(NewSelector[ExplainUser](db).Where(C("Name").EQ("Tom")))
+	plan, err := NewSelector[ExplainUser](db).With("young", young).From("young").Explain(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Plan{
+		{Table: "explain_user", Access: "SEARCH", Index: "idx_age",
+			Detail: "SEARCH explain_user USING INDEX idx_age (age<?)"},
+		{Table: "explain_user", Access: "SCAN", Rows: 3, FullScan: true, Detail: "SCAN explain_user"},
+	}, plan)
+}
+
+// TestSelector_Explain_sqlite_tx 事务中的 Explain 在事务中执行, 能看到还没有提交的数据
+func TestSelector_Explain_sqlite_tx(t *testing.T) {
+	db := prepareExplainDB(t, "file:explain_tx.db?cache=shared&mode=memory")
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	_, err = NewInserter[ExplainUser](tx).Values(&ExplainUser{Id: 4, Age: 21, Name: "Lily"}).Exec(ctx)
+	require.NoError(t, err)
+
+	plan, err := NewSelector[ExplainUser](tx).Where(C("Name").EQ("Tom")).Explain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Plan{
+		{Table: "explain_user", Access: "SCAN", Rows: 4, FullScan: true, Detail: "SCAN explain_user"},
+	}, plan)
+}
+
+func TestSelector_Explain_mysql(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectMySQL))
+	require.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "select_type", "table", "partitions", "type",
+		"possible_keys", "key", "key_len", "ref", "rows", "filtered", "Extra"}).
+		AddRow(1, "SIMPLE", "explain_user", nil, "ALL", nil, nil, nil, nil, "1000", "10.00", "Using where")
+	mock.ExpectQuery("EXPLAIN SELECT \\* FROM `explain_user` WHERE `name` = \\?;").
+		WithArgs("Tom").WillReturnRows(rows)
+
+	plan, err := NewSelector[ExplainUser](db).Where(C("Name").EQ("Tom")).Explain(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Plan{
+		{Table: "explain_user", Access: "ALL", Rows: 1000, FullScan: true, Detail: "Using where"},
+	}, plan)
+}
+
+func TestDB_FullScanCheck(t *testing.T) {
+	testCases := []struct {
+		name    string
+		minRows int64
+		s       func(db *DB) *Selector[ExplainUser]
+		wantErr error
+	}{
+		{
+			name:    "reject",
+			minRows: 3,
+			s: func(db *DB) *Selector[ExplainUser] {
+				return NewSelector[ExplainUser](db).Where(C("Name").EQ("Tom"))
+			},
+			wantErr: errs.NewErrFullScan("explain_user", 3),
+		},
+		{
+			// 表太小, 全表扫描也没关系
+			name:    "small table",
+			minRows: 4,
+			s: func(db *DB) *Selector[ExplainUser] {
+				return NewSelector[ExplainUser](db).Where(C("Name").EQ("Tom"))
+			},
+		},
+		{
+			name:    "index",
+			minRows: 1,
+			s: func(db *DB) *Selector[ExplainUser] {
+				return NewSelector[ExplainUser](db).Where(C("Age").EQ(18))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := prepareExplainDB(t, "file:full_scan_"+tc.name+".db?cache=shared&mode=memory",
+				DBWithFullScanCheck(tc.minRows, RejectFullScan))
+			_, err := tc.s(db).Get(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
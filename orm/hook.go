@@ -0,0 +1,58 @@
+package orm
+
+import "context"
+
+// 模型可以选择性地实现下面这些接口, ORM 会在对应的时机调用
+// 和 model.TableName 一样, 都是通过接口让用户介入 ORM 的流程
+// 任何一个钩子返回 error, 都会中断当前操作
+
+// BeforeQuery 在发起查询之前调用
+// 此时接收者还是零值, 一般用于根据 ctx 做一些校验
+type BeforeQuery interface {
+	BeforeQuery(ctx context.Context) error
+}
+
+// AfterQuery 在结果集写入结构体之后调用
+// 例如解密字段, 计算派生字段
+type AfterQuery interface {
+	AfterQuery(ctx context.Context) error
+}
+
+// BeforeSave 在任何写操作之前调用
+// 例如填充时间戳, 校验数据
+type BeforeSave interface {
+	BeforeSave(ctx context.Context) error
+}
+
+// AfterSave 在写操作成功之后调用
+type AfterSave interface {
+	AfterSave(ctx context.Context) error
+}
+
+func beforeQuery(ctx context.Context, val any) error {
+	if h, ok := val.(BeforeQuery); ok {
+		return h.BeforeQuery(ctx)
+	}
+	return nil
+}
+
+func afterQuery(ctx context.Context, val any) error {
+	if h, ok := val.(AfterQuery); ok {
+		return h.AfterQuery(ctx)
+	}
+	return nil
+}
+
+func beforeSave(ctx context.Context, val any) error {
+	if h, ok := val.(BeforeSave); ok {
+		return h.BeforeSave(ctx)
+	}
+	return nil
+}
+
+func afterSave(ctx context.Context, val any) error {
+	if h, ok := val.(AfterSave); ok {
+		return h.AfterSave(ctx)
+	}
+	return nil
+}
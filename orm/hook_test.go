@@ -0,0 +1,101 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// HookModel 实现了全部钩子
+type HookModel struct {
+	Id        int64
+	Name      string
+	Display   string
+	CreatedBy string
+}
+
+type ctxKeyUser struct{}
+
+func (h *HookModel) BeforeQuery(ctx context.Context) error {
+	if ctx.Value(ctxKeyUser{}) == nil {
+		return errors.New("未登录")
+	}
+	return nil
+}
+
+func (h *HookModel) AfterQuery(ctx context.Context) error {
+	h.Display = h.Name + "(" + ctx.Value(ctxKeyUser{}).(string) + ")"
+	return nil
+}
+
+func (h *HookModel) BeforeSave(ctx context.Context) error {
+	if h.Name == "" {
+		return errors.New("name 不能为空")
+	}
+	h.CreatedBy = ctx.Value(ctxKeyUser{}).(string)
+	return nil
+}
+
+func (h *HookModel) AfterSave(ctx context.Context) error {
+	h.Display = "saved"
+	return nil
+}
+
+func TestSelector_Hook(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	// BeforeQuery 返回 error, 不会发起查询
+	_, err = NewSelector[HookModel](db).Get(context.Background())
+	assert.Equal(t, errors.New("未登录"), err)
+
+	ctx := context.WithValue(context.Background(), ctxKeyUser{}, "admin")
+	rows := sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Tom")
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows)
+	res, err := NewSelector[HookModel](db).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &HookModel{Id: 1, Name: "Tom", Display: "Tom(admin)"}, res)
+
+	rows = sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Tom").AddRow(2, "Jerry")
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows)
+	vals, err := NewSelector[HookModel](db).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*HookModel{
+		{Id: 1, Name: "Tom", Display: "Tom(admin)"},
+		{Id: 2, Name: "Jerry", Display: "Jerry(admin)"},
+	}, vals)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInserter_Hook(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), ctxKeyUser{}, "admin")
+
+	// BeforeSave 返回 error, 不会执行 INSERT
+	_, err = NewInserter[HookModel](db).Values(&HookModel{Id: 1}).Exec(ctx)
+	assert.Equal(t, errors.New("name 不能为空"), err)
+
+	// BeforeSave 填充的字段要进入 INSERT 语句
+	mock.ExpectExec("INSERT INTO `hook_model`").
+		WithArgs(int64(1), "Tom", "", "admin").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	val := &HookModel{Id: 1, Name: "Tom"}
+	_, err = NewInserter[HookModel](db).Values(val).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &HookModel{Id: 1, Name: "Tom", Display: "saved", CreatedBy: "admin"}, val)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
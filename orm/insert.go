@@ -0,0 +1,268 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/model"
+	"reflect"
+	"strings"
+)
+
+// Inserter 用于构造 INSERT 语句
+type Inserter[T any] struct {
+	builder
+	tenantScope
+	values  []*T
+	columns []string // 指定插入的字段, 为空则插入全部字段
+	db      *DB
+	sess    Session
+}
+
+func NewInserter[T any](sess Session) *Inserter[T] {
+	return &Inserter[T]{
+		db:   sess.getDB(),
+		sess: sess,
+	}
+}
+
+// Values 指定插入的数据
+func (i *Inserter[T]) Values(vals ...*T) *Inserter[T] {
+	i.values = vals
+	return i
+}
+
+// Columns 指定插入的字段, 传入的是字段名
+func (i *Inserter[T]) Columns(cols ...string) *Inserter[T] {
+	i.columns = cols
+	return i
+}
+
+// CrossTenant 显式声明跨租户写入, 不会填充和校验租户字段
+func (i *Inserter[T]) CrossTenant() *Inserter[T] {
+	i.cross = true
+	return i
+}
+
+func (i *Inserter[T]) Build() (*Query, error) {
+	if len(i.values) == 0 {
+		return nil, errs.ErrInsertZeroRow
+	}
+	i.reset()
+	i.dialect = i.db.dialect
+	var err error
+	i.m, err = i.db.r.Get(i.values[0])
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := i.fields()
+	if err != nil {
+		return nil, err
+	}
+
+	i.sb.WriteString("INSERT INTO ")
+	i.quote(i.m.TableName)
+	i.sb.WriteByte('(')
+	for idx, fd := range fields {
+		if idx > 0 {
+			i.sb.WriteByte(',')
+		}
+		i.quote(fd.ColName)
+	}
+	i.sb.WriteString(") VALUES ")
+
+	names := make([]string, 0, len(fields))
+	for _, fd := range fields {
+		names = append(names, fd.FieldName)
+	}
+	i.args = make([]any, 0, len(fields)*len(i.values))
+	for vIdx, val := range i.values {
+		if vIdx > 0 {
+			i.sb.WriteByte(',')
+		}
+		i.sb.WriteByte('(')
+		for fIdx := range fields {
+			if fIdx > 0 {
+				i.sb.WriteByte(',')
+			}
+			i.sb.WriteByte('?')
+		}
+		i.sb.WriteByte(')')
+		args, err := i.db.newValuer(val, i.m).Values(names)
+		if err != nil {
+			return nil, err
+		}
+		i.addArgs(args...)
+	}
+	i.sb.WriteByte(';')
+	return &Query{
+		SQL:  i.sb.String(),
+		Args: i.args,
+	}, nil
+}
+
+// fields 返回需要插入的字段, 顺序与用户指定的一致
+// 没有声明跨租户的时候, 即便用户没有指定租户字段, 也要插入租户字段, 不然会绕过租户隔离
+func (i *Inserter[T]) fields() ([]*model.Field, error) {
+	if len(i.columns) == 0 {
+		return i.m.Fields, nil
+	}
+	res := make([]*model.Field, 0, len(i.columns)+1)
+	hasTenant := false
+	for _, c := range i.columns {
+		fd, ok := i.m.FieldMap[c]
+		if !ok {
+			return nil, errs.NewErrUnknownField(c)
+		}
+		hasTenant = hasTenant || fd == i.m.Tenant
+		res = append(res, fd)
+	}
+	if i.m.Tenant != nil && !i.cross && !hasTenant {
+		res = append(res, i.m.Tenant)
+	}
+	return res, nil
+}
+
+func (i *Inserter[T]) Exec(ctx context.Context) (sql.Result, error) {
+	// 先填充租户和执行钩子, 修改的字段才能进入 INSERT 语句
+	i.from(ctx)
+	for _, val := range i.values {
+		m, err := i.db.r.Get(val)
+		if err != nil {
+			return nil, err
+		}
+		if err = i.fill(m, val); err != nil {
+			return nil, err
+		}
+		if err = beforeSave(ctx, val); err != nil {
+			return nil, err
+		}
+	}
+
+	query, err := i.Build()
+	if err != nil {
+		return nil, err
+	}
+	res, err := i.execAudit(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, val := range i.values {
+		if err = afterSave(ctx, val); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// execAudit 执行 INSERT 并且写审计记录
+// 不在事务中的时候, INSERT 和审计记录放在同一个事务里面, 写审计记录失败的时候 INSERT 也会回滚
+func (i *Inserter[T]) execAudit(ctx context.Context, query *Query) (sql.Result, error) {
+	if _, ok := i.sess.(*Tx); ok || !i.db.auditEnabled(i.values[0]) {
+		res, err := execInsert(ctx, i.sess, i.m, query)
+		if err != nil {
+			return nil, err
+		}
+		return res, i.audit(ctx, i.sess, query, res)
+	}
+	var res sql.Result
+	err := i.db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		res, err = execInsert(ctx, tx, i.m, query)
+		if err != nil {
+			return err
+		}
+		return i.audit(ctx, tx, query, res)
+	}, nil)
+	return res, err
+}
+
+// audit 每一行生成一条审计记录, 新值就是插入的参数
+func (i *Inserter[T]) audit(ctx context.Context, sess Session, query *Query, res sql.Result) error {
+	if !i.db.auditEnabled(i.values[0]) {
+		return nil
+	}
+	fields, err := i.fields()
+	if err != nil {
+		return err
+	}
+	records := make([]AuditRecord, 0, len(i.values))
+	for idx, val := range i.values {
+		pk := auditPK(i.m, val)
+		// 只插入一行的时候, 可以拿到自增主键
+		if pk != nil && reflect.ValueOf(pk).IsZero() && len(i.values) == 1 {
+			if id, err := res.LastInsertId(); err == nil {
+				pk = id
+			}
+		}
+		records = append(records, AuditRecord{
+			Table:      i.m.TableName,
+			PrimaryKey: pk,
+			Op:         AuditInsert,
+			New:        auditValues(fields, query.Args[idx*len(fields):(idx+1)*len(fields)]),
+		})
+	}
+	return i.db.audit(ctx, sess, records)
+}
+
+// execInsert 执行 INSERT 语句
+// 驱动不支持 LastInsertId 的时候, 整数主键通过 RETURNING 返回, 返回的 sql.Result 同样可以调用 LastInsertId
+func execInsert(ctx context.Context, sess Session, m *model.Model, query *Query) (sql.Result, error) {
+	db := sess.getDB()
+	if !db.dialect.returningID() || m.PrimaryKey == nil || !isInteger(m.PrimaryKey.FieldType) {
+		return sess.execContext(ctx, query.SQL, query.Args...)
+	}
+	b := builder{dialect: db.dialect}
+	b.sb.WriteString(strings.TrimSuffix(query.SQL, ";"))
+	b.sb.WriteString(" RETURNING ")
+	b.quote(m.PrimaryKey.ColName)
+	b.sb.WriteByte(';')
+	rows, err := sess.queryContext(ctx, b.sb.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var res returningResult
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		res.ids = append(res.ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, db.dialect.translateErr(err)
+	}
+	return res, nil
+}
+
+func isInteger(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// returningResult RETURNING 返回的主键
+// 和 MySQL 一样, 插入多行的时候 LastInsertId 是第一行的主键
+type returningResult struct {
+	ids []int64
+}
+
+func (r returningResult) LastInsertId() (int64, error) {
+	if len(r.ids) == 0 {
+		return 0, errs.ErrNoRows
+	}
+	return r.ids[0], nil
+}
+
+func (r returningResult) RowsAffected() (int64, error) {
+	return int64(len(r.ids)), nil
+}
@@ -0,0 +1,78 @@
+package orm
+
+import (
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestInserter_Build(t *testing.T) {
+	db, err := OpenDB(nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name:    "no value",
+			q:       NewInserter[TestModel](db),
+			wantErr: errs.ErrInsertZeroRow,
+		},
+		{
+			name: "single value",
+			q: NewInserter[TestModel](db).Values(&TestModel{
+				Id:        1,
+				FirstName: "Deng",
+				Age:       18,
+				LastName:  &sql.NullString{String: "Ming", Valid: true},
+			}),
+			wantQuery: &Query{
+				SQL: "INSERT INTO `test_model`(`id`,`first_name`,`age`,`last_name`) VALUES (?,?,?,?);",
+				Args: []any{int64(1), "Deng", int8(18),
+					sql.NullString{String: "Ming", Valid: true}},
+			},
+		},
+		{
+			name: "multiple values",
+			q: NewInserter[TestModel](db).Values(
+				&TestModel{Id: 1, FirstName: "Deng", Age: 18},
+				&TestModel{Id: 2, FirstName: "Da", Age: 19}),
+			wantQuery: &Query{
+				SQL: "INSERT INTO `test_model`(`id`,`first_name`,`age`,`last_name`) VALUES (?,?,?,?),(?,?,?,?);",
+				Args: []any{int64(1), "Deng", int8(18), nil,
+					int64(2), "Da", int8(19), nil},
+			},
+		},
+		{
+			name: "specify columns",
+			q: NewInserter[TestModel](db).Columns("FirstName", "Age").
+				Values(&TestModel{Id: 1, FirstName: "Deng", Age: 18}),
+			wantQuery: &Query{
+				SQL:  "INSERT INTO `test_model`(`first_name`,`age`) VALUES (?,?);",
+				Args: []any{"Deng", int8(18)},
+			},
+		},
+		{
+			name: "invalid column",
+			q: NewInserter[TestModel](db).Columns("Invalid").
+				Values(&TestModel{Id: 1}),
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, res)
+		})
+	}
+}
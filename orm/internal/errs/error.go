@@ -15,12 +15,58 @@ var (
 	ErrPointerOnly            = errors.New("orm: 只支持一级指针作为输入，例如 *User")
 	ErrNoRows                 = errors.New("orm: 未找到数据")
 	ErrTooManyReturnedColumns = errors.New("orm: 过多列")
+	ErrInsertZeroRow          = errors.New("orm: 插入 0 行")
+	ErrInvalidBatchSize       = errors.New("orm: 每批的数量必须大于 0")
+	ErrNoTenant               = errors.New("orm: context 中没有租户")
+	ErrTenantMismatch         = errors.New("orm: 不能写入别的租户的数据")
+	ErrLockOutsideTx          = errors.New("orm: 行锁只能在事务中使用")
+	ErrLockWaitWithoutLock    = errors.New("orm: NoWait 和 SkipLocked 必须和 ForUpdate 或者 ForShare 一起使用")
+	ErrNoCipher               = errors.New("orm: 没有配置 KeyProvider, 不能读写加密字段")
+	ErrInvalidCiphertext      = errors.New("orm: 非法密文")
+	ErrExampleWithoutModel    = errors.New("orm: 没有模型, 不能使用 WhereEntity, 请使用 WhereMap")
+
+	// 下面这些是驱动错误翻译之后的 sentinel error, 见 DriverError
+	ErrDuplicateKey        = errors.New("orm: 唯一键冲突")
+	ErrForeignKeyViolation = errors.New("orm: 违反外键约束")
+	ErrDeadlock            = errors.New("orm: 死锁")
+	ErrLockTimeout         = errors.New("orm: 等待锁超时")
+	ErrCheckViolation      = errors.New("orm: 违反 CHECK 约束")
 )
 
+// DriverError 翻译之后的驱动错误
+// errors.Is 可以判断 Sentinel, errors.As 可以拿到驱动原始的错误
+type DriverError struct {
+	Sentinel error
+	Err      error
+}
+
+func NewDriverError(sentinel error, err error) error {
+	return &DriverError{
+		Sentinel: sentinel,
+		Err:      err,
+	}
+}
+
+func (e *DriverError) Error() string {
+	return fmt.Sprintf("%s, 原因: %s", e.Sentinel.Error(), e.Err.Error())
+}
+
+func (e *DriverError) Is(target error) bool {
+	return target == e.Sentinel
+}
+
+func (e *DriverError) Unwrap() error {
+	return e.Err
+}
+
 func NewErrUnsupportedExpressionType(exp any) error {
 	return fmt.Errorf("%w %v", ErrUnsupportedExpressionType, exp)
 }
 
+func NewErrUnsupportedSelectable(exp any) error {
+	return fmt.Errorf("orm: 不支持的列 %v", exp)
+}
+
 // NewErrUnknownField 返回代表未知字段的错误
 // 一般意味着你可能输入的是列名，或者输入了错误的字段名
 func NewErrUnknownField(fd string) error {
@@ -34,3 +80,83 @@ func NewErrInvalidTag(tag string) error {
 func NewErrUnknownColumn(colName string) error {
 	return fmt.Errorf("orm: 未知列 %s", colName)
 }
+
+// NewErrInvalidRelation 关联关系声明错误
+// 例如 has_many 的字段不是切片, 或者没有声明 foreign_key
+func NewErrInvalidRelation(fd string) error {
+	return fmt.Errorf("orm: 非法关联关系 %s", fd)
+}
+
+// NewErrInvalidNested 嵌套的结构体声明错误
+// 例如不是结构体, 别名重复, 或者第一个嵌套的结构体是切片
+func NewErrInvalidNested(fd string) error {
+	return fmt.Errorf("orm: 非法嵌套结构体 %s", fd)
+}
+
+// NewErrNotJoined 查询嵌套的结构体的时候, 除了第一个嵌套的结构体, 别的都要 JOIN
+func NewErrNotJoined(fd string) error {
+	return fmt.Errorf("orm: 嵌套结构体 %s 没有 JOIN", fd)
+}
+
+func NewErrUnknownRelation(name string) error {
+	return fmt.Errorf("orm: 未知关联关系 %s", name)
+}
+
+// NewErrKeysetNotSelected keyset 分页的时候, 查询的列里面没有 keyset 的列
+func NewErrKeysetNotSelected(fd string) error {
+	return fmt.Errorf("orm: keyset 分页必须查询字段 %s", fd)
+}
+
+func NewErrMultipleTenant(fd string) error {
+	return fmt.Errorf("orm: 只能有一个租户字段 %s", fd)
+}
+
+func NewErrFullScan(table string, rows int64) error {
+	return fmt.Errorf("orm: 全表扫描 %s, 预估行数 %d", table, rows)
+}
+
+func NewErrUnsupportedLock(dialect string) error {
+	return fmt.Errorf("orm: %s 不支持行锁", dialect)
+}
+
+func NewErrUnsupportedExplain(dialect string) error {
+	return fmt.Errorf("orm: %s 不支持执行计划", dialect)
+}
+
+// NewErrSetColumnMismatch UNION 这些集合运算两边的列数不一致
+func NewErrSetColumnMismatch(left, right int) error {
+	return fmt.Errorf("orm: 集合运算两边的列数不一致, 左边 %d 列, 右边 %d 列", left, right)
+}
+
+// NewErrNoPrimaryKey 工作单元要求模型有主键, 通过 orm:"primary_key" 声明或者是 Id 字段
+func NewErrNoPrimaryKey(table string) error {
+	return fmt.Errorf("orm: %s 没有主键", table)
+}
+
+func NewErrMultiplePrimaryKey(fd string) error {
+	return fmt.Errorf("orm: 只能有一个主键, %s 重复声明了 primary_key", fd)
+}
+
+// NewErrInvalidEncryptField 只有 string, *string 和 []byte 可以加密
+func NewErrInvalidEncryptField(fd string) error {
+	return fmt.Errorf("orm: 字段 %s 不能加密, 只支持 string, *string 和 []byte", fd)
+}
+
+func NewErrUnknownKey(id string) error {
+	return fmt.Errorf("orm: 未知的密钥 %s", id)
+}
+
+// NewErrInvalidJSONPath JSON 路径只支持 $.key 和 $[0] 这种写法, key 只能是字母, 数字和下划线
+func NewErrInvalidJSONPath(path string) error {
+	return fmt.Errorf("orm: 非法的 JSON 路径 %s", path)
+}
+
+// NewErrEncryptedColumn 加密字段需要解密, 不能通过 Pluck 和 Scalar 单独查询
+func NewErrEncryptedColumn(fd string) error {
+	return fmt.Errorf("orm: 加密字段 %s 不能单独查询, 请查询整个模型", fd)
+}
+
+// NewErrEncryptedPredicate 加密的字段只能在确定性加密的模式下使用 EQ 和 IN
+func NewErrEncryptedPredicate(fd string) error {
+	return fmt.Errorf("orm: 加密字段 %s 只支持确定性加密下的 EQ 和 IN 查询", fd)
+}
@@ -0,0 +1,238 @@
+// Code generated by ormgen. DO NOT EDIT.
+
+package testmodel
+
+import (
+	"database/sql"
+
+	"geektime-go-study/orm"
+	"geektime-go-study/orm/model"
+)
+
+// UserCols 是 User 的列, 用来代替 orm.C("FieldName") 这种字符串写法
+var UserCols = struct {
+	Id        orm.Column
+	FirstName orm.Column
+	Age       orm.Column
+	LastName  orm.Column
+}{
+	Id:        orm.C("Id"),
+	FirstName: orm.C("FirstName"),
+	Age:       orm.C("Age"),
+	LastName:  orm.C("LastName"),
+}
+
+func init() {
+	orm.RegisterValuer(func(val *User, meta *model.Model) orm.Valuer {
+		return userValuer{val: val, meta: meta}
+	})
+}
+
+// userValuer 不依赖反射和 unsafe 的 orm.Valuer 实现
+// 列名从 meta 里面找, 这样注册模型时候的 model.WithColumnName 这些设置同样生效
+type userValuer struct {
+	val  *User
+	meta *model.Model
+}
+
+func (v userValuer) SetColumns(rows *sql.Rows) error {
+	cs, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(cs) > len(v.meta.Fields) {
+		return orm.ErrTooManyReturnedColumns
+	}
+	vals := make([]any, len(cs))
+	for i, c := range cs {
+		fd, ok := v.meta.ColMap[c]
+		if !ok {
+			return orm.NewErrUnknownColumn(c)
+		}
+		switch fd.FieldName {
+		case "Id":
+			vals[i] = &v.val.Id
+		case "FirstName":
+			vals[i] = &v.val.FirstName
+		case "Age":
+			vals[i] = &v.val.Age
+		case "LastName":
+			vals[i] = &v.val.LastName
+		default:
+			return orm.NewErrUnknownColumn(c)
+		}
+	}
+	return rows.Scan(vals...)
+}
+
+func (v userValuer) Field(name string) (any, error) {
+	switch name {
+	case "Id":
+		return v.val.Id, nil
+	case "FirstName":
+		return v.val.FirstName, nil
+	case "Age":
+		return v.val.Age, nil
+	case "LastName":
+		if v.val.LastName == nil {
+			return nil, nil
+		}
+		return *v.val.LastName, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+func (v userValuer) Values(fields []string) ([]any, error) {
+	res := make([]any, 0, len(fields))
+	for _, name := range fields {
+		val, err := v.Field(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+// OrderDetailCols 是 OrderDetail 的列, 用来代替 orm.C("FieldName") 这种字符串写法
+var OrderDetailCols = struct {
+	Remark orm.Column
+}{
+	Remark: orm.C("Remark"),
+}
+
+func init() {
+	orm.RegisterValuer(func(val *OrderDetail, meta *model.Model) orm.Valuer {
+		return orderDetailValuer{val: val, meta: meta}
+	})
+}
+
+// orderDetailValuer 不依赖反射和 unsafe 的 orm.Valuer 实现
+// 列名从 meta 里面找, 这样注册模型时候的 model.WithColumnName 这些设置同样生效
+type orderDetailValuer struct {
+	val  *OrderDetail
+	meta *model.Model
+}
+
+func (v orderDetailValuer) SetColumns(rows *sql.Rows) error {
+	cs, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(cs) > len(v.meta.Fields) {
+		return orm.ErrTooManyReturnedColumns
+	}
+	vals := make([]any, len(cs))
+	for i, c := range cs {
+		fd, ok := v.meta.ColMap[c]
+		if !ok {
+			return orm.NewErrUnknownColumn(c)
+		}
+		switch fd.FieldName {
+		case "Remark":
+			vals[i] = &v.val.Remark
+		default:
+			return orm.NewErrUnknownColumn(c)
+		}
+	}
+	return rows.Scan(vals...)
+}
+
+func (v orderDetailValuer) Field(name string) (any, error) {
+	switch name {
+	case "Remark":
+		return v.val.Remark, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+func (v orderDetailValuer) Values(fields []string) ([]any, error) {
+	res := make([]any, 0, len(fields))
+	for _, name := range fields {
+		val, err := v.Field(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+// OrderCols 是 Order 的列, 用来代替 orm.C("FieldName") 这种字符串写法
+var OrderCols = struct {
+	Id     orm.Column
+	UserId orm.Column
+	Amount orm.Column
+}{
+	Id:     orm.C("Id"),
+	UserId: orm.C("UserId"),
+	Amount: orm.C("Amount"),
+}
+
+func init() {
+	orm.RegisterValuer(func(val *Order, meta *model.Model) orm.Valuer {
+		return orderValuer{val: val, meta: meta}
+	})
+}
+
+// orderValuer 不依赖反射和 unsafe 的 orm.Valuer 实现
+// 列名从 meta 里面找, 这样注册模型时候的 model.WithColumnName 这些设置同样生效
+type orderValuer struct {
+	val  *Order
+	meta *model.Model
+}
+
+func (v orderValuer) SetColumns(rows *sql.Rows) error {
+	cs, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(cs) > len(v.meta.Fields) {
+		return orm.ErrTooManyReturnedColumns
+	}
+	vals := make([]any, len(cs))
+	for i, c := range cs {
+		fd, ok := v.meta.ColMap[c]
+		if !ok {
+			return orm.NewErrUnknownColumn(c)
+		}
+		switch fd.FieldName {
+		case "Id":
+			vals[i] = &v.val.Id
+		case "UserId":
+			vals[i] = &v.val.UserId
+		case "Amount":
+			vals[i] = &v.val.Amount
+		default:
+			return orm.NewErrUnknownColumn(c)
+		}
+	}
+	return rows.Scan(vals...)
+}
+
+func (v orderValuer) Field(name string) (any, error) {
+	switch name {
+	case "Id":
+		return v.val.Id, nil
+	case "UserId":
+		return v.val.UserId, nil
+	case "Amount":
+		return v.val.Amount, nil
+	default:
+		return nil, orm.NewErrUnknownField(name)
+	}
+}
+
+func (v orderValuer) Values(fields []string) ([]any, error) {
+	res := make([]any, 0, len(fields))
+	for _, name := range fields {
+		val, err := v.Field(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
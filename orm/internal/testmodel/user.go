@@ -0,0 +1,39 @@
+// Package testmodel ormgen 的测试模型
+// user.gen.go 是生成的代码, 修改 user.go 之后需要重新执行 go generate
+package testmodel
+
+import "database/sql"
+
+//go:generate go run geektime-go-study/orm/cmd/ormgen -src user.go
+
+type User struct {
+	Id        int64
+	FirstName string
+	Age       int8
+	LastName  *sql.NullString
+}
+
+func (User) CreateSQL() string {
+	return `
+CREATE TABLE IF NOT EXISTS user(
+    id INTEGER PRIMARY KEY,
+    first_name TEXT NOT NULL,
+    age INTEGER,
+    last_name TEXT
+)
+`
+}
+
+// OrderDetail 嵌套的结构体不是列, 生成的代码里面没有它们
+type OrderDetail struct {
+	Order  `orm:"alias=o"`
+	Buyer  *User `orm:"alias=u"`
+	Remark string
+}
+
+type Order struct {
+	Id      int64
+	UserId  int64 `orm:"column=buyer"`
+	Amount  float64
+	Creator *User `orm:"belongs_to,foreign_key=UserId"`
+}
@@ -0,0 +1,127 @@
+package testmodel
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm"
+	"geektime-go-study/orm/internal/valuer"
+	"geektime-go-study/orm/model"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestGeneratedValuer(t *testing.T) {
+	_, ok := valuer.Generated(reflect.TypeOf(&User{}))
+	require.True(t, ok)
+
+	sqlDB := prepareDB(t, "file:generated_valuer.db?cache=shared&mode=memory")
+	db, err := orm.OpenDB(sqlDB)
+	require.NoError(t, err)
+
+	res, err := orm.NewSelector[User](db).Where(UserCols.Age.GT(10)).Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &User{
+		Id:        12,
+		FirstName: "Deng",
+		Age:       18,
+		LastName:  &sql.NullString{String: "Ming", Valid: true},
+	}, res)
+
+	// LastName 可以为 NULL
+	res, err = orm.NewSelector[User](db).Where(UserCols.Id.EQ(13)).Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 13, FirstName: "Li", Age: 8}, res)
+
+	_, err = orm.NewSelector[User](db).Select(UserCols.FirstName).Where(UserCols.Age.GT(20)).Get(context.Background())
+	assert.Equal(t, orm.ErrNoRows, err)
+}
+
+// TestGeneratedValuer_columnName 生成的代码同样要遵守注册模型时候指定的列名
+func TestGeneratedValuer_columnName(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite3", "file:generated_valuer_column.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	_, err = sqlDB.Exec("CREATE TABLE user(id INTEGER PRIMARY KEY, fname TEXT, age INTEGER, last_name TEXT)")
+	require.NoError(t, err)
+	_, err = sqlDB.Exec("INSERT INTO user VALUES (12, 'Deng', 18, NULL)")
+	require.NoError(t, err)
+
+	r := model.NewRegistry()
+	_, err = r.Register(&User{}, model.WithColumnName("FirstName", "fname"))
+	require.NoError(t, err)
+	db, err := orm.OpenDB(sqlDB, orm.DBWithRegistry(r))
+	require.NoError(t, err)
+
+	res, err := orm.NewSelector[User](db).Where(UserCols.FirstName.EQ("Deng")).Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 12, FirstName: "Deng", Age: 18}, res)
+}
+
+func prepareDB(t testing.TB, dsn string) *sql.DB {
+	db, err := sql.Open("sqlite3", dsn)
+	require.NoError(t, err)
+	_, err = db.Exec(User{}.CreateSQL())
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO `user`(`id`,`first_name`,`age`,`last_name`) VALUES (?,?,?,?),(?,?,?,?)",
+		12, "Deng", 18, "Ming", 13, "Li", 8, nil)
+	require.NoError(t, err)
+	return db
+}
+
+// 在 orm/internal/testmodel 目录下执行
+// go test -bench=BenchmarkValuer_SetColumns -benchmem
+// 三种实现扫描同一行数据, 查询不计入耗时, 差别只在 Valuer 本身
+// 输出
+// cpu: Intel(R) Xeon(R) Processor
+// BenchmarkValuer_SetColumns/generated           592268              2013 ns/op             152 B/op          4 allocs/op
+// BenchmarkValuer_SetColumns/unsafe              726753              1949 ns/op             168 B/op          4 allocs/op
+// BenchmarkValuer_SetColumns/reflect             377130              3155 ns/op             224 B/op          8 allocs/op
+// 生成的代码和 unsafe 差不多, 都比反射快, 主要是省掉了反射带来的内存分配
+func BenchmarkValuer_SetColumns(b *testing.B) {
+	db := prepareDB(b, "file:benchmark_valuer.db?cache=shared&mode=memory")
+	meta, err := model.NewRegistry().Get(&User{})
+	require.NoError(b, err)
+	generated, _ := valuer.Generated(reflect.TypeOf(&User{}))
+
+	creators := []struct {
+		name string
+		c    valuer.Creator
+	}{
+		{name: "generated", c: generated},
+		{name: "unsafe", c: valuer.NewUnsafeValue},
+		{name: "reflect", c: valuer.NewReflectValue},
+	}
+	for _, c := range creators {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// 查询不计入耗时, 只测 SetColumns
+				b.StopTimer()
+				rows, err := db.Query("SELECT * FROM `user` LIMIT 1")
+				if err != nil {
+					b.Fatal(err)
+				}
+				rows.Next()
+				b.StartTimer()
+				if err = c.c(&User{}, meta, nil).SetColumns(rows); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				_ = rows.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// TestGeneratedCols_nested 生成的列和 model.registry 解析出来的列一致, 嵌套的结构体不是列
+func TestGeneratedCols_nested(t *testing.T) {
+	meta, err := model.NewRegistry().Get(&OrderDetail{})
+	require.NoError(t, err)
+	typ := reflect.TypeOf(OrderDetailCols)
+	require.Equal(t, len(meta.Fields), typ.NumField())
+	for i, fd := range meta.Fields {
+		assert.Equal(t, fd.FieldName, typ.Field(i).Name)
+	}
+}
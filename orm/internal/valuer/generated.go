@@ -0,0 +1,25 @@
+package valuer
+
+import (
+	"reflect"
+	"sync"
+)
+
+// generated 保存 ormgen 生成的 Creator, key 是结构体指针的类型
+// 生成的代码在 init 里面注册, 所以只能用包变量, 类似于 database/sql 注册驱动
+var generated sync.Map
+
+// Register 注册某个类型的 Creator
+// typ 必须是结构体指针的类型, 例如 *User
+func Register(typ reflect.Type, c Creator) {
+	generated.Store(typ, c)
+}
+
+// Generated 查找某个类型的 Creator
+func Generated(typ reflect.Type) (Creator, bool) {
+	c, ok := generated.Load(typ)
+	if !ok {
+		return nil, false
+	}
+	return c.(Creator), true
+}
@@ -0,0 +1,162 @@
+package valuer
+
+import (
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/model"
+	"reflect"
+	"strings"
+)
+
+// locator 找到字段的位置, unsafe 直接计算偏移量, 反射通过 FieldByName 查找
+// 返回的都是可以写入的 reflect.Value
+type locator interface {
+	// field 外层结构体的字段, 或者组合的结构体 n 的字段, n 为 nil 代表外层结构体
+	field(n *model.Nested, fd *model.Field) reflect.Value
+	// nested 嵌套结构体的字段本身, 例如 User *User
+	nested(n *model.Nested) reflect.Value
+	// elemField 新建出来的嵌套结构体 elem 的字段, elem 是指向结构体的指针
+	elemField(elem reflect.Value, fd *model.Field) reflect.Value
+}
+
+// nestedColumn 结果集中的一列对应的字段
+type nestedColumn struct {
+	// n 为 nil 代表外层结构体自己的字段
+	n  *model.Nested
+	fd *model.Field
+	// root 是不是第一个嵌套的结构体, 也就是 FROM 后面的表
+	root bool
+}
+
+// direct 外层结构体和 FROM 后面的组合的结构体的字段可以直接扫描
+// 其余的要先扫描到临时变量, LEFT JOIN 没有匹配的时候整行都是 NULL
+func (c nestedColumn) direct() bool {
+	return c.n == nil || c.root && c.n.Kind == model.NestedStruct
+}
+
+// nestedColumns 根据列名找到字段, 列名是 别名.列名, 例如 o.id
+func nestedColumns(meta *model.Model, cs []string) ([]nestedColumn, error) {
+	res := make([]nestedColumn, 0, len(cs))
+	for _, c := range cs {
+		if fd, ok := meta.ColMap[c]; ok {
+			res = append(res, nestedColumn{fd: fd})
+			continue
+		}
+		alias, col, _ := strings.Cut(c, ".")
+		var n *model.Nested
+		for _, nn := range meta.Nested {
+			if nn.Alias == alias {
+				n = nn
+				break
+			}
+		}
+		if n == nil {
+			return nil, errs.NewErrUnknownColumn(c)
+		}
+		fd, ok := n.Model.ColMap[col]
+		if !ok {
+			return nil, errs.NewErrUnknownColumn(c)
+		}
+		res = append(res, nestedColumn{n: n, fd: fd, root: n == meta.Nested[0]})
+	}
+	return res, nil
+}
+
+// setNested 把 JOIN 的一行写入 OrderWithUser{Order; User *User} 这种嵌套的结构体
+// 切片每一行追加一个元素, 合并多行是 Selector 的事情
+func setNested(rows *sql.Rows, meta *model.Model, c Cipher, l locator) error {
+	cs, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	cols, err := nestedColumns(meta, cs)
+	if err != nil {
+		return err
+	}
+
+	vals := make([]any, len(cols))
+	for i, col := range cols {
+		switch {
+		case col.fd.Encrypt != model.EncryptNone:
+			vals[i] = new([]byte)
+		case col.direct():
+			vals[i] = l.field(col.n, col.fd).Addr().Interface()
+		default:
+			// 扫描到 **T, 这样 NULL 不会报错
+			vals[i] = reflect.New(reflect.PtrTo(col.fd.FieldType)).Interface()
+		}
+	}
+	if err = rows.Scan(vals...); err != nil {
+		return err
+	}
+
+	// 组合的结构体直接写入了, 只需要解密
+	elems := make(map[*model.Nested]reflect.Value, len(meta.Nested))
+	for i, col := range cols {
+		if col.direct() {
+			if col.fd.Encrypt != model.EncryptNone {
+				err = decryptInto(c, col.fd, *vals[i].(*[]byte), l.field(col.n, col.fd))
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// 组合的结构体不需要新建, NULL 的列保持零值
+		if isNull(vals[i]) || col.n.Kind == model.NestedStruct {
+			continue
+		}
+		if _, ok := elems[col.n]; !ok {
+			elems[col.n] = reflect.New(col.n.ElemType)
+		}
+	}
+
+	// 只有至少一列不是 NULL 的嵌套结构体才会创建出来
+	for i, col := range cols {
+		if col.direct() {
+			continue
+		}
+		var dst reflect.Value
+		if col.n.Kind == model.NestedStruct {
+			if isNull(vals[i]) {
+				continue
+			}
+			dst = l.field(col.n, col.fd)
+		} else {
+			elem, ok := elems[col.n]
+			if !ok {
+				continue
+			}
+			dst = l.elemField(elem, col.fd)
+		}
+		if col.fd.Encrypt != model.EncryptNone {
+			if err = decryptInto(c, col.fd, *vals[i].(*[]byte), dst); err != nil {
+				return err
+			}
+			continue
+		}
+		if ptr := reflect.ValueOf(vals[i]).Elem(); !ptr.IsNil() {
+			dst.Set(ptr.Elem())
+		}
+	}
+	for n, elem := range elems {
+		fd := l.nested(n)
+		if n.Kind == model.NestedPtr {
+			fd.Set(elem)
+			continue
+		}
+		if n.FieldType.Elem().Kind() != reflect.Ptr {
+			elem = elem.Elem()
+		}
+		fd.Set(reflect.Append(fd, elem))
+	}
+	return nil
+}
+
+// isNull 扫描出来的临时变量是不是 NULL
+func isNull(val any) bool {
+	if raw, ok := val.(*[]byte); ok {
+		return *raw == nil
+	}
+	return reflect.ValueOf(val).Elem().IsNil()
+}
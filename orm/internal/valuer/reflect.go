@@ -9,8 +9,9 @@ import (
 
 // reflectValue 基于反射的 Value
 type reflectValue struct {
-	val  reflect.Value
-	meta *model.Model
+	val    reflect.Value
+	meta   *model.Model
+	cipher Cipher
 }
 
 // 确保 Creator 修改的时候, 能够得到提示
@@ -18,14 +19,18 @@ var _ Creator = NewReflectValue
 
 // NewReflectValue 返回一个封装好的，基于反射实现的 Value
 // 输入 val 必须是一个指向结构体实例的指针，而不能是任何其它类型
-func NewReflectValue(val any, meta *model.Model) Valuer {
+func NewReflectValue(val any, meta *model.Model, c Cipher) Valuer {
 	return &reflectValue{
-		val:  reflect.ValueOf(val),
-		meta: meta,
+		val:    reflect.ValueOf(val),
+		meta:   meta,
+		cipher: c,
 	}
 }
 
 func (r *reflectValue) SetColumns(rows *sql.Rows) error {
+	if len(r.meta.Nested) > 0 {
+		return setNested(rows, r.meta, r.cipher, r)
+	}
 	// step 1 拿到结果集的列名
 	colNames, err := rows.Columns()
 	if err != nil {
@@ -44,6 +49,11 @@ func (r *reflectValue) SetColumns(rows *sql.Rows) error {
 			return errs.NewErrUnknownColumn(colName)
 		}
 
+		// 加密的列先扫描密文
+		if cm.Encrypt != model.EncryptNone {
+			colVals = append(colVals, new([]byte))
+			continue
+		}
 		colVal := reflect.New(cm.FieldType).Interface() // colVal 实质是指针
 		colVals = append(colVals, colVal)
 	}
@@ -58,7 +68,44 @@ func (r *reflectValue) SetColumns(rows *sql.Rows) error {
 	for i, colName := range colNames {
 		cm := r.meta.ColMap[colName]
 		fd := r.val.Elem().FieldByName(cm.FieldName)
+		if cm.Encrypt != model.EncryptNone {
+			if err = decryptInto(r.cipher, cm, *colVals[i].(*[]byte), fd); err != nil {
+				return err
+			}
+			continue
+		}
 		fd.Set(reflect.ValueOf(colVals[i]).Elem())
 	}
 	return nil
 }
+
+func (r *reflectValue) field(n *model.Nested, fd *model.Field) reflect.Value {
+	if n == nil {
+		return r.val.Elem().FieldByName(fd.FieldName)
+	}
+	return r.nested(n).FieldByName(fd.FieldName)
+}
+
+func (r *reflectValue) nested(n *model.Nested) reflect.Value {
+	return r.val.Elem().FieldByName(n.FieldName)
+}
+
+func (r *reflectValue) elemField(elem reflect.Value, fd *model.Field) reflect.Value {
+	return elem.Elem().FieldByName(fd.FieldName)
+}
+
+func (r *reflectValue) Field(name string) (any, error) {
+	fd, ok := r.meta.FieldMap[name]
+	if !ok {
+		return nil, errs.NewErrUnknownField(name)
+	}
+	val := r.val.Elem().FieldByName(name)
+	if fd.Encrypt != model.EncryptNone {
+		return encryptField(r.cipher, fd, val)
+	}
+	return fieldValue(val), nil
+}
+
+func (r *reflectValue) Values(fields []string) ([]any, error) {
+	return values(r, fields)
+}
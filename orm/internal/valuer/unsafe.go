@@ -9,20 +9,25 @@ import (
 )
 
 type unsafeValue struct {
-	addr unsafe.Pointer
-	meta *model.Model
+	addr   unsafe.Pointer
+	meta   *model.Model
+	cipher Cipher
 }
 
 var _ Creator = NewUnsafeValue
 
-func NewUnsafeValue(val interface{}, meta *model.Model) Valuer {
+func NewUnsafeValue(val interface{}, meta *model.Model, c Cipher) Valuer {
 	return &unsafeValue{
-		addr: unsafe.Pointer(reflect.ValueOf(val).Pointer()),
-		meta: meta,
+		addr:   unsafe.Pointer(reflect.ValueOf(val).Pointer()),
+		meta:   meta,
+		cipher: c,
 	}
 }
 
 func (u *unsafeValue) SetColumns(rows *sql.Rows) error {
+	if len(u.meta.Nested) > 0 {
+		return setNested(rows, u.meta, u.cipher, u)
+	}
 	cs, err := rows.Columns()
 	if err != nil {
 		return err
@@ -32,16 +37,67 @@ func (u *unsafeValue) SetColumns(rows *sql.Rows) error {
 	}
 
 	colValues := make([]any, len(cs))
+	// 加密的列先扫描密文, 解密之后再写入字段
+	var encrypted []int
 	for i, c := range cs {
 		cm, ok := u.meta.ColMap[c]
 		if !ok {
 			return errs.NewErrUnknownColumn(c)
 		}
+		if cm.Encrypt != model.EncryptNone {
+			colValues[i] = new([]byte)
+			encrypted = append(encrypted, i)
+			continue
+		}
 		ptr := unsafe.Pointer(uintptr(u.addr) + cm.Offset)
 		val := reflect.NewAt(cm.FieldType, ptr)
 		colValues[i] = val.Interface()
 	}
 
-	return rows.Scan(colValues...)
+	if err = rows.Scan(colValues...); err != nil {
+		return err
+	}
+	for _, i := range encrypted {
+		cm := u.meta.ColMap[cs[i]]
+		ptr := unsafe.Pointer(uintptr(u.addr) + cm.Offset)
+		err = decryptInto(u.cipher, cm, *colValues[i].(*[]byte), reflect.NewAt(cm.FieldType, ptr).Elem())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field 组合的结构体的字段的偏移量是 组合的结构体的偏移量 + 字段在组合的结构体中的偏移量
+func (u *unsafeValue) field(n *model.Nested, fd *model.Field) reflect.Value {
+	offset := fd.Offset
+	if n != nil {
+		offset += n.Offset
+	}
+	return reflect.NewAt(fd.FieldType, unsafe.Pointer(uintptr(u.addr)+offset)).Elem()
+}
+
+func (u *unsafeValue) nested(n *model.Nested) reflect.Value {
+	return reflect.NewAt(n.FieldType, unsafe.Pointer(uintptr(u.addr)+n.Offset)).Elem()
+}
+
+func (u *unsafeValue) elemField(elem reflect.Value, fd *model.Field) reflect.Value {
+	return reflect.NewAt(fd.FieldType, unsafe.Pointer(uintptr(elem.UnsafePointer())+fd.Offset)).Elem()
+}
+
+func (u *unsafeValue) Field(name string) (any, error) {
+	fd, ok := u.meta.FieldMap[name]
+	if !ok {
+		return nil, errs.NewErrUnknownField(name)
+	}
+	ptr := unsafe.Pointer(uintptr(u.addr) + fd.Offset)
+	val := reflect.NewAt(fd.FieldType, ptr).Elem()
+	if fd.Encrypt != model.EncryptNone {
+		return encryptField(u.cipher, fd, val)
+	}
+	return fieldValue(val), nil
+}
 
+func (u *unsafeValue) Values(fields []string) ([]any, error) {
+	return values(u, fields)
 }
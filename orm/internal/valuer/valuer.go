@@ -2,7 +2,10 @@ package valuer
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"geektime-go-study/orm/internal/errs"
 	"geektime-go-study/orm/model"
+	"reflect"
 )
 
 // Valuer 是对结构体实例的内部抽象
@@ -11,12 +14,178 @@ import (
 type Valuer interface {
 	// SetColumns 设置新值
 	SetColumns(rows *sql.Rows) error
+	// Field 读取字段的值, name 是字段名
+	// 返回的值可以直接作为 SQL 的参数:
+	// nil 指针返回 nil, 其余指针返回指向的值, sql.Null* 这种 driver.Valuer 原样返回
+	Field(name string) (any, error)
+	// Values 批量读取字段的值, 顺序和 fields 一致
+	Values(fields []string) ([]any, error)
 }
 
-type Creator func(val any, meta *model.Model) Valuer
+// Creator c 用于读写 orm:"encrypt" 的字段, 为 nil 的时候读写加密字段会返回 errs.ErrNoCipher
+type Creator func(val any, meta *model.Model, c Cipher) Valuer
+
+// Cipher 加密解密 orm:"encrypt" 的字段
+type Cipher interface {
+	// Encrypt 使用当前的密钥加密
+	Encrypt(fd *model.Field, plain []byte) ([]byte, error)
+	// EncryptAll 使用每一个密钥加密, 用于确定性加密的字段作为查询条件的场景
+	// 这样密钥轮换之后, 旧密钥加密的数据也能查到
+	EncryptAll(fd *model.Field, plain []byte) ([][]byte, error)
+	// Decrypt 根据密文里面的密钥 id 找到密钥解密
+	Decrypt(fd *model.Field, ciphertext []byte) ([]byte, error)
+}
 
 // ResultSetHandler 这是另外一种可行的设计方案
 // type ResultSetHandler interface {
 // 	// SetColumns 设置新值，column 是列名
 // 	SetColumns(val any, rows *sql.Rows) error
 // }
+
+// fieldValue 把字段的值转为可以作为 SQL 参数的形式
+func fieldValue(fd reflect.Value) any {
+	if fd.Kind() == reflect.Ptr {
+		if fd.IsNil() {
+			return nil
+		}
+		fd = fd.Elem()
+	}
+	return fd.Interface()
+}
+
+// values 是 Values 的公共实现
+func values(v Valuer, fields []string) ([]any, error) {
+	res := make([]any, 0, len(fields))
+	for _, name := range fields {
+		val, err := v.Field(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// isPlaintext 查询条件里面的值只能是 string, *string 或者 []byte, 和加密字段的类型一致
+func isPlaintext(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.String || typ == bytesType
+}
+
+// plaintext 取出 string, *string 或者 []byte 的内容, nil 返回 false
+func plaintext(v reflect.Value) ([]byte, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		return []byte(v.String()), true
+	}
+	if v.IsNil() {
+		return nil, false
+	}
+	return v.Bytes(), true
+}
+
+// encode 密文在数据库里面的形式
+// []byte 字段直接保存密文, string 字段保存 base64 编码之后的密文, 避免字符集的问题
+func encode(fd *model.Field, ciphertext []byte) any {
+	if fd.FieldType == bytesType {
+		return ciphertext
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func decode(fd *model.Field, raw []byte) ([]byte, error) {
+	if fd.FieldType == bytesType {
+		return raw, nil
+	}
+	res, err := base64.StdEncoding.DecodeString(string(raw))
+	if err != nil {
+		return nil, errs.ErrInvalidCiphertext
+	}
+	return res, nil
+}
+
+// encryptField 读取加密字段 v 的值并且加密
+func encryptField(c Cipher, fd *model.Field, v reflect.Value) (any, error) {
+	plain, ok := plaintext(v)
+	if !ok {
+		return nil, nil
+	}
+	if c == nil {
+		return nil, errs.ErrNoCipher
+	}
+	ciphertext, err := c.Encrypt(fd, plain)
+	if err != nil {
+		return nil, err
+	}
+	return encode(fd, ciphertext), nil
+}
+
+// EncryptLookup 把查询条件里面的值加密, 每一个密钥对应一个结果
+func EncryptLookup(c Cipher, fd *model.Field, val any) ([]any, error) {
+	if val != nil && !isPlaintext(reflect.TypeOf(val)) {
+		return nil, errs.NewErrEncryptedPredicate(fd.FieldName)
+	}
+	plain, ok := plaintext(reflect.ValueOf(val))
+	if !ok {
+		return []any{nil}, nil
+	}
+	if c == nil {
+		return nil, errs.ErrNoCipher
+	}
+	cts, err := c.EncryptAll(fd, plain)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, 0, len(cts))
+	for _, ct := range cts {
+		res = append(res, encode(fd, ct))
+	}
+	return res, nil
+}
+
+// decryptInto 解密扫描出来的密文 raw, 写入字段 dst
+func decryptInto(c Cipher, fd *model.Field, raw []byte, dst reflect.Value) error {
+	if raw == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if c == nil {
+		return errs.ErrNoCipher
+	}
+	ciphertext, err := decode(fd, raw)
+	if err != nil {
+		return err
+	}
+	plain, err := c.Decrypt(fd, ciphertext)
+	if err != nil {
+		return err
+	}
+	if dst.Kind() == reflect.Ptr {
+		ptr := reflect.New(dst.Type().Elem())
+		setPlaintext(ptr.Elem(), plain)
+		dst.Set(ptr)
+		return nil
+	}
+	setPlaintext(dst, plain)
+	return nil
+}
+
+func setPlaintext(v reflect.Value, plain []byte) {
+	if v.Kind() == reflect.String {
+		v.SetString(string(plain))
+		return
+	}
+	v.SetBytes(plain)
+}
@@ -0,0 +1,246 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/internal/valuer"
+	"geektime-go-study/orm/model"
+	"reflect"
+)
+
+// Iterator 流式地遍历结果集, 用于导出, 批处理这种没办法一次性把 []*T 放进内存的场景
+// 用法:
+//
+//	it, err := NewSelector[User](db).Iter(ctx)
+//	defer it.Close()
+//	for it.Next() {
+//		u, err := it.Scan()
+//	}
+//	err = it.Err()
+//
+// Iterator 不是并发安全的
+type Iterator[T any] struct {
+	ctx  context.Context
+	s    *Selector[T]
+	rows *sql.Rows
+	meta *model.Model
+
+	// reuse 为 true 的时候, 每一行都写入同一个 buf
+	// 这时候 Scan 返回的永远是同一个指针, 用户需要自己复制
+	reuse bool
+	buf   *T
+	val   valuer.Valuer // reuse 的时候, val 绑定在 buf 上, 所以也只需要创建一次
+
+	cur     *T
+	scanErr error
+	err     error
+	closed  bool
+
+	// keyset 分页模式, 见 IterWithKeyset
+	keyset    string
+	batchSize int
+	batchCnt  int
+	last      any
+}
+
+type IteratorOption func(cfg *iteratorConfig)
+
+type iteratorConfig struct {
+	reuse     bool
+	keyset    string
+	batchSize int
+}
+
+// IterWithReuse 复用同一个 T, 从而避免每一行都分配内存
+// 注意 Scan 返回的指针在下一次 Next 之后会被覆盖
+func IterWithReuse() IteratorOption {
+	return func(cfg *iteratorConfig) {
+		cfg.reuse = true
+	}
+}
+
+// IterWithKeyset 使用 keyset 分页的方式遍历, key 是字段名, 一般是主键
+// 每一批执行 WHERE key > last ORDER BY key LIMIT batchSize,
+// 每一批的查询都很短, 不会长时间占用连接, 适合跑很久的任务
+// 这种模式会覆盖 Selector 上的 ORDER BY, LIMIT 和 OFFSET
+func IterWithKeyset(key string, batchSize int) IteratorOption {
+	return func(cfg *iteratorConfig) {
+		cfg.keyset = key
+		cfg.batchSize = batchSize
+	}
+}
+
+// Iter 返回一个 Iterator, 用完之后必须调用 Close
+func (s *Selector[T]) Iter(ctx context.Context, opts ...IteratorOption) (*Iterator[T], error) {
+	cfg := &iteratorConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if err := beforeQuery(ctx, new(T)); err != nil {
+		return nil, err
+	}
+	s.from(ctx)
+	meta, err := s.db.r.Get(new(T))
+	if err != nil {
+		return nil, err
+	}
+
+	it := &Iterator[T]{
+		ctx:       ctx,
+		s:         s,
+		meta:      meta,
+		reuse:     cfg.reuse,
+		keyset:    cfg.keyset,
+		batchSize: cfg.batchSize,
+	}
+	if it.reuse {
+		it.buf = new(T)
+		it.val = s.db.newValuer(it.buf, meta)
+	}
+	if it.keyset != "" {
+		if err = it.checkKeyset(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = it.query(); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+func (it *Iterator[T]) checkKeyset() error {
+	if it.batchSize <= 0 {
+		return errs.ErrInvalidBatchSize
+	}
+	fd, ok := it.meta.FieldMap[it.keyset]
+	if !ok {
+		return errs.NewErrUnknownField(it.keyset)
+	}
+	// 只查部分列的时候, 必须带上 keyset 的列, 不然拿不到下一批的起点
+	if len(it.s.columns) == 0 {
+		return nil
+	}
+	for _, c := range it.s.columns {
+		if col, ok := c.(Column); ok && col.name == fd.FieldName {
+			return nil
+		}
+	}
+	return errs.NewErrKeysetNotSelected(it.keyset)
+}
+
+// query 发起查询, keyset 模式下每一批都会调用一次
+func (it *Iterator[T]) query() error {
+	var (
+		query *Query
+		err   error
+	)
+	if it.keyset == "" {
+		query, err = it.s.Build()
+	} else {
+		query, err = it.buildBatch()
+	}
+	if err != nil {
+		return err
+	}
+	it.batchCnt = 0
+	it.rows, err = it.s.sess.queryContext(it.ctx, query.SQL, query.Args...)
+	return err
+}
+
+// buildBatch 在用户的条件上加上 key > last, 构造下一批的查询
+// 构造完之后会恢复 Selector 原本的设置
+func (it *Iterator[T]) buildBatch() (*Query, error) {
+	s := it.s
+	where, orderBy, limit, offset := s.where, s.orderBy, s.limit, s.offset
+	defer func() {
+		s.where, s.orderBy, s.limit, s.offset = where, orderBy, limit, offset
+	}()
+
+	if it.last != nil {
+		s.where = append(append(make([]Predicate, 0, len(where)+1), where...), C(it.keyset).GT(it.last))
+	}
+	s.orderBy = []OrderBy{Asc(it.keyset)}
+	s.limit = it.batchSize
+	s.offset = 0
+	return s.Build()
+}
+
+// Next 移动到下一行, 并且把这一行写入 T
+// 返回 false 代表没有数据了, 或者出错了, 需要通过 Err 来判断
+func (it *Iterator[T]) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	if !it.rows.Next() {
+		if it.err = it.s.db.dialect.translateErr(it.rows.Err()); it.err != nil {
+			return false
+		}
+		// keyset 模式下, 这一批是满的, 说明可能还有下一批
+		if it.keyset == "" || it.batchCnt < it.batchSize {
+			return false
+		}
+		_ = it.rows.Close()
+		if it.err = it.query(); it.err != nil {
+			return false
+		}
+		if !it.rows.Next() {
+			it.err = it.s.db.dialect.translateErr(it.rows.Err())
+			return false
+		}
+	}
+	it.batchCnt++
+	it.cur, it.scanErr = it.scan()
+	return true
+}
+
+func (it *Iterator[T]) scan() (*T, error) {
+	var (
+		val *T
+		vl  valuer.Valuer
+	)
+	if it.reuse {
+		// 清空上一行的数据, 不然 NULL 或者没有查询的列会残留上一行的值
+		var zero T
+		*it.buf = zero
+		val, vl = it.buf, it.val
+	} else {
+		val = new(T)
+		vl = it.s.db.newValuer(val, it.meta)
+	}
+	if err := vl.SetColumns(it.rows); err != nil {
+		return nil, err
+	}
+	if err := afterQuery(it.ctx, val); err != nil {
+		return nil, err
+	}
+	if it.keyset != "" {
+		it.last = reflect.ValueOf(val).Elem().FieldByName(it.keyset).Interface()
+	}
+	return val, nil
+}
+
+// Scan 返回当前行
+func (it *Iterator[T]) Scan() (*T, error) {
+	return it.cur, it.scanErr
+}
+
+// Err 返回遍历过程中的错误
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Close 释放结果集, 可以重复调用
+func (it *Iterator[T]) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	// keyset 模式下, 查询下一批失败的时候 rows 是 nil
+	if it.rows == nil {
+		return nil
+	}
+	return it.rows.Close()
+}
@@ -0,0 +1,147 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func prepareIterDB(t *testing.T, dsn string, cnt int) *DB {
+	db, err := Open("sqlite3", dsn)
+	require.NoError(t, err)
+	_, err = db.db.Exec(TestModel{}.CreateSQL())
+	require.NoError(t, err)
+	for i := 1; i <= cnt; i++ {
+		_, err = db.db.Exec("INSERT INTO `test_model`(`id`,`first_name`,`age`,`last_name`) VALUES (?,?,?,?)",
+			i, fmt.Sprintf("name-%d", i), 18+i%3, "Ming")
+		require.NoError(t, err)
+	}
+	return db
+}
+
+func TestSelector_Iter(t *testing.T) {
+	db := prepareIterDB(t, "file:iter.db?cache=shared&mode=memory", 10)
+
+	testCases := []struct {
+		name    string
+		s       *Selector[TestModel]
+		opts    []IteratorOption
+		wantIds []int64
+		wantErr error
+	}{
+		{
+			name:    "all",
+			s:       NewSelector[TestModel](db),
+			wantIds: []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		},
+		{
+			name:    "reuse",
+			s:       NewSelector[TestModel](db).Where(C("Age").EQ(18)),
+			opts:    []IteratorOption{IterWithReuse()},
+			wantIds: []int64{3, 6, 9},
+		},
+		{
+			// 10 刚好不是 3 的整数倍, 最后一批不满
+			name:    "keyset",
+			s:       NewSelector[TestModel](db),
+			opts:    []IteratorOption{IterWithKeyset("Id", 3)},
+			wantIds: []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		},
+		{
+			// 最后一批刚好是满的, 还需要多查一次才知道没有数据了
+			name:    "keyset with where",
+			s:       NewSelector[TestModel](db).Where(C("Age").GT(18)),
+			opts:    []IteratorOption{IterWithKeyset("Id", 2), IterWithReuse()},
+			wantIds: []int64{1, 2, 4, 5, 7, 8, 10},
+		},
+		{
+			name:    "keyset invalid batch size",
+			s:       NewSelector[TestModel](db),
+			opts:    []IteratorOption{IterWithKeyset("Id", 0)},
+			wantErr: errs.ErrInvalidBatchSize,
+		},
+		{
+			name:    "keyset unknown field",
+			s:       NewSelector[TestModel](db),
+			opts:    []IteratorOption{IterWithKeyset("Invalid", 10)},
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+		{
+			name:    "keyset not selected",
+			s:       NewSelector[TestModel](db).Select(C("FirstName")),
+			opts:    []IteratorOption{IterWithKeyset("Id", 10)},
+			wantErr: errs.NewErrKeysetNotSelected("Id"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			it, err := tc.s.Iter(context.Background(), tc.opts...)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			defer func() {
+				require.NoError(t, it.Close())
+			}()
+			var ids []int64
+			for it.Next() {
+				val, err := it.Scan()
+				require.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("name-%d", val.Id), val.FirstName)
+				ids = append(ids, val.Id)
+			}
+			require.NoError(t, it.Err())
+			assert.Equal(t, tc.wantIds, ids)
+		})
+	}
+}
+
+func TestIterator_Reuse(t *testing.T) {
+	db := prepareIterDB(t, "file:iter_reuse.db?cache=shared&mode=memory", 2)
+	it, err := NewSelector[TestModel](db).Iter(context.Background(), IterWithReuse())
+	require.NoError(t, err)
+	defer func() {
+		_ = it.Close()
+	}()
+
+	require.True(t, it.Next())
+	first, err := it.Scan()
+	require.NoError(t, err)
+	require.True(t, it.Next())
+	second, err := it.Scan()
+	require.NoError(t, err)
+	// 复用的是同一个 T
+	assert.Same(t, first, second)
+	assert.Equal(t, int64(2), second.Id)
+	assert.False(t, it.Next())
+}
+
+func TestIterator_Err(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT .*").WillReturnError(sql.ErrConnDone)
+	_, err = NewSelector[TestModel](db).Iter(context.Background())
+	assert.Equal(t, sql.ErrConnDone, err)
+
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).RowError(1, sql.ErrTxDone)
+	mock.ExpectQuery("SELECT .*").WillReturnRows(rows)
+	it, err := NewSelector[TestModel](db).Iter(context.Background())
+	require.NoError(t, err)
+	assert.True(t, it.Next())
+	assert.False(t, it.Next())
+	assert.Equal(t, sql.ErrTxDone, it.Err())
+	require.NoError(t, it.Close())
+	require.NoError(t, it.Close())
+}
@@ -0,0 +1,226 @@
+package orm
+
+import (
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/model"
+	"reflect"
+)
+
+// join 连接一个嵌套的结构体对应的表
+type join struct {
+	typ   string
+	field string
+	on    []Predicate
+}
+
+// Join 用 JOIN 连接嵌套的结构体 field 对应的表, 用于查询 OrderWithUser{Order; User *User} 这种结构体
+// 例如 NewSelector[OrderWithUser](db).Join("User", C("Order.BuyerId").EQ(C("User.Id")))
+// 第一个嵌套的结构体是 FROM 后面的表, 其余的都需要 Join 或者 LeftJoin
+// 注意 on 不能为空, 并且一对多的时候 LIMIT 限制的是行数, 而不是合并之后的结构体的个数
+func (s *Selector[T]) Join(field string, on ...Predicate) *Selector[T] {
+	s.joins = append(s.joins, join{typ: "JOIN", field: field, on: on})
+	return s
+}
+
+// LeftJoin 用 LEFT JOIN 连接嵌套的结构体 field 对应的表
+// 没有匹配的时候, 结构体指针为 nil, 切片为空, 结构体为零值
+func (s *Selector[T]) LeftJoin(field string, on ...Predicate) *Selector[T] {
+	s.joins = append(s.joins, join{typ: "LEFT JOIN", field: field, on: on})
+	return s
+}
+
+// buildNestedColumns 查询所有嵌套结构体的列, 列名是 别名.列名, 例如 `o`.`id` AS `o.id`
+// 没有 JOIN 的嵌套结构体不查询
+func (s *Selector[T]) buildNestedColumns() {
+	first := true
+	for i, n := range s.m.Nested {
+		if s.tbl == "" && i > 0 && !s.joined(n.FieldName) {
+			continue
+		}
+		for _, fd := range n.Model.Fields {
+			if !first {
+				s.sb.WriteByte(',')
+			}
+			first = false
+			s.quote(n.Alias)
+			s.sb.WriteByte('.')
+			s.quote(fd.ColName)
+			s.buildNestedAlias(n, fd)
+		}
+	}
+}
+
+// buildNestedAlias 嵌套的结构体的列用 别名.列名 作为结果集的列名
+func (b *builder) buildNestedAlias(n *model.Nested, fd *model.Field) {
+	b.sb.WriteString(" AS ")
+	b.quote(n.Alias + "." + fd.ColName)
+}
+
+func (s *Selector[T]) joined(field string) bool {
+	for _, j := range s.joins {
+		if j.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// buildJoins 构造 `order` AS `o` JOIN `user` AS `u` ON ...
+// JOIN 的表的租户条件放在 ON 里面, 否则 LEFT JOIN 会变成 JOIN
+func (s *Selector[T]) buildJoins() error {
+	root := s.m.Nested[0]
+	s.buildTable(root)
+	for _, j := range s.joins {
+		n, ok := s.m.NestedOf(j.field)
+		if !ok || n == root {
+			return errs.NewErrInvalidNested(j.field)
+		}
+		s.sb.WriteByte(' ')
+		s.sb.WriteString(j.typ)
+		s.sb.WriteByte(' ')
+		s.buildTable(n)
+		on := j.on
+		p, err := s.nestedTenant(n)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			on = append(append(make([]Predicate, 0, len(on)+1), on...), *p)
+		}
+		if len(on) > 0 {
+			s.sb.WriteString(" ON ")
+			if err = s.buildPredicates(on); err != nil {
+				return err
+			}
+		}
+	}
+	for _, n := range s.m.Nested[1:] {
+		if !s.joined(n.FieldName) {
+			return errs.NewErrNotJoined(n.FieldName)
+		}
+	}
+	return nil
+}
+
+func (s *Selector[T]) buildTable(n *model.Nested) {
+	s.quote(n.Model.TableName)
+	s.sb.WriteString(" AS ")
+	s.quote(n.Alias)
+}
+
+// nestedWhere 在 where 的基础上加上嵌套结构体的租户条件
+// 用 From 自己写 JOIN 的时候, 所有嵌套结构体的租户条件都放在 WHERE 里面
+func (s *Selector[T]) nestedWhere(where []Predicate) ([]Predicate, error) {
+	nested := s.m.Nested
+	if s.tbl == "" {
+		nested = nested[:1]
+	}
+	for _, n := range nested {
+		p, err := s.nestedTenant(n)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			where = append(append(make([]Predicate, 0, len(where)+1), where...), *p)
+		}
+	}
+	return where, nil
+}
+
+// nestedTenant 嵌套结构体的租户条件, 例如 User.OrgId = ?
+func (s *Selector[T]) nestedTenant(n *model.Nested) (*Predicate, error) {
+	p, err := s.predicate(n.Model)
+	if err != nil || p == nil {
+		return p, err
+	}
+	res := C(n.FieldName + "." + n.Model.Tenant.FieldName).EQ(s.tenant)
+	return &res, nil
+}
+
+// merger 一对多的 JOIN 一个父结构体对应多行, 按照第一个嵌套结构体的主键合并
+type merger struct {
+	root   *model.Nested
+	slices []*model.Nested
+	// parents key 是主键
+	parents map[any]reflect.Value
+	// seen 已经追加到切片里面的元素, 同时 JOIN 多个切片的时候会有重复的行
+	seen map[mergeKey]struct{}
+}
+
+type mergeKey struct {
+	parent any
+	field  string
+	child  any
+}
+
+// newMerger 没有切片的时候返回 nil, 每一行都是一个结构体
+func newMerger(m *model.Model) *merger {
+	var slices []*model.Nested
+	for _, n := range m.Nested {
+		if n.Kind == model.NestedSlice {
+			slices = append(slices, n)
+		}
+	}
+	if len(slices) == 0 {
+		return nil
+	}
+	return &merger{
+		root:    m.Nested[0],
+		slices:  slices,
+		parents: make(map[any]reflect.Value, 8),
+		seen:    make(map[mergeKey]struct{}, 8),
+	}
+}
+
+// merge val 是指向结构体的指针, 返回 true 代表 val 合并到了前面的行里面
+func (mg *merger) merge(val any) bool {
+	if mg == nil {
+		return false
+	}
+	v := reflect.ValueOf(val).Elem()
+	root := reflect.Indirect(v.FieldByName(mg.root.FieldName))
+	// LEFT JOIN 的时候第一个嵌套的结构体也可能是 nil
+	if !root.IsValid() {
+		return false
+	}
+	key := root.FieldByName(mg.root.Model.PrimaryKey.FieldName).Interface()
+	parent, ok := mg.parents[key]
+	if !ok {
+		mg.parents[key] = v
+		for _, n := range mg.slices {
+			children := v.FieldByName(n.FieldName)
+			for i := 0; i < children.Len(); i++ {
+				mg.add(key, n, children.Index(i))
+			}
+		}
+		return false
+	}
+	for _, n := range mg.slices {
+		children, dst := v.FieldByName(n.FieldName), parent.FieldByName(n.FieldName)
+		for i := 0; i < children.Len(); i++ {
+			if child := children.Index(i); mg.add(key, n, child) {
+				dst.Set(reflect.Append(dst, child))
+			}
+		}
+	}
+	return true
+}
+
+// add 记录 parent 的切片 n 里面的 child, 已经有了则返回 false
+// 没有主键的时候没办法去重, 总是返回 true
+func (mg *merger) add(parent any, n *model.Nested, child reflect.Value) bool {
+	pk := n.Model.PrimaryKey
+	if pk == nil {
+		return true
+	}
+	key := mergeKey{
+		parent: parent,
+		field:  n.FieldName,
+		child:  reflect.Indirect(child).FieldByName(pk.FieldName).Interface(),
+	}
+	if _, ok := mg.seen[key]; ok {
+		return false
+	}
+	mg.seen[key] = struct{}{}
+	return true
+}
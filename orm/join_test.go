@@ -0,0 +1,237 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type JoinOrder struct {
+	Id      int64
+	BuyerId int64
+	Amount  int
+}
+
+type JoinUser struct {
+	Id   int64
+	Name string
+}
+
+type JoinItem struct {
+	Id      int64
+	OrderId int64
+	Sku     string
+}
+
+type OrderWithUser struct {
+	JoinOrder `orm:"alias=o"`
+	User      *JoinUser `orm:"alias=u"`
+}
+
+type OrderWithBuyer struct {
+	JoinOrder `orm:"alias=o"`
+	Buyer     JoinUser `orm:"alias=u"`
+}
+
+type OrderWithItems struct {
+	JoinOrder `orm:"alias=o"`
+	User      *JoinUser   `orm:"alias=u"`
+	Items     []*JoinItem `orm:"alias=i"`
+}
+
+type TenantOrderWithItems struct {
+	TenantOrder `orm:"alias=o"`
+	Items       []*TenantItem `orm:"alias=i"`
+}
+
+func TestSelector_Join(t *testing.T) {
+	db, err := OpenDB(nil)
+	require.NoError(t, err)
+	orderCols := "`o`.`id` AS `o.id`,`o`.`buyer_id` AS `o.buyer_id`,`o`.`amount` AS `o.amount`"
+	userCols := "`u`.`id` AS `u.id`,`u`.`name` AS `u.name`"
+
+	testCases := []struct {
+		name      string
+		build     func() (*Query, error)
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "join",
+			build: NewSelector[OrderWithUser](db).
+				Join("User", C("JoinOrder.BuyerId").EQ(C("User.Id"))).
+				Where(C("User.Name").EQ("Tom")).
+				OrderBy(Desc("JoinOrder.Amount")).Build,
+			wantQuery: &Query{
+				SQL: "SELECT " + orderCols + "," + userCols +
+					" FROM `join_order` AS `o` JOIN `join_user` AS `u` ON `o`.`buyer_id` = `u`.`id`" +
+					" WHERE `u`.`name` = ? ORDER BY `o`.`amount` DESC;",
+				Args: []any{"Tom"},
+			},
+		},
+		{
+			name: "left join",
+			build: NewSelector[OrderWithItems](db).
+				LeftJoin("User", C("JoinOrder.BuyerId").EQ(C("User.Id"))).
+				LeftJoin("Items", C("JoinOrder.Id").EQ(C("Items.OrderId"))).Build,
+			wantQuery: &Query{
+				SQL: "SELECT " + orderCols + "," + userCols +
+					",`i`.`id` AS `i.id`,`i`.`order_id` AS `i.order_id`,`i`.`sku` AS `i.sku`" +
+					" FROM `join_order` AS `o` LEFT JOIN `join_user` AS `u` ON `o`.`buyer_id` = `u`.`id`" +
+					" LEFT JOIN `join_item` AS `i` ON `o`.`id` = `i`.`order_id`;",
+			},
+		},
+		{
+			// 指定的列也用 别名.列名 作为结果集的列名
+			name: "select",
+			build: NewSelector[OrderWithUser](db).
+				Select(C("JoinOrder.Id"), C("User.Name")).
+				Join("User", C("JoinOrder.BuyerId").EQ(C("User.Id"))).Build,
+			wantQuery: &Query{
+				SQL: "SELECT `o`.`id` AS `o.id`,`u`.`name` AS `u.name`" +
+					" FROM `join_order` AS `o` JOIN `join_user` AS `u` ON `o`.`buyer_id` = `u`.`id`;",
+			},
+		},
+		{
+			// 自己写 JOIN 的时候查询全部嵌套结构体的列
+			name: "from",
+			build: NewSelector[OrderWithUser](db).
+				From("`join_order` AS `o` JOIN `join_user` AS `u` ON `o`.`buyer_id` = `u`.`id`").Build,
+			wantQuery: &Query{
+				SQL: "SELECT " + orderCols + "," + userCols +
+					" FROM `join_order` AS `o` JOIN `join_user` AS `u` ON `o`.`buyer_id` = `u`.`id`;",
+			},
+		},
+		{
+			name: "tenant",
+			build: func() (*Query, error) {
+				s := NewSelector[TenantOrderWithItems](db).
+					LeftJoin("Items", C("TenantOrder.Id").EQ(C("Items.OrderId")))
+				s.from(WithTenant(context.Background(), 12))
+				return s.Build()
+			},
+			wantQuery: &Query{
+				SQL: "SELECT `o`.`id` AS `o.id`,`o`.`tenant_id` AS `o.tenant_id`,`o`.`amount` AS `o.amount`" +
+					",`i`.`id` AS `i.id`,`i`.`order_id` AS `i.order_id`,`i`.`tenant_id` AS `i.tenant_id`" +
+					" FROM `tenant_order` AS `o` LEFT JOIN `tenant_item` AS `i`" +
+					" ON (`o`.`id` = `i`.`order_id`) AND (`i`.`tenant_id` = ?)" +
+					" WHERE `o`.`tenant_id` = ?;",
+				Args: []any{12, 12},
+			},
+		},
+		{
+			name:    "not joined",
+			build:   NewSelector[OrderWithUser](db).Build,
+			wantErr: errs.NewErrNotJoined("User"),
+		},
+		{
+			name:    "join root",
+			build:   NewSelector[OrderWithUser](db).Join("JoinOrder").Build,
+			wantErr: errs.NewErrInvalidNested("JoinOrder"),
+		},
+		{
+			name: "unknown field",
+			build: NewSelector[OrderWithUser](db).
+				Join("User", C("JoinOrder.BuyerId").EQ(C("User.Age"))).Build,
+			wantErr: errs.NewErrUnknownField("User.Age"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestSelector_Join_sqlite(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []DBOption
+	}{
+		{name: "unsafe"},
+		{name: "reflect", opts: []DBOption{DBWithReflectValuer()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := Open("sqlite3", "file:join_"+tc.name+".db?cache=shared&mode=memory", tc.opts...)
+			require.NoError(t, err)
+			for _, stmt := range []string{
+				"CREATE TABLE join_order(id INTEGER PRIMARY KEY, buyer_id INTEGER, amount INTEGER)",
+				"CREATE TABLE join_user(id INTEGER PRIMARY KEY, name TEXT)",
+				"CREATE TABLE join_item(id INTEGER PRIMARY KEY, order_id INTEGER, sku TEXT)",
+				"INSERT INTO join_order VALUES (1, 1, 100), (2, 2, 200), (3, 3, 300)",
+				"INSERT INTO join_user VALUES (1, 'Tom'), (2, 'Jerry')",
+				"INSERT INTO join_item VALUES (1, 1, 'a'), (2, 1, 'b'), (3, 2, 'c')",
+			} {
+				_, err = db.db.Exec(stmt)
+				require.NoError(t, err)
+			}
+			ctx := context.Background()
+
+			res, err := NewSelector[OrderWithUser](db).
+				Join("User", C("JoinOrder.BuyerId").EQ(C("User.Id"))).
+				Where(C("User.Name").EQ("Jerry")).Get(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, &OrderWithUser{
+				JoinOrder: JoinOrder{Id: 2, BuyerId: 2, Amount: 200},
+				User:      &JoinUser{Id: 2, Name: "Jerry"},
+			}, res)
+
+			// 一对多按照订单合并, 没有匹配的用户是 nil, 没有匹配的订单项是空切片
+			orders, err := NewSelector[OrderWithItems](db).
+				LeftJoin("User", C("JoinOrder.BuyerId").EQ(C("User.Id"))).
+				LeftJoin("Items", C("JoinOrder.Id").EQ(C("Items.OrderId"))).
+				OrderBy(Asc("JoinOrder.Id"), Asc("Items.Id")).GetMulti(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []*OrderWithItems{
+				{
+					JoinOrder: JoinOrder{Id: 1, BuyerId: 1, Amount: 100},
+					User:      &JoinUser{Id: 1, Name: "Tom"},
+					Items:     []*JoinItem{{Id: 1, OrderId: 1, Sku: "a"}, {Id: 2, OrderId: 1, Sku: "b"}},
+				},
+				{
+					JoinOrder: JoinOrder{Id: 2, BuyerId: 2, Amount: 200},
+					User:      &JoinUser{Id: 2, Name: "Jerry"},
+					Items:     []*JoinItem{{Id: 3, OrderId: 2, Sku: "c"}},
+				},
+				{
+					JoinOrder: JoinOrder{Id: 3, BuyerId: 3, Amount: 300},
+				},
+			}, orders)
+
+			// 组合的结构体没有匹配的时候是零值
+			buyers, err := NewSelector[OrderWithBuyer](db).
+				LeftJoin("Buyer", C("JoinOrder.BuyerId").EQ(C("Buyer.Id"))).
+				OrderBy(Asc("JoinOrder.Id")).GetMulti(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []*OrderWithBuyer{
+				{JoinOrder: JoinOrder{Id: 1, BuyerId: 1, Amount: 100}, Buyer: JoinUser{Id: 1, Name: "Tom"}},
+				{JoinOrder: JoinOrder{Id: 2, BuyerId: 2, Amount: 200}, Buyer: JoinUser{Id: 2, Name: "Jerry"}},
+				{JoinOrder: JoinOrder{Id: 3, BuyerId: 3, Amount: 300}},
+			}, buyers)
+
+			// 一对多的时候 Count 返回的是订单的个数, 而不是行数
+			cnt, err := NewSelector[OrderWithItems](db).
+				LeftJoin("User", C("JoinOrder.BuyerId").EQ(C("User.Id"))).
+				LeftJoin("Items", C("JoinOrder.Id").EQ(C("Items.OrderId"))).Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), cnt)
+
+			// Get 也会合并属于同一个订单的行
+			order, err := NewSelector[OrderWithItems](db).
+				LeftJoin("User", C("JoinOrder.BuyerId").EQ(C("User.Id"))).
+				LeftJoin("Items", C("JoinOrder.Id").EQ(C("Items.OrderId"))).
+				Where(C("JoinOrder.Id").EQ(1)).Get(ctx)
+			require.NoError(t, err)
+			assert.Len(t, order.Items, 2)
+		})
+	}
+}
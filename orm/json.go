@@ -0,0 +1,251 @@
+package orm
+
+import (
+	"encoding/json"
+	"geektime-go-study/orm/internal/errs"
+	"strconv"
+	"strings"
+)
+
+type jsonFn uint8
+
+const (
+	jsonExtract jsonFn = iota
+	jsonLength
+	jsonContains
+)
+
+// JSONExpr JSON 列上的表达式, 例如 C("Profile").JSON("$.address.city")
+// 列里面保存的是 JSON 字符串, PostgreSQL 上要求是 jsonb 类型
+type JSONExpr struct {
+	fn   jsonFn
+	col  Column
+	path string
+	// val JSONContains 要查找的值
+	val any
+}
+
+func (JSONExpr) expr() {}
+
+func (JSONExpr) selectable() {}
+
+// JSON 取出 JSON 列里面 path 对应的值
+// path 是 MySQL 的写法, 例如 $.address.city, $.tags[0], 在别的数据库上会被转换
+// PostgreSQL 取出来的值是文本
+func (c Column) JSON(path string) JSONExpr {
+	return JSONExpr{fn: jsonExtract, col: c, path: path}
+}
+
+// JSONLength JSON 数组的长度, path 为 $ 的时候是整个列
+func (c Column) JSONLength(path string) JSONExpr {
+	return JSONExpr{fn: jsonLength, col: c, path: path}
+}
+
+// JSONContains path 对应的 JSON 数组里面是否有 val
+// 例如 C("Profile").JSONContains("$.tags", "golang")
+// SQLite 只支持 val 是数字, 字符串这种标量
+func (c Column) JSONContains(path string, val any) Predicate {
+	return Predicate{
+		left: JSONExpr{fn: jsonContains, col: c, path: path, val: val},
+	}
+}
+
+func (j JSONExpr) EQ(arg any) Predicate {
+	return Predicate{
+		left:  j,
+		op:    opEQ,
+		right: exprOf(arg),
+	}
+}
+
+func (j JSONExpr) LT(arg any) Predicate {
+	return Predicate{
+		left:  j,
+		op:    opLT,
+		right: exprOf(arg),
+	}
+}
+
+func (j JSONExpr) GT(arg any) Predicate {
+	return Predicate{
+		left:  j,
+		op:    opGT,
+		right: exprOf(arg),
+	}
+}
+
+func (j JSONExpr) In(vals ...any) Predicate {
+	return Predicate{
+		left:  j,
+		op:    opIN,
+		right: values{vals: vals},
+	}
+}
+
+// jsonPathSeg path 中的一段, 要么是 key, 要么是数组下标
+type jsonPathSeg struct {
+	key   string
+	index int
+}
+
+// parseJSONPath 解析 $.address.city, $.tags[0] 这种路径
+// path 会原样拼接到 SQL 里面, 所以 key 只允许字母, 数字和下划线
+func parseJSONPath(path string) ([]jsonPathSeg, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errs.NewErrInvalidJSONPath(path)
+	}
+	var res []jsonPathSeg
+	for rest := path[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := 1
+			for end < len(rest) && isJSONKeyChar(rest[end]) {
+				end++
+			}
+			if end == 1 {
+				return nil, errs.NewErrInvalidJSONPath(path)
+			}
+			res = append(res, jsonPathSeg{key: rest[1:end], index: -1})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errs.NewErrInvalidJSONPath(path)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil || idx < 0 {
+				return nil, errs.NewErrInvalidJSONPath(path)
+			}
+			res = append(res, jsonPathSeg{index: idx})
+			rest = rest[end+1:]
+		default:
+			return nil, errs.NewErrInvalidJSONPath(path)
+		}
+	}
+	return res, nil
+}
+
+func isJSONKeyChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// buildJSONFunc 构造 fn(col, 'path') 这种形式, MySQL 和 SQLite 都是这种形式
+func (b *builder) buildJSONFunc(fn string, e JSONExpr) error {
+	if _, err := parseJSONPath(e.path); err != nil {
+		return err
+	}
+	b.sb.WriteString(fn)
+	b.sb.WriteByte('(')
+	if err := b.buildColumn(e.col); err != nil {
+		return err
+	}
+	b.sb.WriteString(", '")
+	b.sb.WriteString(e.path)
+	b.sb.WriteString("')")
+	return nil
+}
+
+func (mysqlDialect) buildJSON(b *builder, e JSONExpr) error {
+	switch e.fn {
+	case jsonLength:
+		return b.buildJSONFunc("JSON_LENGTH", e)
+	case jsonContains:
+		// JSON_CONTAINS(col, ?, 'path'), 要查找的值也是 JSON
+		if _, err := parseJSONPath(e.path); err != nil {
+			return err
+		}
+		val, err := json.Marshal(e.val)
+		if err != nil {
+			return err
+		}
+		b.sb.WriteString("JSON_CONTAINS(")
+		if err = b.buildColumn(e.col); err != nil {
+			return err
+		}
+		b.sb.WriteString(", ?, '")
+		b.sb.WriteString(e.path)
+		b.sb.WriteString("')")
+		b.addArgs(string(val))
+		return nil
+	default:
+		return b.buildJSONFunc("JSON_EXTRACT", e)
+	}
+}
+
+func (sqlite3Dialect) buildJSON(b *builder, e JSONExpr) error {
+	switch e.fn {
+	case jsonLength:
+		return b.buildJSONFunc("JSON_ARRAY_LENGTH", e)
+	case jsonContains:
+		// SQLite 没有 JSON_CONTAINS, 用 JSON_EACH 展开数组
+		b.sb.WriteString("EXISTS (SELECT 1 FROM ")
+		if err := b.buildJSONFunc("JSON_EACH", e); err != nil {
+			return err
+		}
+		b.sb.WriteString(" WHERE value = ?)")
+		b.addArgs(e.val)
+		return nil
+	default:
+		return b.buildJSONFunc("JSON_EXTRACT", e)
+	}
+}
+
+// buildJSON PostgreSQL 用 -> 和 ->> 运算符, 要求列是 jsonb
+// 例如 $.address.city 转为 "profile"->'address'->>'city'
+func (postgresDialect) buildJSON(b *builder, e JSONExpr) error {
+	segs, err := parseJSONPath(e.path)
+	if err != nil {
+		return err
+	}
+	switch e.fn {
+	case jsonLength:
+		b.sb.WriteString("jsonb_array_length(")
+		if err = b.buildJSONPath(e.col, segs, false); err != nil {
+			return err
+		}
+		b.sb.WriteByte(')')
+		return nil
+	case jsonContains:
+		val, err := json.Marshal(e.val)
+		if err != nil {
+			return err
+		}
+		if err = b.buildJSONPath(e.col, segs, false); err != nil {
+			return err
+		}
+		b.sb.WriteString(" @> ?::jsonb")
+		b.addArgs(string(val))
+		return nil
+	default:
+		if len(segs) == 0 {
+			// 整个列转为文本
+			if err = b.buildColumn(e.col); err != nil {
+				return err
+			}
+			b.sb.WriteString("#>>'{}'")
+			return nil
+		}
+		return b.buildJSONPath(e.col, segs, true)
+	}
+}
+
+// buildJSONPath 构造 "col"->'a'->'b', text 为 true 的时候最后一段用 ->> 取出文本
+func (b *builder) buildJSONPath(col Column, segs []jsonPathSeg, text bool) error {
+	if err := b.buildColumn(col); err != nil {
+		return err
+	}
+	for i, seg := range segs {
+		b.sb.WriteString("->")
+		if text && i == len(segs)-1 {
+			b.sb.WriteByte('>')
+		}
+		if seg.key == "" {
+			b.sb.WriteString(strconv.Itoa(seg.index))
+			continue
+		}
+		b.sb.WriteByte('\'')
+		b.sb.WriteString(seg.key)
+		b.sb.WriteByte('\'')
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type JsonUser struct {
+	Id      int64
+	Profile string
+}
+
+func TestSelector_JSON(t *testing.T) {
+	mysqlDB, err := OpenDB(nil, DBWithDialect(DialectMySQL))
+	require.NoError(t, err)
+	sqliteDB, err := OpenDB(nil, DBWithDialect(DialectSQLite))
+	require.NoError(t, err)
+	pgDB, err := OpenDB(nil, DBWithDialect(DialectPostgreSQL))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		db        *DB
+		where     []Predicate
+		columns   []Selectable
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name:  "mysql extract",
+			db:    mysqlDB,
+			where: []Predicate{C("Profile").JSON("$.address.city").EQ("Paris")},
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `json_user` WHERE JSON_EXTRACT(`profile`, '$.address.city') = ?;",
+				Args: []any{"Paris"},
+			},
+		},
+		{
+			name:  "mysql length",
+			db:    mysqlDB,
+			where: []Predicate{C("Profile").JSONLength("$.tags").GT(2)},
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `json_user` WHERE JSON_LENGTH(`profile`, '$.tags') > ?;",
+				Args: []any{2},
+			},
+		},
+		{
+			// 要查找的值序列化为 JSON
+			name:  "mysql contains",
+			db:    mysqlDB,
+			where: []Predicate{C("Profile").JSONContains("$.tags", "golang").And(C("Id").GT(1))},
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `json_user` WHERE (JSON_CONTAINS(`profile`, ?, '$.tags')) AND (`id` > ?);",
+				Args: []any{`"golang"`, 1},
+			},
+		},
+		{
+			name:    "mysql select",
+			db:      mysqlDB,
+			columns: []Selectable{C("Id"), C("Profile").JSON("$.tags[0]")},
+			wantQuery: &Query{
+				SQL: "SELECT `id`,JSON_EXTRACT(`profile`, '$.tags[0]') FROM `json_user`;",
+			},
+		},
+		{
+			name:  "sqlite extract",
+			db:    sqliteDB,
+			where: []Predicate{C("Profile").JSON("$.address.city").In("Paris", "London")},
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `json_user` WHERE JSON_EXTRACT(`profile`, '$.address.city') IN (?,?);",
+				Args: []any{"Paris", "London"},
+			},
+		},
+		{
+			name:  "sqlite length",
+			db:    sqliteDB,
+			where: []Predicate{C("Profile").JSONLength("$.tags").LT(2)},
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `json_user` WHERE JSON_ARRAY_LENGTH(`profile`, '$.tags') < ?;",
+				Args: []any{2},
+			},
+		},
+		{
+			name:  "sqlite contains",
+			db:    sqliteDB,
+			where: []Predicate{Not(C("Profile").JSONContains("$.tags", "golang"))},
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `json_user` WHERE  NOT (EXISTS (SELECT 1 FROM JSON_EACH(`profile`, '$.tags') WHERE value = ?));",
+				Args: []any{"golang"},
+			},
+		},
+		{
+			name:  "postgres extract",
+			db:    pgDB,
+			where: []Predicate{C("Profile").JSON("$.address.city").EQ("Paris")},
+			wantQuery: &Query{
+				SQL:  `SELECT * FROM "json_user" WHERE "profile"->'address'->>'city' = ?;`,
+				Args: []any{"Paris"},
+			},
+		},
+		{
+			name:  "postgres extract index",
+			db:    pgDB,
+			where: []Predicate{C("Profile").JSON("$.tags[1]").EQ("golang")},
+			wantQuery: &Query{
+				SQL:  `SELECT * FROM "json_user" WHERE "profile"->'tags'->>1 = ?;`,
+				Args: []any{"golang"},
+			},
+		},
+		{
+			name:  "postgres extract root",
+			db:    pgDB,
+			where: []Predicate{C("Profile").JSON("$").EQ("{}")},
+			wantQuery: &Query{
+				SQL:  `SELECT * FROM "json_user" WHERE "profile"#>>'{}' = ?;`,
+				Args: []any{"{}"},
+			},
+		},
+		{
+			name:  "postgres length",
+			db:    pgDB,
+			where: []Predicate{C("Profile").JSONLength("$.tags").GT(2)},
+			wantQuery: &Query{
+				SQL:  `SELECT * FROM "json_user" WHERE jsonb_array_length("profile"->'tags') > ?;`,
+				Args: []any{2},
+			},
+		},
+		{
+			name:  "postgres contains",
+			db:    pgDB,
+			where: []Predicate{C("Profile").JSONContains("$.tags", "golang")},
+			wantQuery: &Query{
+				SQL:  `SELECT * FROM "json_user" WHERE "profile"->'tags' @> ?::jsonb;`,
+				Args: []any{`"golang"`},
+			},
+		},
+		{
+			name:    "unknown field",
+			db:      mysqlDB,
+			where:   []Predicate{C("Invalid").JSON("$.a").EQ(1)},
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+		{
+			// path 会拼接到 SQL 里面, 不能有引号
+			name:    "invalid path",
+			db:      mysqlDB,
+			where:   []Predicate{C("Profile").JSON("$.a') OR 1=1 --").EQ(1)},
+			wantErr: errs.NewErrInvalidJSONPath("$.a') OR 1=1 --"),
+		},
+		{
+			name:    "postgres invalid path",
+			db:      pgDB,
+			where:   []Predicate{C("Profile").JSON("address.city").EQ(1)},
+			wantErr: errs.NewErrInvalidJSONPath("address.city"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := NewSelector[JsonUser](tc.db).Select(tc.columns...).Where(tc.where...).Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		wantSegs []jsonPathSeg
+		wantErr  error
+	}{
+		{
+			name: "root",
+			path: "$",
+		},
+		{
+			name: "keys and index",
+			path: "$.tags[10].name_1",
+			wantSegs: []jsonPathSeg{
+				{key: "tags", index: -1},
+				{index: 10},
+				{key: "name_1", index: -1},
+			},
+		},
+		{
+			name:    "empty key",
+			path:    "$..a",
+			wantErr: errs.NewErrInvalidJSONPath("$..a"),
+		},
+		{
+			name:    "negative index",
+			path:    "$[-1]",
+			wantErr: errs.NewErrInvalidJSONPath("$[-1]"),
+		},
+		{
+			name:    "unclosed index",
+			path:    "$.tags[0",
+			wantErr: errs.NewErrInvalidJSONPath("$.tags[0"),
+		},
+		{
+			name:    "wildcard",
+			path:    "$.tags[*]",
+			wantErr: errs.NewErrInvalidJSONPath("$.tags[*]"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			segs, err := parseJSONPath(tc.path)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantSegs, segs)
+		})
+	}
+}
+
+func TestJSON_sqlite(t *testing.T) {
+	db, err := Open("sqlite3", "file:json.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE json_user(id INTEGER PRIMARY KEY, profile TEXT)",
+		`INSERT INTO json_user(id, profile) VALUES
+(1, '{"address": {"city": "Paris"}, "tags": ["golang", "orm"]}'),
+(2, '{"address": {"city": "London"}, "tags": ["java"]}'),
+(3, '{"address": {"city": "Paris"}, "tags": []}')`,
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+
+	ids, err := Pluck[JsonUser, int64](ctx, NewSelector[JsonUser](db).
+		Where(C("Profile").JSON("$.address.city").EQ("Paris")).OrderBy(Asc("Id")), C("Id"))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, ids)
+
+	ids, err = Pluck[JsonUser, int64](ctx, NewSelector[JsonUser](db).
+		Where(C("Profile").JSONLength("$.tags").GT(0)).OrderBy(Asc("Id")), C("Id"))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+
+	ids, err = Pluck[JsonUser, int64](ctx, NewSelector[JsonUser](db).
+		Where(C("Profile").JSONContains("$.tags", "golang")), C("Id"))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids)
+
+	city, err := Scalar[JsonUser, string](ctx, NewSelector[JsonUser](db).Where(C("Id").EQ(2)),
+		C("Profile").JSON("$.address.city"))
+	require.NoError(t, err)
+	assert.Equal(t, "London", city)
+}
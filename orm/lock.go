@@ -0,0 +1,99 @@
+package orm
+
+import "geektime-go-study/orm/internal/errs"
+
+type lockMode uint8
+
+const (
+	lockNone lockMode = iota
+	lockForUpdate
+	lockForShare
+)
+
+// lockWait 拿不到锁的时候怎么办
+type lockWait uint8
+
+const (
+	// lockWaitDefault 一直等到超时
+	lockWaitDefault lockWait = iota
+	lockNoWait
+	lockSkipLocked
+)
+
+type lockClause struct {
+	mode lockMode
+	wait lockWait
+}
+
+// ForUpdate 加排他锁, 只能在事务中使用
+func (s *Selector[T]) ForUpdate() *Selector[T] {
+	s.lock.mode = lockForUpdate
+	return s
+}
+
+// ForShare 加共享锁, 只能在事务中使用
+func (s *Selector[T]) ForShare() *Selector[T] {
+	s.lock.mode = lockForShare
+	return s
+}
+
+// NoWait 拿不到锁立刻返回错误, 而不是等待, 必须和 ForUpdate 或者 ForShare 一起使用
+// MySQL 返回的错误会被翻译为 ErrLockTimeout
+func (s *Selector[T]) NoWait() *Selector[T] {
+	s.lock.wait = lockNoWait
+	return s
+}
+
+// SkipLocked 跳过已经被锁住的行, 必须和 ForUpdate 或者 ForShare 一起使用
+// 典型的场景是多个 worker 从同一张表里面抢任务:
+//
+//	tx, err := db.BeginTx(ctx, nil)
+//	job, err := NewSelector[Job](tx).Where(C("Status").EQ("pending")).
+//		Limit(1).ForUpdate().SkipLocked().Get(ctx)
+func (s *Selector[T]) SkipLocked() *Selector[T] {
+	s.lock.wait = lockSkipLocked
+	return s
+}
+
+// buildLock 锁只在事务中有意义, 不在事务中的话锁在语句执行完就释放了
+// 所以这里直接返回错误, 而不是等到出现并发问题才发现
+func (s *Selector[T]) buildLock() error {
+	if s.lock.mode == lockNone {
+		if s.lock.wait != lockWaitDefault {
+			return errs.ErrLockWaitWithoutLock
+		}
+		return nil
+	}
+	if _, ok := s.sess.(*Tx); !ok {
+		return errs.ErrLockOutsideTx
+	}
+	return s.db.dialect.buildLock(&s.builder, s.lock)
+}
+
+func (mysqlDialect) buildLock(b *builder, lock lockClause) error {
+	switch lock.mode {
+	case lockForUpdate:
+		b.sb.WriteString(" FOR UPDATE")
+	case lockForShare:
+		// MySQL 8.0 之前是 LOCK IN SHARE MODE, 它不支持 NOWAIT 和 SKIP LOCKED
+		b.sb.WriteString(" FOR SHARE")
+	}
+	switch lock.wait {
+	case lockNoWait:
+		b.sb.WriteString(" NOWAIT")
+	case lockSkipLocked:
+		b.sb.WriteString(" SKIP LOCKED")
+	}
+	return nil
+}
+
+// buildLock SQLite 是库级别的锁, 没有行锁
+// 需要互斥的话应该使用 BEGIN IMMEDIATE 这种事务
+func (sqlite3Dialect) buildLock(b *builder, lock lockClause) error {
+	return errs.NewErrUnsupportedLock("SQLite")
+}
+
+// buildLock PostgreSQL 暂时不支持
+func (postgresDialect) buildLock(b *builder, lock lockClause) error {
+	return errs.NewErrUnsupportedLock("PostgreSQL")
+}
@@ -0,0 +1,141 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type LockJob struct {
+	Id     int64
+	Status string
+}
+
+func TestSelector_Lock(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectMySQL))
+	require.NoError(t, err)
+	mock.ExpectBegin()
+	tx, err := db.BeginTx(context.Background(), nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "for update",
+			q:    NewSelector[LockJob](tx).Where(C("Id").EQ(1)).ForUpdate(),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `lock_job` WHERE `id` = ? FOR UPDATE;",
+				Args: []any{1},
+			},
+		},
+		{
+			name: "for share",
+			q:    NewSelector[LockJob](tx).ForShare(),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM `lock_job` FOR SHARE;",
+			},
+		},
+		{
+			name: "nowait",
+			q:    NewSelector[LockJob](tx).ForUpdate().NoWait(),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM `lock_job` FOR UPDATE NOWAIT;",
+			},
+		},
+		{
+			name: "skip locked",
+			q: NewSelector[LockJob](tx).Where(C("Status").EQ("pending")).
+				Limit(1).ForUpdate().SkipLocked(),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `lock_job` WHERE `status` = ? LIMIT ? FOR UPDATE SKIP LOCKED;",
+				Args: []any{"pending", 1},
+			},
+		},
+		{
+			name:    "outside tx",
+			q:       NewSelector[LockJob](db).ForUpdate(),
+			wantErr: errs.ErrLockOutsideTx,
+		},
+		{
+			name:    "skip locked without lock",
+			q:       NewSelector[LockJob](tx).SkipLocked(),
+			wantErr: errs.ErrLockWaitWithoutLock,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestSelector_Lock_sqlite(t *testing.T) {
+	db := memoryDB(t)
+	tx, err := db.BeginTx(context.Background(), nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	_, err = NewSelector[LockJob](tx).ForUpdate().Build()
+	assert.Equal(t, errs.NewErrUnsupportedLock("SQLite"), err)
+}
+
+func TestSelector_Lock_exec(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectMySQL))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// 抢到任务
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `lock_job` WHERE `status` = \\? LIMIT \\? FOR UPDATE SKIP LOCKED;").
+		WithArgs("pending", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "pending"))
+	mock.ExpectCommit()
+	err = db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+		job, err := NewSelector[LockJob](tx).Where(C("Status").EQ("pending")).
+			Limit(1).ForUpdate().SkipLocked().Get(ctx)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, &LockJob{Id: 1, Status: "pending"}, job)
+		return nil
+	}, nil)
+	require.NoError(t, err)
+
+	// NOWAIT 拿不到锁, 回滚
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `lock_job` FOR UPDATE NOWAIT;").
+		WillReturnError(&mysql.MySQLError{Number: 3572})
+	mock.ExpectRollback()
+	err = db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+		_, err := NewSelector[LockJob](tx).ForUpdate().NoWait().Get(ctx)
+		return err
+	}, &sql.TxOptions{})
+	assert.ErrorIs(t, err, ErrLockTimeout)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
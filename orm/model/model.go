@@ -4,15 +4,58 @@ package model
 import (
 	"geektime-go-study/orm/internal/errs"
 	"reflect"
+	"strings"
 )
 
 // Model 元数据
 // Model是导出的原因是我们暴露了Register
 type Model struct {
 	TableName string            // 结构体对应的表名
+	Fields    []*Field          // 按照结构体中字段的顺序排列, 用于 INSERT 这种需要稳定顺序的场景
 	FieldMap  map[string]*Field // key: 字段名
 	ColMap    map[string]*Field // key: 列名
+	// Relations 关联关系, key: 字段名
+	// 关联字段不是列, 所以不会出现在 Fields, FieldMap 和 ColMap 里面
+	Relations map[string]*Relation
+	// Tenant 租户字段, 通过 orm:"tenant" 声明, 没有则为 nil
+	Tenant *Field
+	// PrimaryKey 主键, 通过 orm:"primary_key" 声明
+	// 没有声明的时候约定为 Id 字段, 都没有则为 nil
+	PrimaryKey *Field
+	// Nested 嵌套的结构体, 用于把 JOIN 的结果扫描到 OrderWithUser{Order; User *User} 这种结构体
+	// 按照结构体中字段的顺序排列, 第一个是 FROM 后面的表
+	Nested []*Nested
+}
 
+// FieldOf 根据字段名查找字段, 嵌套的结构体的字段是 字段名.字段名, 例如 User.Name
+// 返回的 *Nested 为 nil 代表是本模型自己的字段
+func (m *Model) FieldOf(name string) (*Nested, *Field, bool) {
+	if fd, ok := m.FieldMap[name]; ok {
+		return nil, fd, true
+	}
+	if len(m.Nested) == 0 {
+		return nil, nil, false
+	}
+	nested, name, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, nil, false
+	}
+	n, ok := m.NestedOf(nested)
+	if !ok {
+		return nil, nil, false
+	}
+	fd, ok := n.Model.FieldMap[name]
+	return n, fd, ok
+}
+
+// NestedOf 根据字段名查找嵌套的结构体
+func (m *Model) NestedOf(name string) (*Nested, bool) {
+	for _, n := range m.Nested {
+		if n.FieldName == name {
+			return n, true
+		}
+	}
+	return nil, false
 }
 
 // Field 字段
@@ -21,6 +64,67 @@ type Field struct {
 	FieldName string       // 字段名
 	FieldType reflect.Type // 字段类型
 	Offset    uintptr
+	// Encrypt 加密方式, 通过 orm:"encrypt" 声明
+	Encrypt EncryptMode
+}
+
+// EncryptMode 字段的加密方式
+type EncryptMode uint8
+
+const (
+	EncryptNone EncryptMode = iota
+	// EncryptRandom orm:"encrypt", 同样的明文每次加密的结果都不一样, 不能作为查询条件
+	EncryptRandom
+	// EncryptDeterministic orm:"encrypt=deterministic", 同样的明文加密结果一样, 可以用 EQ 和 IN 查询
+	// 代价是别人可以知道哪些行的值是相同的
+	EncryptDeterministic
+)
+
+// NestedKind 嵌套结构体的字段类型
+type NestedKind uint8
+
+const (
+	// NestedStruct 结构体, 例如组合的 Order, 直接根据偏移量写入
+	NestedStruct NestedKind = iota + 1
+	// NestedPtr 结构体指针, 例如 *User, LEFT JOIN 没有匹配的时候为 nil
+	NestedPtr
+	// NestedSlice 切片, 例如 []*Item, 一对多的多行按照第一个嵌套结构体的主键合并
+	NestedSlice
+)
+
+// Nested 嵌套的结构体, 组合的结构体或者声明了 orm:"alias=u" 的字段
+// 结果集里面的列名是 别名.列名, 例如 o.id, u.name
+type Nested struct {
+	Kind      NestedKind
+	FieldName string       // 字段名
+	FieldType reflect.Type // 字段类型, 例如 Order, *User, []*Item
+	ElemType  reflect.Type // 结构体类型, 例如 Order, User, Item
+	Offset    uintptr
+	// Alias 表的别名, 默认是表名
+	Alias string
+	// Model 嵌套结构体的元数据
+	Model *Model
+}
+
+// RelationKind 关联关系的类型
+type RelationKind uint8
+
+const (
+	HasOne RelationKind = iota + 1
+	HasMany
+	BelongsTo
+)
+
+// Relation 关联关系
+// 对于 HasOne 和 HasMany, ForeignKey 是关联模型上的字段, 指向本模型的 References 字段
+// 对于 BelongsTo, ForeignKey 是本模型上的字段, 指向关联模型的 References 字段
+type Relation struct {
+	Kind       RelationKind
+	FieldName  string       // 字段名
+	FieldType  reflect.Type // 字段类型, 例如 []*Item, *User
+	ElemType   reflect.Type // 关联模型的结构体类型, 例如 Item, User
+	ForeignKey string       // 外键字段名
+	References string       // 被引用的字段名, 默认是 Id
 }
 
 type Option func(model *Model) error
@@ -41,7 +145,10 @@ func WithColumnName(field string, columnName string) Option {
 		// 注意，这里我们根本没有检测 colName 会不会是空字符串
 		// 因为正常情况下，用户都不会写错
 		// 即便写错了，也很容易在测试中发现
+		// 结果集是按照列名找字段的, 所以 ColMap 也要同步修改
+		delete(m.ColMap, fd.ColName)
 		fd.ColName = columnName
+		m.ColMap[columnName] = fd
 		return nil
 	}
 }
@@ -49,9 +156,31 @@ func WithColumnName(field string, columnName string) Option {
 // 我们支持的全部标签上的 key 都放在这里
 // 方便用户查找，和我们后期维护
 const (
-	tagKeyColumn = "column"
+	tagKeyColumn     = "column"
+	tagKeyHasOne     = "has_one"
+	tagKeyHasMany    = "has_many"
+	tagKeyBelongsTo  = "belongs_to"
+	tagKeyForeignKey = "foreign_key"
+	tagKeyReferences = "references"
+	tagKeyTenant     = "tenant"
+	tagKeyEncrypt    = "encrypt"
+	tagKeyPrimaryKey = "primary_key"
+	tagKeyAlias      = "alias"
 )
 
+const tagValDeterministic = "deterministic"
+
+// tagFlags 不需要值的标签 key, 例如 orm:"has_many,foreign_key=OrderId"
+var tagFlags = map[string]struct{}{
+	tagKeyHasOne:     {},
+	tagKeyHasMany:    {},
+	tagKeyBelongsTo:  {},
+	tagKeyTenant:     {},
+	tagKeyEncrypt:    {},
+	tagKeyPrimaryKey: {},
+	tagKeyAlias:      {},
+}
+
 // 用户自定义一些模型信息的接口，集中放在这里
 // 方便用户查找和我们后期维护
 
@@ -102,6 +102,7 @@ func TestModelWithColumnName(t *testing.T) {
 			}
 			fd := m.FieldMap[tc.field]
 			assert.Equal(t, tc.wantColName, fd.ColName)
+			assert.Equal(t, fd, m.ColMap[tc.wantColName])
 		})
 	}
 }
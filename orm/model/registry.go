@@ -84,8 +84,13 @@ func (r *registry) parseModel(entity any) (*Model, error) {
 	}
 
 	numField := typ.NumField()
+	fields := make([]*Field, 0, numField)
 	fds := make(map[string]*Field, numField)
 	cols := make(map[string]*Field, numField)
+	// 大多数模型没有关联关系, 所以按需创建
+	var relations map[string]*Relation
+	var tenant, pk *Field
+	var nested []*Nested
 
 	for i := 0; i < numField; i++ {
 		fdType := typ.Field(i)
@@ -95,6 +100,32 @@ func (r *registry) parseModel(entity any) (*Model, error) {
 			return nil, err
 		}
 
+		rel, err := r.parseRelation(fdType, ormTags)
+		if err != nil {
+			return nil, err
+		}
+		if rel != nil {
+			if relations == nil {
+				relations = make(map[string]*Relation, 2)
+			}
+			relations[fdName] = rel
+			continue
+		}
+
+		n, err := r.parseNested(fdType, ormTags)
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			for _, other := range nested {
+				if other.Alias == n.Alias {
+					return nil, errs.NewErrInvalidNested(fdName)
+				}
+			}
+			nested = append(nested, n)
+			continue
+		}
+
 		colName := ormTags[tagKeyColumn]
 		if colName == "" {
 			colName = util.CamelToUnderline(fdName)
@@ -107,10 +138,39 @@ func (r *registry) parseModel(entity any) (*Model, error) {
 			Offset:    fdType.Offset,
 		}
 
+		if f.Encrypt, err = parseEncrypt(fdType, ormTags); err != nil {
+			return nil, err
+		}
+
+		if _, ok := ormTags[tagKeyTenant]; ok {
+			// 一个模型只能有一个租户字段
+			if tenant != nil {
+				return nil, errs.NewErrMultipleTenant(fdName)
+			}
+			tenant = f
+		}
+
+		if _, ok := ormTags[tagKeyPrimaryKey]; ok {
+			if pk != nil {
+				return nil, errs.NewErrMultiplePrimaryKey(fdName)
+			}
+			pk = f
+		}
+
+		fields = append(fields, f)
 		fds[fdName] = f
 		cols[colName] = f
 	}
 
+	// 没有声明主键的时候, 约定 Id 是主键
+	if pk == nil {
+		pk = fds["Id"]
+	}
+
+	if err := checkNested(nested); err != nil {
+		return nil, err
+	}
+
 	var tableName string
 	if v, ok := entity.(TableName); ok {
 		tableName = v.TableName()
@@ -120,9 +180,145 @@ func (r *registry) parseModel(entity any) (*Model, error) {
 	}
 
 	return &Model{
-		TableName: tableName,
-		FieldMap:  fds,
-		ColMap:    cols,
+		TableName:  tableName,
+		Fields:     fields,
+		FieldMap:   fds,
+		ColMap:     cols,
+		Relations:  relations,
+		Tenant:     tenant,
+		PrimaryKey: pk,
+		Nested:     nested,
+	}, nil
+}
+
+// parseNested 解析嵌套的结构体, 不是嵌套的结构体则返回 nil
+// 组合的结构体总是嵌套的结构体, 别的字段需要声明 orm:"alias=u"
+func (r *registry) parseNested(fd reflect.StructField, tags map[string]string) (*Nested, error) {
+	alias, ok := tags[tagKeyAlias]
+	kind, elem := NestedStruct, fd.Type
+	if elem.Kind() == reflect.Slice {
+		kind, elem = NestedSlice, elem.Elem()
+	}
+	if elem.Kind() == reflect.Ptr {
+		if kind == NestedStruct {
+			kind = NestedPtr
+		}
+		elem = elem.Elem()
+	}
+	if !ok && !(fd.Anonymous && elem.Kind() == reflect.Struct) {
+		return nil, nil
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, errs.NewErrInvalidNested(fd.Name)
+	}
+
+	m, err := r.Get(reflect.New(elem).Interface())
+	if err != nil {
+		return nil, err
+	}
+	// 只支持一层嵌套
+	if len(m.Nested) > 0 {
+		return nil, errs.NewErrInvalidNested(fd.Name)
+	}
+	if alias == "" {
+		alias = m.TableName
+	}
+	return &Nested{
+		Kind:      kind,
+		FieldName: fd.Name,
+		FieldType: fd.Type,
+		ElemType:  elem,
+		Offset:    fd.Offset,
+		Alias:     alias,
+		Model:     m,
+	}, nil
+}
+
+// checkNested 第一个嵌套的结构体是 FROM 后面的表, 不能是切片
+// 有切片的时候按照它的主键合并多行, 所以它必须有主键
+func checkNested(nested []*Nested) error {
+	if len(nested) == 0 {
+		return nil
+	}
+	root := nested[0]
+	if root.Kind == NestedSlice {
+		return errs.NewErrInvalidNested(root.FieldName)
+	}
+	for _, n := range nested[1:] {
+		if n.Kind == NestedSlice && root.Model.PrimaryKey == nil {
+			return errs.NewErrNoPrimaryKey(root.Model.TableName)
+		}
+	}
+	return nil
+}
+
+// parseEncrypt 只有 string, *string 和 []byte 可以加密
+func parseEncrypt(fd reflect.StructField, tags map[string]string) (EncryptMode, error) {
+	mode, ok := tags[tagKeyEncrypt]
+	if !ok {
+		return EncryptNone, nil
+	}
+	typ := fd.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.String && typ != reflect.TypeOf([]byte(nil)) {
+		return EncryptNone, errs.NewErrInvalidEncryptField(fd.Name)
+	}
+	switch mode {
+	case "":
+		return EncryptRandom, nil
+	case tagValDeterministic:
+		return EncryptDeterministic, nil
+	default:
+		return EncryptNone, errs.NewErrInvalidTag(tagKeyEncrypt + "=" + mode)
+	}
+}
+
+// parseRelation 解析关联关系, 不是关联字段则返回 nil
+// HasMany 的字段必须是切片, 例如 []*Item
+// HasOne 和 BelongsTo 的字段必须是结构体或者结构体指针, 例如 *User
+func (r *registry) parseRelation(fd reflect.StructField, tags map[string]string) (*Relation, error) {
+	var kind RelationKind
+	if _, ok := tags[tagKeyHasOne]; ok {
+		kind = HasOne
+	} else if _, ok = tags[tagKeyHasMany]; ok {
+		kind = HasMany
+	} else if _, ok = tags[tagKeyBelongsTo]; ok {
+		kind = BelongsTo
+	} else {
+		return nil, nil
+	}
+
+	elem := fd.Type
+	if kind == HasMany {
+		if elem.Kind() != reflect.Slice {
+			return nil, errs.NewErrInvalidRelation(fd.Name)
+		}
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, errs.NewErrInvalidRelation(fd.Name)
+	}
+
+	fk := tags[tagKeyForeignKey]
+	if fk == "" {
+		return nil, errs.NewErrInvalidRelation(fd.Name)
+	}
+	refs := tags[tagKeyReferences]
+	if refs == "" {
+		refs = "Id"
+	}
+	return &Relation{
+		Kind:       kind,
+		FieldName:  fd.Name,
+		FieldType:  fd.Type,
+		ElemType:   elem,
+		ForeignKey: fk,
+		References: refs,
 	}, nil
 }
 
@@ -173,6 +369,12 @@ func (r *registry) parseTag(tag reflect.StructTag) (map[string]string, error) {
 	res := make(map[string]string, len(pairs))
 	for _, pair := range pairs {
 		kv := strings.Split(pair, "=")
+		if len(kv) == 1 {
+			if _, ok := tagFlags[kv[0]]; ok {
+				res[kv[0]] = ""
+				continue
+			}
+		}
 		if len(kv) != 2 {
 			return nil, errs.NewErrInvalidTag(pair)
 		}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"geektime-go-study/orm/internal/errs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"reflect"
 	"testing"
 )
@@ -30,6 +31,32 @@ func Test_registry_get(t *testing.T) {
 			val:  &TestModel{},
 			wantModel: &Model{
 				TableName: "test_model",
+				Fields: []*Field{
+					{
+						ColName:   "id",
+						FieldType: reflect.TypeOf(int64(0)),
+						FieldName: "Id",
+						Offset:    0,
+					},
+					{
+						ColName:   "first_name",
+						FieldType: reflect.TypeOf(""),
+						FieldName: "FirstName",
+						Offset:    8,
+					},
+					{
+						ColName:   "age",
+						FieldType: reflect.TypeOf(int8(0)),
+						FieldName: "Age",
+						Offset:    24,
+					},
+					{
+						ColName:   "last_name",
+						FieldType: reflect.TypeOf(&sql.NullString{}),
+						FieldName: "LastName",
+						Offset:    32,
+					},
+				},
 				FieldMap: map[string]*Field{
 					"Id": {
 						ColName:   "id",
@@ -82,6 +109,12 @@ func Test_registry_get(t *testing.T) {
 						Offset:    32,
 					},
 				},
+				PrimaryKey: &Field{
+					ColName:   "id",
+					FieldType: reflect.TypeOf(int64(0)),
+					FieldName: "Id",
+					Offset:    0,
+				},
 			},
 		},
 		{
@@ -112,6 +145,13 @@ func Test_registry_get(t *testing.T) {
 			}(),
 			wantModel: &Model{
 				TableName: "column_tag",
+				Fields: []*Field{
+					{
+						ColName:   "id",
+						FieldType: reflect.TypeOf(uint64(0)),
+						FieldName: "ID",
+					},
+				},
 				FieldMap: map[string]*Field{
 					"ID": {
 						ColName:   "id",
@@ -140,6 +180,13 @@ func Test_registry_get(t *testing.T) {
 			}(),
 			wantModel: &Model{
 				TableName: "empty_column",
+				Fields: []*Field{
+					{
+						ColName:   "first_name",
+						FieldType: reflect.TypeOf(""),
+						FieldName: "FirstName",
+					},
+				},
 				FieldMap: map[string]*Field{
 					"FirstName": {
 						ColName:   "first_name",
@@ -180,6 +227,13 @@ func Test_registry_get(t *testing.T) {
 			}(),
 			wantModel: &Model{
 				TableName: "ignore_tag",
+				Fields: []*Field{
+					{
+						ColName:   "first_name",
+						FieldType: reflect.TypeOf(""),
+						FieldName: "FirstName",
+					},
+				},
 				FieldMap: map[string]*Field{
 					"FirstName": {
 						ColName:   "first_name",
@@ -197,12 +251,217 @@ func Test_registry_get(t *testing.T) {
 			},
 		},
 
+		// 关联关系
+		{
+			name: "relation",
+			val:  &RelationOrder{},
+			wantModel: &Model{
+				TableName: "relation_order",
+				Fields: []*Field{
+					{
+						ColName:   "id",
+						FieldName: "Id",
+						FieldType: reflect.TypeOf(int64(0)),
+					},
+					{
+						ColName:   "buyer_id",
+						FieldName: "BuyerId",
+						FieldType: reflect.TypeOf(int64(0)),
+						Offset:    8,
+					},
+				},
+				FieldMap: map[string]*Field{
+					"Id": {
+						ColName:   "id",
+						FieldName: "Id",
+						FieldType: reflect.TypeOf(int64(0)),
+					},
+					"BuyerId": {
+						ColName:   "buyer_id",
+						FieldName: "BuyerId",
+						FieldType: reflect.TypeOf(int64(0)),
+						Offset:    8,
+					},
+				},
+				ColMap: map[string]*Field{
+					"id": {
+						ColName:   "id",
+						FieldName: "Id",
+						FieldType: reflect.TypeOf(int64(0)),
+					},
+					"buyer_id": {
+						ColName:   "buyer_id",
+						FieldName: "BuyerId",
+						FieldType: reflect.TypeOf(int64(0)),
+						Offset:    8,
+					},
+				},
+				PrimaryKey: &Field{
+					ColName:   "id",
+					FieldName: "Id",
+					FieldType: reflect.TypeOf(int64(0)),
+				},
+				Relations: map[string]*Relation{
+					"Items": {
+						Kind:       HasMany,
+						FieldName:  "Items",
+						FieldType:  reflect.TypeOf([]*RelationItem{}),
+						ElemType:   reflect.TypeOf(RelationItem{}),
+						ForeignKey: "OrderId",
+						References: "Id",
+					},
+					"Buyer": {
+						Kind:       BelongsTo,
+						FieldName:  "Buyer",
+						FieldType:  reflect.TypeOf(&RelationItem{}),
+						ElemType:   reflect.TypeOf(RelationItem{}),
+						ForeignKey: "BuyerId",
+						References: "Uid",
+					},
+				},
+			},
+		},
+		{
+			name: "relation without foreign key",
+			val: func() any {
+				type NoForeignKey struct {
+					Items []*RelationItem `orm:"has_many"`
+				}
+				return &NoForeignKey{}
+			}(),
+			wantErr: errs.NewErrInvalidRelation("Items"),
+		},
+		{
+			name: "has many not slice",
+			val: func() any {
+				type HasManyNotSlice struct {
+					Items *RelationItem `orm:"has_many,foreign_key=OrderId"`
+				}
+				return &HasManyNotSlice{}
+			}(),
+			wantErr: errs.NewErrInvalidRelation("Items"),
+		},
+		{
+			name: "multiple tenant",
+			val: func() any {
+				type MultipleTenant struct {
+					TenantId int64 `orm:"tenant"`
+					OrgId    int64 `orm:"tenant,column=org"`
+				}
+				return &MultipleTenant{}
+			}(),
+			wantErr: errs.NewErrMultipleTenant("OrgId"),
+		},
+
+		// 主键
+		{
+			name: "primary key",
+			val: func() any {
+				type LegacyUser struct {
+					Id     int64
+					UserNo string `orm:"primary_key"`
+				}
+				return &LegacyUser{}
+			}(),
+			wantModel: func() *Model {
+				id := &Field{
+					ColName:   "id",
+					FieldName: "Id",
+					FieldType: reflect.TypeOf(int64(0)),
+				}
+				userNo := &Field{
+					ColName:   "user_no",
+					FieldName: "UserNo",
+					FieldType: reflect.TypeOf(""),
+					Offset:    8,
+				}
+				return &Model{
+					TableName:  "legacy_user",
+					Fields:     []*Field{id, userNo},
+					FieldMap:   map[string]*Field{"Id": id, "UserNo": userNo},
+					ColMap:     map[string]*Field{"id": id, "user_no": userNo},
+					PrimaryKey: userNo,
+				}
+			}(),
+		},
+		{
+			name: "multiple primary key",
+			val: func() any {
+				type MultiplePrimaryKey struct {
+					Id     int64  `orm:"primary_key"`
+					UserNo string `orm:"primary_key"`
+				}
+				return &MultiplePrimaryKey{}
+			}(),
+			wantErr: errs.NewErrMultiplePrimaryKey("UserNo"),
+		},
+
+		// 加密字段
+		{
+			name: "encrypt",
+			val: func() any {
+				type EncryptModel struct {
+					Phone  string `orm:"encrypt=deterministic"`
+					Secret []byte `orm:"encrypt"`
+				}
+				return &EncryptModel{}
+			}(),
+			wantModel: func() *Model {
+				phone := &Field{
+					ColName:   "phone",
+					FieldName: "Phone",
+					FieldType: reflect.TypeOf(""),
+					Encrypt:   EncryptDeterministic,
+				}
+				secret := &Field{
+					ColName:   "secret",
+					FieldName: "Secret",
+					FieldType: reflect.TypeOf([]byte(nil)),
+					Offset:    16,
+					Encrypt:   EncryptRandom,
+				}
+				return &Model{
+					TableName: "encrypt_model",
+					Fields:    []*Field{phone, secret},
+					FieldMap:  map[string]*Field{"Phone": phone, "Secret": secret},
+					ColMap:    map[string]*Field{"phone": phone, "secret": secret},
+				}
+			}(),
+		},
+		{
+			name: "encrypt invalid type",
+			val: func() any {
+				type EncryptInt struct {
+					Age int `orm:"encrypt"`
+				}
+				return &EncryptInt{}
+			}(),
+			wantErr: errs.NewErrInvalidEncryptField("Age"),
+		},
+		{
+			name: "encrypt invalid mode",
+			val: func() any {
+				type EncryptMode struct {
+					Phone string `orm:"encrypt=md5"`
+				}
+				return &EncryptMode{}
+			}(),
+			wantErr: errs.NewErrInvalidTag("encrypt=md5"),
+		},
+
 		// 利用接口自定义模型信息
 		{
 			name: "table name",
 			val:  &CustomTableName{},
 			wantModel: &Model{
 				TableName: "custom_table_name_t",
+				Fields: []*Field{
+					{
+						ColName:   "name",
+						FieldName: "Name",
+						FieldType: reflect.TypeOf(""),
+					},
+				},
 				FieldMap: map[string]*Field{
 					"Name": {
 						ColName:   "name",
@@ -224,6 +483,13 @@ func Test_registry_get(t *testing.T) {
 			val:  &CustomTableNamePtr{},
 			wantModel: &Model{
 				TableName: "custom_table_name_ptr_t",
+				Fields: []*Field{
+					{
+						ColName:   "name",
+						FieldName: "Name",
+						FieldType: reflect.TypeOf(""),
+					},
+				},
 				FieldMap: map[string]*Field{
 					"Name": {
 						ColName:   "name",
@@ -245,6 +511,13 @@ func Test_registry_get(t *testing.T) {
 			val:  &EmptyTableName{},
 			wantModel: &Model{
 				TableName: "empty_table_name",
+				Fields: []*Field{
+					{
+						ColName:   "name",
+						FieldName: "Name",
+						FieldType: reflect.TypeOf(""),
+					},
+				},
 				FieldMap: map[string]*Field{
 					"Name": {
 						ColName:   "name",
@@ -299,3 +572,142 @@ type EmptyTableName struct {
 func (c *EmptyTableName) TableName() string {
 	return ""
 }
+
+type RelationOrder struct {
+	Id      int64
+	BuyerId int64
+	Items   []*RelationItem `orm:"has_many,foreign_key=OrderId"`
+	Buyer   *RelationItem   `orm:"belongs_to,foreign_key=BuyerId,references=Uid"`
+}
+
+type RelationItem struct {
+	Id      int64
+	OrderId int64
+}
+
+type NestedOrderWithItems struct {
+	RelationOrder `orm:"alias=o"`
+	Buyer         *CustomTableName `orm:"alias"`
+	Items         []RelationItem   `orm:"alias=i"`
+	Cnt           int
+}
+
+func Test_registry_nested(t *testing.T) {
+	r := NewRegistry()
+	m, err := r.Get(&NestedOrderWithItems{})
+	require.NoError(t, err)
+	order, err := r.Get(&RelationOrder{})
+	require.NoError(t, err)
+	buyer, err := r.Get(&CustomTableName{})
+	require.NoError(t, err)
+	item, err := r.Get(&RelationItem{})
+	require.NoError(t, err)
+
+	typ := reflect.TypeOf(NestedOrderWithItems{})
+	assert.Equal(t, []*Nested{
+		{
+			Kind:      NestedStruct,
+			FieldName: "RelationOrder",
+			FieldType: reflect.TypeOf(RelationOrder{}),
+			ElemType:  reflect.TypeOf(RelationOrder{}),
+			Alias:     "o",
+			Model:     order,
+		},
+		{
+			// 没有指定别名的时候用表名
+			Kind:      NestedPtr,
+			FieldName: "Buyer",
+			FieldType: reflect.TypeOf(&CustomTableName{}),
+			ElemType:  reflect.TypeOf(CustomTableName{}),
+			Offset:    typ.Field(1).Offset,
+			Alias:     "custom_table_name_t",
+			Model:     buyer,
+		},
+		{
+			Kind:      NestedSlice,
+			FieldName: "Items",
+			FieldType: reflect.TypeOf([]RelationItem{}),
+			ElemType:  reflect.TypeOf(RelationItem{}),
+			Offset:    typ.Field(2).Offset,
+			Alias:     "i",
+			Model:     item,
+		},
+	}, m.Nested)
+	// 嵌套结构体的字段不是本模型的字段
+	require.Len(t, m.Fields, 1)
+	assert.Equal(t, "cnt", m.Fields[0].ColName)
+
+	n, fd, ok := m.FieldOf("Items.OrderId")
+	require.True(t, ok)
+	assert.Equal(t, "i", n.Alias)
+	assert.Equal(t, "order_id", fd.ColName)
+	n, fd, ok = m.FieldOf("Cnt")
+	require.True(t, ok)
+	assert.Nil(t, n)
+	assert.Equal(t, "cnt", fd.ColName)
+	_, _, ok = m.FieldOf("Items.Invalid")
+	assert.False(t, ok)
+	_, _, ok = m.FieldOf("Invalid.Id")
+	assert.False(t, ok)
+}
+
+func Test_registry_invalidNested(t *testing.T) {
+	type NotStruct struct {
+		Id   int64
+		Name string `orm:"alias=n"`
+	}
+	type SliceRoot struct {
+		Items []*RelationItem `orm:"alias=i"`
+		Order *RelationOrder  `orm:"alias=o"`
+	}
+	type DuplicateAlias struct {
+		RelationOrder
+		Again *RelationOrder `orm:"alias=relation_order"`
+	}
+	type NoPrimaryKey struct {
+		CustomTableName
+		Items []*RelationItem `orm:"alias=i"`
+	}
+	type Deep struct {
+		NestedOrderWithItems
+	}
+
+	testCases := []struct {
+		name    string
+		val     any
+		wantErr error
+	}{
+		{
+			name:    "not struct",
+			val:     &NotStruct{},
+			wantErr: errs.NewErrInvalidNested("Name"),
+		},
+		{
+			name:    "slice root",
+			val:     &SliceRoot{},
+			wantErr: errs.NewErrInvalidNested("Items"),
+		},
+		{
+			name:    "duplicate alias",
+			val:     &DuplicateAlias{},
+			wantErr: errs.NewErrInvalidNested("Again"),
+		},
+		{
+			name:    "root without primary key",
+			val:     &NoPrimaryKey{},
+			wantErr: errs.NewErrNoPrimaryKey("custom_table_name_t"),
+		},
+		{
+			name:    "deep",
+			val:     &Deep{},
+			wantErr: errs.NewErrInvalidNested("NestedOrderWithItems"),
+		},
+	}
+	r := NewRegistry()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := r.Get(tc.val)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
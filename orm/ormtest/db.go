@@ -0,0 +1,163 @@
+// Package ormtest 测试 orm 以及使用 orm 的代码的工具
+// 提供每个测试独立的内存数据库, 根据模型建表, 加载 fixture, golden 文件断言和语句记录
+package ormtest
+
+import (
+	"database/sql"
+	"fmt"
+	"geektime-go-study/orm"
+	"geektime-go-study/orm/model"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DB 内存模式的 SQLite, 测试结束的时候自动关闭
+// 嵌入了 *orm.DB, 所以可以直接作为 orm.Session 使用:
+//
+//	db := ormtest.NewDB(t)
+//	db.CreateTables(&User{})
+//	u, err := orm.NewSelector[User](db).Get(ctx)
+type DB struct {
+	*orm.DB
+	t     testing.TB
+	sqlDB *sql.DB
+}
+
+var dbCnt int64
+
+// NewDB 每次调用都是一个全新的数据库, 数据库之间互不影响
+// 同一个 DB 的多个连接看到的是同一份数据
+func NewDB(t testing.TB, opts ...orm.DBOption) *DB {
+	t.Helper()
+	// 只用计数作为库名, 测试名里面的 ? 和 & 这些字符会破坏 DSN 的参数
+	dsn := fmt.Sprintf("file:ormtest_%d?mode=memory&cache=shared", atomic.AddInt64(&dbCnt, 1))
+	sqlDB, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	db, err := orm.OpenDB(sqlDB, append([]orm.DBOption{orm.DBWithDialect(orm.DialectSQLite)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DB{DB: db, t: t, sqlDB: sqlDB}
+}
+
+// Exec 执行任意的 SQL, 失败的时候测试直接失败
+func (db *DB) Exec(query string, args ...any) sql.Result {
+	db.t.Helper()
+	res, err := db.sqlDB.Exec(query, args...)
+	if err != nil {
+		db.t.Fatalf("ormtest: 执行 %s 失败: %v", query, err)
+	}
+	return res
+}
+
+// CreateTables 根据模型的元数据建表, 已经存在的表会跳过
+// 模型的主键作为 PRIMARY KEY
+func (db *DB) CreateTables(models ...any) {
+	db.t.Helper()
+	for _, val := range models {
+		m, err := db.Model(val)
+		if err != nil {
+			db.t.Fatal(err)
+		}
+		db.Exec(CreateTableSQL(m))
+	}
+}
+
+// CreateTableSQL 生成 SQLite 的建表语句
+func CreateTableSQL(m *model.Model) string {
+	sb := strings.Builder{}
+	sb.WriteString("CREATE TABLE IF NOT EXISTS `")
+	sb.WriteString(m.TableName)
+	sb.WriteString("`(")
+	for i, fd := range m.Fields {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('`')
+		sb.WriteString(fd.ColName)
+		sb.WriteString("` ")
+		typ := columnType(fd.FieldType)
+		sb.WriteString(typ)
+		if fd == m.PrimaryKey {
+			sb.WriteString(" PRIMARY KEY")
+			continue
+		}
+		// 不能存放 NULL 的类型设置默认值, 这样 fixture 里面可以省略这些列
+		if def, ok := zeroDefaults[typ]; ok && !nullable(fd.FieldType) {
+			sb.WriteString(" NOT NULL DEFAULT ")
+			sb.WriteString(def)
+		}
+	}
+	sb.WriteString(");")
+	return sb.String()
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	nullTimeType  = reflect.TypeOf(sql.NullTime{})
+	nullBoolType  = reflect.TypeOf(sql.NullBool{})
+	nullFloatType = reflect.TypeOf(sql.NullFloat64{})
+	bytesType     = reflect.TypeOf([]byte{})
+)
+
+var zeroDefaults = map[string]string{
+	"INTEGER":  "0",
+	"REAL":     "0",
+	"BOOLEAN":  "0",
+	"TEXT":     "''",
+	"DATETIME": "'0001-01-01 00:00:00+00:00'",
+}
+
+// nullable 指针和 sql.NullString 这种类型可以存放 NULL
+func nullable(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		return true
+	}
+	return typ.Kind() == reflect.Struct && strings.HasPrefix(typ.Name(), "Null")
+}
+
+// columnType SQLite 根据声明的类型决定亲和性, go-sqlite3 也会根据声明的类型转换时间这些类型
+func columnType(typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case timeType, nullTimeType:
+		return "DATETIME"
+	case nullBoolType:
+		return "BOOLEAN"
+	case nullFloatType:
+		return "REAL"
+	case bytesType:
+		return "BLOB"
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.String:
+		return "TEXT"
+	case reflect.Struct:
+		// sql.NullInt64 这些
+		if strings.Contains(typ.Name(), "Int") {
+			return "INTEGER"
+		}
+		return "TEXT"
+	default:
+		return "BLOB"
+	}
+}
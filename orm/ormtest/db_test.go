@@ -0,0 +1,65 @@
+package ormtest
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Id        int64
+	Name      string
+	Age       *int
+	Score     float64
+	Nick      sql.NullString
+	CreatedAt time.Time
+}
+
+type Order struct {
+	Id     int64
+	UserId int64
+	Amount int
+}
+
+func TestCreateTableSQL(t *testing.T) {
+	db := NewDB(t)
+	m, err := db.Model(&User{})
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS `user`(`id` INTEGER PRIMARY KEY, `name` TEXT NOT NULL DEFAULT '', "+
+		"`age` INTEGER, `score` REAL NOT NULL DEFAULT 0, `nick` TEXT, "+
+		"`created_at` DATETIME NOT NULL DEFAULT '0001-01-01 00:00:00+00:00');", CreateTableSQL(m))
+}
+
+func TestNewDB(t *testing.T) {
+	ctx := context.Background()
+	db1 := NewDB(t)
+	db1.CreateTables(&User{})
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	_, err := orm.NewInserter[User](db1).Values(&User{Id: 1, Name: "Tom", CreatedAt: now}).Exec(ctx)
+	require.NoError(t, err)
+	u, err := orm.NewSelector[User](db1).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &User{Id: 1, Name: "Tom", CreatedAt: now}, u)
+
+	// 同一个测试里面的 DB 也是隔离的
+	db2 := NewDB(t)
+	db2.CreateTables(&User{})
+	_, err = orm.NewSelector[User](db2).Get(ctx)
+	assert.Equal(t, orm.ErrNoRows, err)
+}
+
+func TestNewDB_specialName(t *testing.T) {
+	// 测试名里面的字符不能影响 DSN, 否则会在当前目录下创建数据库文件
+	t.Run("a?b&c%d#e", func(t *testing.T) {
+		db := NewDB(t)
+		db.CreateTables(&User{})
+	})
+	files, err := filepath.Glob("ormtest_*")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
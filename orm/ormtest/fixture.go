@@ -0,0 +1,139 @@
+package ormtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"geektime-go-study/orm/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFixtures 把 fixture 文件里面的数据插入到对应的表, 表不存在的话会根据模型建表
+// 文件是 YAML 或者 JSON, 根据后缀名判断, 顶层的 key 是表名, 每一行的 key 是列名:
+//
+//	user:
+//	  - id: 1
+//	    name: Tom
+//	  - id: 2
+//	    name: Jerry
+//
+// models 是这些表对应的模型, 用来建表和校验列名
+// fixture 不能写入加密字段, 加密字段的数据请使用 orm.NewInserter 写入
+func (db *DB) LoadFixtures(path string, models ...any) {
+	db.t.Helper()
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		db.t.Fatal(err)
+	}
+	tables, err := parseFixtures(filepath.Ext(path), bs)
+	if err != nil {
+		db.t.Fatalf("ormtest: 解析 fixture %s 失败: %v", path, err)
+	}
+
+	ms := make(map[string]*model.Model, len(models))
+	for _, val := range models {
+		m, err := db.Model(val)
+		if err != nil {
+			db.t.Fatal(err)
+		}
+		ms[m.TableName] = m
+	}
+	db.CreateTables(models...)
+
+	// 按照表名排序, 保证插入的顺序稳定
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m, ok := ms[name]
+		if !ok {
+			db.t.Fatalf("ormtest: fixture %s 中的表 %s 没有对应的模型", path, name)
+		}
+		for _, row := range tables[name] {
+			query, args, err := insertSQL(m, row)
+			if err != nil {
+				db.t.Fatalf("ormtest: fixture %s: %v", path, err)
+			}
+			db.Exec(query, args...)
+		}
+	}
+}
+
+func parseFixtures(ext string, bs []byte) (map[string][]map[string]any, error) {
+	var res map[string][]map[string]any
+	switch strings.ToLower(ext) {
+	case ".yml", ".yaml":
+		return res, yaml.Unmarshal(bs, &res)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(bs))
+		// 避免整数变成 float64
+		dec.UseNumber()
+		if err := dec.Decode(&res); err != nil {
+			return nil, err
+		}
+		for _, rows := range res {
+			for _, row := range rows {
+				for col, val := range row {
+					row[col] = jsonValue(val)
+				}
+			}
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("不支持的文件类型 %s", ext)
+	}
+}
+
+func jsonValue(val any) any {
+	num, ok := val.(json.Number)
+	if !ok {
+		return val
+	}
+	if i, err := num.Int64(); err == nil {
+		return i
+	}
+	f, _ := num.Float64()
+	return f
+}
+
+func insertSQL(m *model.Model, row map[string]any) (string, []any, error) {
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		fd, ok := m.ColMap[col]
+		if !ok {
+			return "", nil, fmt.Errorf("表 %s 没有列 %s", m.TableName, col)
+		}
+		// fixture 里面是明文, 直接插入的话读出来会解密失败
+		if fd.Encrypt != model.EncryptNone {
+			return "", nil, fmt.Errorf("表 %s 的列 %s 是加密字段, 不能通过 fixture 写入, 请使用 orm.NewInserter", m.TableName, col)
+		}
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	sb := strings.Builder{}
+	sb.WriteString("INSERT INTO `")
+	sb.WriteString(m.TableName)
+	sb.WriteString("`(")
+	args := make([]any, 0, len(cols))
+	for i, col := range cols {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('`')
+		sb.WriteString(col)
+		sb.WriteByte('`')
+		args = append(args, row[col])
+	}
+	sb.WriteString(") VALUES (")
+	sb.WriteString(strings.TrimSuffix(strings.Repeat("?,", len(cols)), ","))
+	sb.WriteString(");")
+	return sb.String(), args, nil
+}
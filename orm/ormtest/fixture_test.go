@@ -0,0 +1,61 @@
+package ormtest
+
+import (
+	"context"
+	"geektime-go-study/orm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDB_LoadFixtures(t *testing.T) {
+	ctx := context.Background()
+	age := 18
+
+	t.Run("yaml", func(t *testing.T) {
+		db := NewDB(t)
+		db.LoadFixtures("testdata/fixtures.yml", &User{}, &Order{})
+		users, err := orm.NewSelector[User](db).OrderBy(orm.Asc("Id")).GetMulti(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*User{
+			{Id: 1, Name: "Tom", Age: &age, CreatedAt: time.Date(2022, 10, 1, 10, 0, 0, 0, time.UTC)},
+			{Id: 2, Name: "Jerry"},
+		}, users)
+		o, err := orm.NewSelector[Order](db).Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &Order{Id: 1, UserId: 1, Amount: 100}, o)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		db := NewDB(t)
+		db.LoadFixtures("testdata/fixtures.json", &User{})
+		u, err := orm.NewSelector[User](db).Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &User{Id: 1, Name: "Tom", Score: 99.5}, u)
+	})
+}
+
+func TestInsertSQL(t *testing.T) {
+	db := NewDB(t)
+	m, err := db.Model(&Order{})
+	require.NoError(t, err)
+
+	query, args, err := insertSQL(m, map[string]any{"user_id": 2, "id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `order`(`id`,`user_id`) VALUES (?,?);", query)
+	assert.Equal(t, []any{1, 2}, args)
+
+	_, _, err = insertSQL(m, map[string]any{"invalid": 1})
+	assert.EqualError(t, err, "表 order 没有列 invalid")
+
+	m, err = db.Model(&SecretUser{})
+	require.NoError(t, err)
+	_, _, err = insertSQL(m, map[string]any{"id": 1, "phone": "123"})
+	assert.EqualError(t, err, "表 secret_user 的列 phone 是加密字段, 不能通过 fixture 写入, 请使用 orm.NewInserter")
+}
+
+type SecretUser struct {
+	Id    int64
+	Phone string `orm:"encrypt"`
+}
@@ -0,0 +1,53 @@
+package ormtest
+
+import (
+	"encoding/json"
+	"geektime-go-study/orm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// UpdateGoldenEnv 设置了这个环境变量的时候, AssertGolden 会重新生成 golden 文件
+//
+//	ORMTEST_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "ORMTEST_UPDATE_GOLDEN"
+
+// AssertGolden 构造 q, 并且和 testdata/<测试名>.golden 比较
+// golden 文件的第一行是 SQL, 第二行是 JSON 格式的参数
+func AssertGolden(t testing.TB, q orm.QueryBuilder) {
+	t.Helper()
+	query, err := q.Build()
+	if err != nil {
+		t.Fatalf("ormtest: 构造 SQL 失败: %v", err)
+	}
+	args, err := json.Marshal(query.Args)
+	if err != nil {
+		t.Fatalf("ormtest: 序列化参数失败: %v", err)
+	}
+	got := query.SQL + "\n" + string(args) + "\n"
+
+	path := goldenPath(t)
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ormtest: 读取 golden 文件失败, 可以设置 %s=1 生成: %v", UpdateGoldenEnv, err)
+	}
+	if string(want) != got {
+		t.Errorf("ormtest: %s 不一致\n期望:\n%s实际:\n%s", path, want, got)
+	}
+}
+
+func goldenPath(t testing.TB) string {
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	return filepath.Join("testdata", name+".golden")
+}
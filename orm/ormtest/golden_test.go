@@ -0,0 +1,28 @@
+package ormtest
+
+import (
+	"geektime-go-study/orm"
+	"testing"
+)
+
+func TestAssertGolden(t *testing.T) {
+	db := NewDB(t)
+	testCases := []struct {
+		name string
+		q    orm.QueryBuilder
+	}{
+		{
+			name: "select",
+			q:    orm.NewSelector[User](db).Where(orm.C("Name").EQ("Tom")).Limit(10),
+		},
+		{
+			name: "insert",
+			q:    orm.NewInserter[Order](db).Values(&Order{Id: 1, UserId: 2, Amount: 3}),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			AssertGolden(t, tc.q)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package ormtest
+
+import (
+	"context"
+	"geektime-go-study/orm"
+	"sync"
+)
+
+// Recorder 记录 DB 执行过的语句, 用于在业务代码的测试里面断言
+//
+//	rec := &ormtest.Recorder{}
+//	db := ormtest.NewDB(t, rec.Option())
+//	// 调用业务代码
+//	assert.Equal(t, []orm.Query{...}, rec.Statements())
+type Recorder struct {
+	mutex sync.Mutex
+	stmts []orm.Query
+}
+
+// Option 把 Recorder 挂到 DB 上
+func (r *Recorder) Option() orm.DBOption {
+	return orm.DBWithStatementHook(r.record)
+}
+
+func (r *Recorder) record(ctx context.Context, query *orm.Query) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// 复制一份参数, 避免调用方之后修改
+	args := append([]any(nil), query.Args...)
+	r.stmts = append(r.stmts, orm.Query{SQL: query.SQL, Args: args})
+}
+
+// Statements 按照执行顺序返回记录的语句
+func (r *Recorder) Statements() []orm.Query {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]orm.Query(nil), r.stmts...)
+}
+
+// Reset 清空记录, 例如准备完数据之后只关心后面的语句
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stmts = nil
+}
@@ -0,0 +1,32 @@
+package ormtest
+
+import (
+	"context"
+	"geektime-go-study/orm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := &Recorder{}
+	db := NewDB(t, rec.Option())
+	db.CreateTables(&Order{})
+	ctx := context.Background()
+
+	_, err := orm.NewInserter[Order](db).Values(&Order{Id: 1, UserId: 2, Amount: 3}).Exec(ctx)
+	require.NoError(t, err)
+	err = db.DoTx(ctx, func(ctx context.Context, tx *orm.Tx) error {
+		_, err := orm.NewSelector[Order](tx).Where(orm.C("UserId").EQ(2)).GetMulti(ctx)
+		return err
+	}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []orm.Query{
+		{SQL: "INSERT INTO `order`(`id`,`user_id`,`amount`) VALUES (?,?,?);", Args: []any{int64(1), int64(2), 3}},
+		{SQL: "SELECT * FROM `order` WHERE `user_id` = ?;", Args: []any{2}},
+	}, rec.Statements())
+
+	rec.Reset()
+	assert.Empty(t, rec.Statements())
+}
@@ -3,12 +3,14 @@ package orm
 type op string
 
 const (
-	opEQ  = "="
-	opLT  = "<"
-	opGT  = ">"
-	opAND = "AND"
-	opOR  = "OR"
-	opNOT = "NOT"
+	opEQ   = "="
+	opLT   = "<"
+	opGT   = ">"
+	opAND  = "AND"
+	opOR   = "OR"
+	opNOT  = "NOT"
+	opIN   = "IN"
+	opLIKE = "LIKE"
 )
 
 func (o op) String() string {
@@ -0,0 +1,252 @@
+package orm
+
+import (
+	"context"
+	"database/sql/driver"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/model"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// preloadTree 把 Items, Items.Product 这种路径组织成树
+// 这样同一个关联关系只会查询一次
+type preloadTree map[string]preloadTree
+
+func newPreloadTree(paths []string) preloadTree {
+	root := preloadTree{}
+	for _, path := range paths {
+		node := root
+		for _, name := range strings.Split(path, ".") {
+			sub, ok := node[name]
+			if !ok {
+				sub = preloadTree{}
+				node[name] = sub
+			}
+			node = sub
+		}
+	}
+	return root
+}
+
+// preloader 在主查询之后加载关联关系
+// 每个关联关系只发起一次 IN 查询, 然后在内存里面把结果拼接到父结构体上
+// 从而避免 N+1 问题
+type preloader struct {
+	db   *DB
+	sess Session
+	// tenant 沿用主查询的租户信息, 关联模型同样会注入租户条件
+	tenant tenantScope
+}
+
+// load parents 都是指向结构体的指针, 对应的元数据是 m
+func (p preloader) load(ctx context.Context, m *model.Model, parents []reflect.Value, tree preloadTree) error {
+	// 排序是为了保证查询的顺序稳定
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rel, ok := m.Relations[name]
+		if !ok {
+			return errs.NewErrUnknownRelation(name)
+		}
+		cm, children, err := p.loadRelation(ctx, m, parents, rel)
+		if err != nil {
+			return err
+		}
+		if sub := tree[name]; len(sub) > 0 && len(children) > 0 {
+			if err = p.load(ctx, cm, children, sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadRelation 加载一个关联关系, 返回关联模型的元数据和写入父结构体的全部关联对象, 都是指针
+func (p preloader) loadRelation(ctx context.Context, m *model.Model,
+	parents []reflect.Value, rel *model.Relation) (*model.Model, []reflect.Value, error) {
+	cm, err := p.db.r.Get(reflect.New(rel.ElemType).Interface())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// parentKey 是父结构体上用于关联的字段, childKey 是关联结构体上用于关联的字段
+	parentKey, childKey := rel.References, rel.ForeignKey
+	if rel.Kind == model.BelongsTo {
+		parentKey, childKey = rel.ForeignKey, rel.References
+	}
+	if _, ok := m.FieldMap[parentKey]; !ok {
+		return nil, nil, errs.NewErrUnknownField(parentKey)
+	}
+	if _, ok := cm.FieldMap[childKey]; !ok {
+		return nil, nil, errs.NewErrUnknownField(childKey)
+	}
+
+	keys := make([]any, 0, len(parents))
+	seen := make(map[any]struct{}, len(parents))
+	for _, parent := range parents {
+		key, ok, err := preloadKey(parent.Elem().FieldByName(parentKey))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		if _, ok = seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return cm, nil, nil
+	}
+
+	// IN 的参数个数不能超过数据库的限制, 租户条件还要占一个占位符
+	size := p.db.dialect.maxPlaceholders() - 1
+	var children []reflect.Value
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		res, err := p.query(ctx, cm, rel.ElemType, C(childKey).In(keys[start:end]...))
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, res...)
+	}
+
+	groups := make(map[any][]reflect.Value, len(keys))
+	for _, child := range children {
+		key, ok, err := preloadKey(child.Elem().FieldByName(childKey))
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			groups[key] = append(groups[key], child)
+		}
+	}
+
+	// 关联字段不是指针的时候, 父结构体里面保存的是副本
+	// 嵌套的预加载要写入这些副本, 所以返回副本的地址而不是查询出来的对象
+	ptr := rel.FieldType.Kind() == reflect.Ptr
+	if rel.Kind == model.HasMany {
+		ptr = rel.FieldType.Elem().Kind() == reflect.Ptr
+	}
+	loaded := children
+	if !ptr {
+		loaded = make([]reflect.Value, 0, len(children))
+	}
+	for _, parent := range parents {
+		// 前面已经检查过了, 这里不会出错
+		key, _, _ := preloadKey(parent.Elem().FieldByName(parentKey))
+		matched := groups[key]
+		fd := parent.Elem().FieldByName(rel.FieldName)
+		if rel.Kind == model.HasMany {
+			fd.Set(makeSlice(rel.FieldType, matched))
+			for i := 0; !ptr && i < fd.Len(); i++ {
+				loaded = append(loaded, fd.Index(i).Addr())
+			}
+			continue
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if ptr {
+			fd.Set(matched[0])
+		} else {
+			fd.Set(matched[0].Elem())
+			loaded = append(loaded, fd.Addr())
+		}
+	}
+	return cm, loaded, nil
+}
+
+// preloadKey 把关联字段的值统一为同一种类型, 这样 *int64, sql.NullInt64 和 int 都可以和 int64 的主键匹配
+// 指针解引用, driver.Valuer 取 Value, 整数统一为 int64, 字符串统一为 string
+// 返回 false 代表值是 NULL, 不会匹配任何关联对象
+func preloadKey(val reflect.Value) (any, bool, error) {
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, false, nil
+		}
+		val = val.Elem()
+	}
+	if v, ok := val.Interface().(driver.Valuer); ok {
+		dv, err := v.Value()
+		if err != nil || dv == nil {
+			return nil, false, err
+		}
+		val = reflect.ValueOf(dv)
+	}
+	switch {
+	case val.CanInt():
+		return val.Int(), true, nil
+	case val.CanUint() && val.Uint() <= math.MaxInt64:
+		return int64(val.Uint()), true, nil
+	case val.Kind() == reflect.String:
+		return val.String(), true, nil
+	case val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8:
+		return string(val.Bytes()), true, nil
+	}
+	return val.Interface(), true, nil
+}
+
+// query 查询关联模型, 返回的都是指向 typ 的指针
+func (p preloader) query(ctx context.Context, m *model.Model,
+	typ reflect.Type, where Predicate) ([]reflect.Value, error) {
+	ps, err := p.tenant.withTenant(m, []Predicate{where})
+	if err != nil {
+		return nil, err
+	}
+	b := &builder{m: m, cipher: p.db.cipher, dialect: p.db.dialect}
+	b.sb.WriteString("SELECT * FROM ")
+	b.quote(m.TableName)
+	b.sb.WriteString(" WHERE ")
+	if err = b.buildPredicates(ps); err != nil {
+		return nil, err
+	}
+	b.sb.WriteByte(';')
+
+	rows, err := p.sess.queryContext(ctx, b.sb.String(), b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	res := make([]reflect.Value, 0, 8)
+	for rows.Next() {
+		val := reflect.New(typ)
+		if err = p.db.newValuer(val.Interface(), m).SetColumns(rows); err != nil {
+			return nil, err
+		}
+		if err = afterQuery(ctx, val.Interface()); err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, p.db.dialect.translateErr(rows.Err())
+}
+
+// makeSlice 根据切片类型决定放指针还是放结构体, 例如 []*Item 或者 []Item
+func makeSlice(typ reflect.Type, vals []reflect.Value) reflect.Value {
+	res := reflect.MakeSlice(typ, 0, len(vals))
+	ptr := typ.Elem().Kind() == reflect.Ptr
+	for _, val := range vals {
+		if ptr {
+			res = reflect.Append(res, val)
+		} else {
+			res = reflect.Append(res, val.Elem())
+		}
+	}
+	return res
+}
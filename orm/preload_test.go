@@ -0,0 +1,277 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+type PreloadOrder struct {
+	Id      int64
+	BuyerId int64
+	Items   []*PreloadItem  `orm:"has_many,foreign_key=OrderId"`
+	Invoice *PreloadInvoice `orm:"has_one,foreign_key=OrderId"`
+	Buyer   *PreloadUser    `orm:"belongs_to,foreign_key=BuyerId"`
+}
+
+type PreloadItem struct {
+	Id        int64
+	OrderId   int64
+	ProductId int64
+	Product   PreloadProduct `orm:"belongs_to,foreign_key=ProductId"`
+}
+
+type PreloadInvoice struct {
+	Id      int64
+	OrderId int64
+	Title   string
+}
+
+type PreloadProduct struct {
+	Id   int64
+	Name string
+}
+
+type PreloadUser struct {
+	Id   int64
+	Name string
+}
+
+func TestSelector_Preload(t *testing.T) {
+	db, err := Open("sqlite3", "file:preload.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE preload_order(id INTEGER PRIMARY KEY, buyer_id INTEGER)",
+		"CREATE TABLE preload_item(id INTEGER PRIMARY KEY, order_id INTEGER, product_id INTEGER)",
+		"CREATE TABLE preload_invoice(id INTEGER PRIMARY KEY, order_id INTEGER, title TEXT)",
+		"CREATE TABLE preload_product(id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE preload_user(id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO preload_order VALUES (1, 1), (2, 1), (3, 2)",
+		"INSERT INTO preload_item VALUES (1, 1, 1), (2, 1, 2), (3, 2, 1)",
+		"INSERT INTO preload_invoice VALUES (1, 2, 'invoice-2')",
+		"INSERT INTO preload_product VALUES (1, 'apple'), (2, 'banana')",
+		"INSERT INTO preload_user VALUES (1, 'Tom'), (2, 'Jerry')",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	apple := PreloadProduct{Id: 1, Name: "apple"}
+	banana := PreloadProduct{Id: 2, Name: "banana"}
+	tom := &PreloadUser{Id: 1, Name: "Tom"}
+	jerry := &PreloadUser{Id: 2, Name: "Jerry"}
+
+	testCases := []struct {
+		name    string
+		s       *Selector[PreloadOrder]
+		wantRes []*PreloadOrder
+		wantErr error
+	}{
+		{
+			name: "has many",
+			s:    NewSelector[PreloadOrder](db).Preload("Items"),
+			wantRes: []*PreloadOrder{
+				{Id: 1, BuyerId: 1, Items: []*PreloadItem{
+					{Id: 1, OrderId: 1, ProductId: 1},
+					{Id: 2, OrderId: 1, ProductId: 2},
+				}},
+				{Id: 2, BuyerId: 1, Items: []*PreloadItem{
+					{Id: 3, OrderId: 2, ProductId: 1},
+				}},
+				{Id: 3, BuyerId: 2, Items: []*PreloadItem{}},
+			},
+		},
+		{
+			name: "has one and belongs to",
+			s:    NewSelector[PreloadOrder](db).Preload("Invoice", "Buyer"),
+			wantRes: []*PreloadOrder{
+				{Id: 1, BuyerId: 1, Buyer: tom},
+				{Id: 2, BuyerId: 1, Buyer: tom,
+					Invoice: &PreloadInvoice{Id: 1, OrderId: 2, Title: "invoice-2"}},
+				{Id: 3, BuyerId: 2, Buyer: jerry},
+			},
+		},
+		{
+			name: "nested",
+			s:    NewSelector[PreloadOrder](db).Where(C("Id").In(1, 2)).Preload("Items.Product"),
+			wantRes: []*PreloadOrder{
+				{Id: 1, BuyerId: 1, Items: []*PreloadItem{
+					{Id: 1, OrderId: 1, ProductId: 1, Product: apple},
+					{Id: 2, OrderId: 1, ProductId: 2, Product: banana},
+				}},
+				{Id: 2, BuyerId: 1, Items: []*PreloadItem{
+					{Id: 3, OrderId: 2, ProductId: 1, Product: apple},
+				}},
+			},
+		},
+		{
+			name:    "unknown relation",
+			s:       NewSelector[PreloadOrder](db).Preload("Items.Invalid"),
+			wantErr: errs.NewErrUnknownRelation("Invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.s.GetMulti(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+// PvOrder 关联字段不是指针, 父结构体里面保存的是副本
+type PvOrder struct {
+	Id      int64
+	BuyerId int64
+	Items   []PvItem  `orm:"has_many,foreign_key=OrderId"`
+	Invoice PvInvoice `orm:"has_one,foreign_key=OrderId"`
+}
+
+func (PvOrder) TableName() string {
+	return "preload_order"
+}
+
+type PvItem struct {
+	Id        int64
+	OrderId   int64
+	ProductId int64
+	Product   *PreloadProduct `orm:"belongs_to,foreign_key=ProductId"`
+}
+
+func (PvItem) TableName() string {
+	return "preload_item"
+}
+
+type PvInvoice struct {
+	Id      int64
+	OrderId int64
+	Title   string
+	Order   *PreloadOrder `orm:"belongs_to,foreign_key=OrderId"`
+}
+
+func (PvInvoice) TableName() string {
+	return "preload_invoice"
+}
+
+func TestSelector_Preload_value(t *testing.T) {
+	db, err := Open("sqlite3", "file:preload_value.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE preload_order(id INTEGER PRIMARY KEY, buyer_id INTEGER)",
+		"CREATE TABLE preload_item(id INTEGER PRIMARY KEY, order_id INTEGER, product_id INTEGER)",
+		"CREATE TABLE preload_invoice(id INTEGER PRIMARY KEY, order_id INTEGER, title TEXT)",
+		"CREATE TABLE preload_product(id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO preload_order VALUES (1, 1), (2, 1)",
+		"INSERT INTO preload_item VALUES (1, 1, 1), (2, 1, 2), (3, 2, 1)",
+		"INSERT INTO preload_invoice VALUES (1, 2, 'invoice-2')",
+		"INSERT INTO preload_product VALUES (1, 'apple'), (2, 'banana')",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	// 嵌套的关联关系写入父结构体里面的副本
+	res, err := NewSelector[PvOrder](db).Preload("Items.Product", "Invoice.Order").GetMulti(context.Background())
+	require.NoError(t, err)
+	apple := &PreloadProduct{Id: 1, Name: "apple"}
+	assert.Equal(t, []*PvOrder{
+		{Id: 1, BuyerId: 1, Items: []PvItem{
+			{Id: 1, OrderId: 1, ProductId: 1, Product: apple},
+			{Id: 2, OrderId: 1, ProductId: 2, Product: &PreloadProduct{Id: 2, Name: "banana"}},
+		}},
+		{Id: 2, BuyerId: 1,
+			Items:   []PvItem{{Id: 3, OrderId: 2, ProductId: 1, Product: apple}},
+			Invoice: PvInvoice{Id: 1, OrderId: 2, Title: "invoice-2", Order: &PreloadOrder{Id: 2, BuyerId: 1}},
+		},
+	}, res)
+}
+
+// PreloadKeyOrder 关联字段和主键的类型不一样
+type PreloadKeyOrder struct {
+	Id      int
+	BuyerId *int64
+	Buyer   *PreloadKeyUser   `orm:"belongs_to,foreign_key=BuyerId"`
+	Items   []*PreloadKeyItem `orm:"has_many,foreign_key=OrderId"`
+}
+
+type PreloadKeyUser struct {
+	Id   int64
+	Name string
+}
+
+type PreloadKeyItem struct {
+	Id      int64
+	OrderId sql.NullInt64
+}
+
+// smallPlaceholderDialect 每条语句只能有两个占位符, 用来测试 IN 分批查询
+type smallPlaceholderDialect struct {
+	sqlite3Dialect
+}
+
+func (smallPlaceholderDialect) maxPlaceholders() int {
+	return 2
+}
+
+func TestSelector_Preload_keyTypes(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      []DBOption
+		wantQuery int
+	}{
+		{
+			name:      "one query",
+			wantQuery: 3,
+		},
+		{
+			// 每批一个主键, 三个订单查询三次订单项, 两个用户查询两次
+			name:      "chunked",
+			opts:      []DBOption{DBWithDialect(smallPlaceholderDialect{})},
+			wantQuery: 6,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var cnt int
+			opts := append(tc.opts, DBWithStatementHook(func(ctx context.Context, query *Query) {
+				cnt++
+			}))
+			db, err := Open("sqlite3", "file:preload_key_"+strings.ReplaceAll(tc.name, " ", "_")+".db?cache=shared&mode=memory", opts...)
+			require.NoError(t, err)
+			for _, stmt := range []string{
+				"CREATE TABLE preload_key_order(id INTEGER PRIMARY KEY, buyer_id INTEGER)",
+				"CREATE TABLE preload_key_user(id INTEGER PRIMARY KEY, name TEXT)",
+				"CREATE TABLE preload_key_item(id INTEGER PRIMARY KEY, order_id INTEGER)",
+				"INSERT INTO preload_key_order VALUES (1, 1), (2, 2), (3, NULL)",
+				"INSERT INTO preload_key_user VALUES (1, 'Tom'), (2, 'Jerry')",
+				"INSERT INTO preload_key_item VALUES (1, 1), (2, 1), (3, 2), (4, NULL)",
+			} {
+				_, err = db.db.Exec(stmt)
+				require.NoError(t, err)
+			}
+
+			res, err := NewSelector[PreloadKeyOrder](db).Preload("Buyer", "Items").GetMulti(context.Background())
+			require.NoError(t, err)
+			one, two := int64(1), int64(2)
+			assert.Equal(t, []*PreloadKeyOrder{
+				{Id: 1, BuyerId: &one, Buyer: &PreloadKeyUser{Id: 1, Name: "Tom"}, Items: []*PreloadKeyItem{
+					{Id: 1, OrderId: sql.NullInt64{Int64: 1, Valid: true}},
+					{Id: 2, OrderId: sql.NullInt64{Int64: 1, Valid: true}},
+				}},
+				{Id: 2, BuyerId: &two, Buyer: &PreloadKeyUser{Id: 2, Name: "Jerry"}, Items: []*PreloadKeyItem{
+					{Id: 3, OrderId: sql.NullInt64{Int64: 2, Valid: true}},
+				}},
+				{Id: 3, Items: []*PreloadKeyItem{}},
+			}, res)
+			assert.Equal(t, tc.wantQuery, cnt)
+		})
+	}
+}
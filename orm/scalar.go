@@ -0,0 +1,153 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/model"
+)
+
+// rawSelectable 原样输出到 SELECT 后面, 只在内部使用, 例如 COUNT(*)
+type rawSelectable string
+
+func (rawSelectable) selectable() {}
+
+// Count 返回满足条件的行数
+// 忽略 ORDER BY, LIMIT 和 OFFSET, 一般用来在分页的时候查询总数
+// 嵌套的结构体有切片的时候, 返回的是合并之后的结构体的个数
+func (s *Selector[T]) Count(ctx context.Context) (int64, error) {
+	col, err := s.countColumn()
+	if err != nil {
+		return 0, err
+	}
+	query, err := s.buildScalar(ctx, col, 0)
+	if err != nil {
+		return 0, err
+	}
+	return scanScalar[int64](ctx, s.sess, query)
+}
+
+// countColumn 一对多的 JOIN 一个父结构体对应多行, 按照第一个嵌套结构体的主键去重
+// 例如 COUNT(DISTINCT `o`.`id`)
+func (s *Selector[T]) countColumn() (Selectable, error) {
+	m, err := s.db.r.Get(new(T))
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range m.Nested {
+		if n.Kind != model.NestedSlice {
+			continue
+		}
+		root := m.Nested[0]
+		b := builder{dialect: s.db.dialect}
+		b.sb.WriteString("COUNT(DISTINCT ")
+		b.quote(root.Alias)
+		b.sb.WriteByte('.')
+		b.quote(root.Model.PrimaryKey.ColName)
+		b.sb.WriteByte(')')
+		return rawSelectable(b.sb.String()), nil
+	}
+	return rawSelectable("COUNT(*)"), nil
+}
+
+// Exists 是否存在满足条件的行, 只查询一行
+func (s *Selector[T]) Exists(ctx context.Context) (bool, error) {
+	query, err := s.buildScalar(ctx, rawSelectable("1"), 1)
+	if err != nil {
+		return false, err
+	}
+	_, err = scanScalar[int](ctx, s.sess, query)
+	if err == ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// buildScalar 只查询 col 这一列, 构造完之后恢复 Selector 原本的设置
+// limit 不为 0 的时候, 去掉 ORDER BY 和 OFFSET, 用 limit 代替原本的 LIMIT
+// limit 为 0 的时候, 去掉 ORDER BY, LIMIT 和 OFFSET
+func (s *Selector[T]) buildScalar(ctx context.Context, col Selectable, limit int) (*Query, error) {
+	columns, orderBy, oldLimit, offset := s.columns, s.orderBy, s.limit, s.offset
+	defer func() {
+		s.columns, s.orderBy, s.limit, s.offset = columns, orderBy, oldLimit, offset
+	}()
+	s.columns, s.orderBy, s.limit, s.offset = []Selectable{col}, nil, limit, 0
+	s.from(ctx)
+	return s.Build()
+}
+
+// buildPluck 只查询 col 这一列, 其余的设置不变
+func (s *Selector[T]) buildPluck(ctx context.Context, col Selectable) (*Query, error) {
+	if c, ok := col.(Column); ok {
+		m, err := s.db.r.Get(new(T))
+		if err != nil {
+			return nil, err
+		}
+		// 加密字段要解密, 只能查询整个模型
+		if _, fd, ok := m.FieldOf(c.name); ok && fd.Encrypt != model.EncryptNone {
+			return nil, errs.NewErrEncryptedColumn(c.name)
+		}
+	}
+	columns := s.columns
+	defer func() {
+		s.columns = columns
+	}()
+	s.columns = []Selectable{col}
+	s.from(ctx)
+	return s.Build()
+}
+
+// Pluck 查询一列, 不需要定义结构体
+// 例如 Pluck[User, int64](ctx, NewSelector[User](db).Where(C("Age").GT(18)), C("Id"))
+// 返回所有年龄大于 18 的用户的 id
+func Pluck[T any, V any](ctx context.Context, sel *Selector[T], col Selectable) ([]V, error) {
+	query, err := sel.buildPluck(ctx, col)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sel.sess.queryContext(ctx, query.SQL, query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	res := make([]V, 0, 8)
+	for rows.Next() {
+		var v V
+		if err = rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, sel.db.dialect.translateErr(rows.Err())
+}
+
+// Scalar 查询一个值, 例如某个用户的名字
+// 没有数据的时候返回 ErrNoRows, 有多行的时候只取第一行
+func Scalar[T any, V any](ctx context.Context, sel *Selector[T], col Selectable) (V, error) {
+	query, err := sel.buildPluck(ctx, col)
+	if err != nil {
+		var v V
+		return v, err
+	}
+	return scanScalar[V](ctx, sel.sess, query)
+}
+
+func scanScalar[V any](ctx context.Context, sess Session, query *Query) (V, error) {
+	var v V
+	rows, err := sess.queryContext(ctx, query.SQL, query.Args...)
+	if err != nil {
+		return v, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return v, sess.getDB().dialect.translateErr(err)
+		}
+		return v, ErrNoRows
+	}
+	err = rows.Scan(&v)
+	return v, err
+}
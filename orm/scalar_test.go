@@ -0,0 +1,136 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type ScalarUser struct {
+	Id    int64
+	Name  string
+	Age   int
+	Phone string `orm:"encrypt=deterministic"`
+}
+
+func TestSelector_buildScalar(t *testing.T) {
+	db, err := OpenDB(nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	s := NewSelector[ScalarUser](db).Where(C("Age").GT(18)).OrderBy(Desc("Age")).Limit(10).Offset(20)
+
+	testCases := []struct {
+		name      string
+		build     func() (*Query, error)
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "count",
+			build: func() (*Query, error) {
+				return s.buildScalar(ctx, rawSelectable("COUNT(*)"), 0)
+			},
+			wantQuery: &Query{
+				SQL:  "SELECT COUNT(*) FROM `scalar_user` WHERE `age` > ?;",
+				Args: []any{18},
+			},
+		},
+		{
+			name: "exists",
+			build: func() (*Query, error) {
+				return s.buildScalar(ctx, rawSelectable("1"), 1)
+			},
+			wantQuery: &Query{
+				SQL:  "SELECT 1 FROM `scalar_user` WHERE `age` > ? LIMIT ?;",
+				Args: []any{18, 1},
+			},
+		},
+		{
+			// Pluck 保留排序和分页
+			name: "pluck",
+			build: func() (*Query, error) {
+				return s.buildPluck(ctx, C("Id"))
+			},
+			wantQuery: &Query{
+				SQL:  "SELECT `id` FROM `scalar_user` WHERE `age` > ? ORDER BY `age` DESC LIMIT ? OFFSET ?;",
+				Args: []any{18, 10, 20},
+			},
+		},
+		{
+			name: "pluck encrypted",
+			build: func() (*Query, error) {
+				return s.buildPluck(ctx, C("Phone"))
+			},
+			wantErr: errs.NewErrEncryptedColumn("Phone"),
+		},
+		{
+			name: "pluck unknown field",
+			build: func() (*Query, error) {
+				return s.buildPluck(ctx, C("Invalid"))
+			},
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+		{
+			// 构造之后恢复原本的设置
+			name:  "restore",
+			build: s.Build,
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `scalar_user` WHERE `age` > ? ORDER BY `age` DESC LIMIT ? OFFSET ?;",
+				Args: []any{18, 10, 20},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestScalar(t *testing.T) {
+	db, err := Open("sqlite3", "file:scalar.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE scalar_user(id INTEGER PRIMARY KEY, name TEXT, age INTEGER, phone TEXT)",
+		"INSERT INTO scalar_user(id, name, age) VALUES (1, 'Tom', 18), (2, 'Jerry', 20), (3, NULL, 30)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+
+	cnt, err := NewSelector[ScalarUser](db).Where(C("Age").GT(18)).Limit(1).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	ok, err := NewSelector[ScalarUser](db).Where(C("Age").GT(18)).Exists(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = NewSelector[ScalarUser](db).Where(C("Age").GT(100)).Exists(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ids, err := Pluck[ScalarUser, int64](ctx, NewSelector[ScalarUser](db).OrderBy(Desc("Id")), C("Id"))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 2, 1}, ids)
+
+	// 可以为 NULL 的列用 sql.NullString
+	names, err := Pluck[ScalarUser, sql.NullString](ctx, NewSelector[ScalarUser](db).Where(C("Age").GT(18)), C("Name"))
+	require.NoError(t, err)
+	assert.Equal(t, []sql.NullString{{String: "Jerry", Valid: true}, {}}, names)
+
+	name, err := Scalar[ScalarUser, string](ctx, NewSelector[ScalarUser](db).Where(C("Id").EQ(1)), C("Name"))
+	require.NoError(t, err)
+	assert.Equal(t, "Tom", name)
+	_, err = Scalar[ScalarUser, string](ctx, NewSelector[ScalarUser](db).Where(C("Id").EQ(100)), C("Name"))
+	assert.Equal(t, ErrNoRows, err)
+}
@@ -2,75 +2,183 @@ package orm
 
 import (
 	"context"
-	"geektime-go-study/orm/internal/errs"
-	"geektime-go-study/orm/model"
-	"strings"
+	"database/sql"
+	"reflect"
 )
 
 // Selector 使用泛型做类型约束
 type Selector[T any] struct {
-	tbl     string
-	where   []Predicate
-	sb      strings.Builder
-	args    []any
-	m       *model.Model
+	builder
+	tenantScope
+	tbl   string
+	where []Predicate
+	// db 提供元数据, 方言这些配置, sess 负责执行查询
+	// 在事务中 sess 是 *Tx, 否则就是 db 本身
 	db      *DB
+	sess    Session
 	columns []Selectable
+	orderBy []OrderBy
+	limit   int
+	offset  int
+	// preloads 需要预加载的关联关系, 例如 Items, Items.Product
+	preloads []string
+	lock     lockClause
+	ctes     []cte
+	// joins 查询嵌套的结构体的时候 JOIN 的表
+	joins []join
 }
 
-func NewSelector[T any](db *DB) *Selector[T] {
+func NewSelector[T any](sess Session) *Selector[T] {
 	return &Selector[T]{
-		db: db,
+		db:   sess.getDB(),
+		sess: sess,
 	}
 }
 
 func (s *Selector[T]) Get(ctx context.Context) (*T, error) {
+	// step 0 查询前的钩子, 此时 val 还是零值
+	val := new(T)
+	if err := beforeQuery(ctx, val); err != nil {
+		return nil, err
+	}
+
 	// step 1 构建sql
+	s.from(ctx)
 	query, err := s.Build()
 	if err != nil {
 		return nil, err
 	}
 
 	// step 2 发起查询
-	// s.db 是我们定义的 DB
-	// s.db.db 则是 sql.DB
+	// s.sess 是 DB 或者 Tx
+	// s.sess.queryContext 会翻译驱动的错误
 	// 使用 QueryContext，从而和 GetMulti 能够复用处理结果集的代码
-	rows, err := s.db.db.QueryContext(ctx, query.SQL, query.Args...)
+	rows, err := s.sess.queryContext(ctx, query.SQL, query.Args...)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		_ = rows.Close()
+	}()
 
 	// 没有数据的话, 返回error 跟sql包语义一致
 	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, s.db.dialect.translateErr(err)
+		}
 		return nil, ErrNoRows
 	}
 
 	// step 3 结果集转为对象
-	// step 3.1 创建对象
-	val := new(T)
-	// step 3.2 获取元数据
-	meta, err := s.db.r.Get(val)
+	if err = s.scan(rows, val); err != nil {
+		return nil, err
+	}
+	// 一对多的 JOIN, 把后面属于同一个父结构体的行合并进来
+	if mg := newMerger(s.m); mg != nil {
+		mg.merge(val)
+		for rows.Next() {
+			next := new(T)
+			if err = s.scan(rows, next); err != nil {
+				return nil, err
+			}
+			mg.merge(next)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, s.db.dialect.translateErr(err)
+		}
+	}
+
+	// step 4 查询后的钩子
+	if err = afterQuery(ctx, val); err != nil {
+		return nil, err
+	}
+	// 工作单元会跟踪查询出来的实体
+	if val, err = tracked(s.sess, s.m, val); err != nil {
+		return nil, err
+	}
+
+	// step 5 预加载关联关系
+	if err = s.preload(ctx, []*T{val}); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (s *Selector[T]) GetMulti(ctx context.Context) ([]*T, error) {
+	if err := beforeQuery(ctx, new(T)); err != nil {
+		return nil, err
+	}
+
+	s.from(ctx)
+	query, err := s.Build()
 	if err != nil {
 		return nil, err
 	}
-	// step 3.3 创建转换对象
-	creator := s.db.valCreator(val, meta)
-	// step 3.4 设置值
-	err = creator.SetColumns(rows)
+
+	rows, err := s.sess.queryContext(ctx, query.SQL, query.Args...)
 	if err != nil {
 		return nil, err
 	}
-	return val, err
+	defer func() {
+		_ = rows.Close()
+	}()
 
+	res := make([]*T, 0, 8)
+	// 一对多的 JOIN 会把多行合并为一个结构体
+	mg := newMerger(s.m)
+	for rows.Next() {
+		val := new(T)
+		if err = s.scan(rows, val); err != nil {
+			return nil, err
+		}
+		if mg.merge(val) {
+			continue
+		}
+		res = append(res, val)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, s.db.dialect.translateErr(err)
+	}
+	// 合并完之后才调用钩子
+	for i, val := range res {
+		if err = afterQuery(ctx, val); err != nil {
+			return nil, err
+		}
+		if res[i], err = tracked(s.sess, s.m, val); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.preload(ctx, res); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-func (s *Selector[T]) GetMulti(ctx context.Context) ([]*T, error) {
-	//TODO implement me
-	panic("implement me")
+// preload 在主查询之后加载关联关系
+func (s *Selector[T]) preload(ctx context.Context, vals []*T) error {
+	if len(s.preloads) == 0 || len(vals) == 0 {
+		return nil
+	}
+	parents := make([]reflect.Value, 0, len(vals))
+	for _, val := range vals {
+		parents = append(parents, reflect.ValueOf(val))
+	}
+	return preloader{db: s.db, sess: s.sess, tenant: s.tenantScope}.load(ctx, s.m, parents, newPreloadTree(s.preloads))
+}
+
+// scan 把当前行写入 val
+func (s *Selector[T]) scan(rows *sql.Rows, val *T) error {
+	// 获取元数据
+	meta, err := s.db.r.Get(val)
+	if err != nil {
+		return err
+	}
+	// 创建转换对象, 设置值
+	return s.db.newValuer(val, meta).SetColumns(rows)
 }
 
 func (s *Selector[T]) Build() (*Query, error) {
-	s.sb.Reset()
+	s.reset()
 	// 决策：如果用户指定了表名，就直接使用，不会使用反引号；否则使用反引号括起来。
 	var (
 		t   T
@@ -80,17 +188,22 @@ func (s *Selector[T]) Build() (*Query, error) {
 	if err != nil {
 		return nil, err
 	}
+	s.cipher, s.dialect = s.db.cipher, s.db.dialect
+	if err = s.buildWith(); err != nil {
+		return nil, err
+	}
 	s.sb.WriteString("SELECT ")
 
-	if len(s.columns) == 0 {
+	if len(s.columns) == 0 && len(s.m.Nested) > 0 {
+		s.buildNestedColumns()
+	} else if len(s.columns) == 0 {
 		s.sb.WriteString("*")
 	} else {
 		for i, c := range s.columns {
 			if i != 0 {
 				s.sb.WriteByte(',')
 			}
-			err := s.buildColumn(c.(Column))
-			if err != nil {
+			if err = s.buildSelectable(c); err != nil {
 				return nil, err
 			}
 		}
@@ -98,26 +211,53 @@ func (s *Selector[T]) Build() (*Query, error) {
 
 	s.sb.WriteString(" FROM ")
 
-	if s.tbl == "" {
-		s.sb.WriteByte('`')
-		s.sb.WriteString(s.m.TableName)
-		s.sb.WriteByte('`')
-	} else {
+	switch {
+	case s.tbl != "":
 		s.sb.WriteString(s.tbl)
+	case len(s.m.Nested) > 0:
+		if err = s.buildJoins(); err != nil {
+			return nil, err
+		}
+	default:
+		s.quote(s.m.TableName)
 	}
 
-	if len(s.where) > 0 {
+	// 注入租户条件
+	where, err := s.withTenant(s.m, s.where)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.m.Nested) > 0 {
+		if where, err = s.nestedWhere(where); err != nil {
+			return nil, err
+		}
+	}
+	if len(where) > 0 {
 		s.sb.WriteString(" WHERE ")
-		p := s.where[0]
-		// 用And 合并多个Predicate
-		for i := 1; i < len(s.where); i++ {
-			p = p.And(s.where[i])
+		if err = s.buildPredicates(where); err != nil {
+			return nil, err
 		}
+	}
 
-		if err := s.buildExpression(p); err != nil {
+	if len(s.orderBy) > 0 {
+		s.sb.WriteString(" ORDER BY ")
+		if err := s.buildOrderBy(s.orderBy); err != nil {
 			return nil, err
 		}
+	}
+
+	if s.limit > 0 {
+		s.sb.WriteString(" LIMIT ?")
+		s.addArgs(s.limit)
+	}
 
+	if s.offset > 0 {
+		s.sb.WriteString(" OFFSET ?")
+		s.addArgs(s.offset)
+	}
+
+	if err = s.buildLock(); err != nil {
+		return nil, err
 	}
 
 	s.sb.WriteString(";")
@@ -127,57 +267,6 @@ func (s *Selector[T]) Build() (*Query, error) {
 	}, nil
 }
 
-func (s *Selector[T]) buildExpression(e Expression) error {
-	switch exp := e.(type) {
-	case Predicate:
-		_, lp := exp.left.(Predicate)
-		if lp {
-			s.sb.WriteByte('(')
-		}
-		if err := s.buildExpression(exp.left); err != nil {
-			return err
-		}
-		if lp {
-			s.sb.WriteByte(')')
-		}
-
-		s.sb.WriteByte(' ')
-		s.sb.WriteString(exp.op.String())
-		s.sb.WriteByte(' ')
-		_, rp := exp.right.(Predicate)
-		if rp {
-			s.sb.WriteByte('(')
-		}
-		if err := s.buildExpression(exp.right); err != nil {
-			return err
-		}
-		if rp {
-			s.sb.WriteByte(')')
-		}
-	case Column:
-		return s.buildColumn(exp)
-	case value:
-		s.sb.WriteByte('?')
-		s.args = append(s.args, exp.val)
-	case nil:
-		return nil
-	default:
-		return errs.NewErrUnsupportedExpressionType(exp)
-	}
-	return nil
-}
-
-func (s *Selector[T]) buildColumn(c Column) error {
-	field, ok := s.m.FieldMap[c.name]
-	if !ok {
-		return errs.NewErrUnknownField(c.name)
-	}
-	s.sb.WriteByte('`')
-	s.sb.WriteString(field.ColName)
-	s.sb.WriteByte('`')
-	return nil
-}
-
 // From 考虑 FROM，可行的思路是:
 // • Selector 本身有泛型参数，我们用泛型的类型名字作为表名
 // • 加入一个 From 方法：如果用户调用了这个方法，那么我们就用这 个方法的参数来作为表名
@@ -203,8 +292,51 @@ func (s *Selector[T]) Select(cols ...Selectable) *Selector[T] {
 	return s
 }
 
+func (s *Selector[T]) OrderBy(obs ...OrderBy) *Selector[T] {
+	s.orderBy = obs
+	return s
+}
+
+func (s *Selector[T]) Limit(limit int) *Selector[T] {
+	s.limit = limit
+	return s
+}
+
+func (s *Selector[T]) Offset(offset int) *Selector[T] {
+	s.offset = offset
+	return s
+}
+
+// CrossTenant 显式声明跨租户查询, 不会注入租户条件
+// 对于声明了租户字段的模型, 没有租户又没有调用这个方法的查询会返回 ErrNoTenant
+func (s *Selector[T]) CrossTenant() *Selector[T] {
+	s.cross = true
+	return s
+}
+
+// Preload 预加载关联关系, 传入的是关联字段名
+// 支持 Items.Product 这种嵌套的形式
+func (s *Selector[T]) Preload(rels ...string) *Selector[T] {
+	s.preloads = append(s.preloads, rels...)
+	return s
+}
+
 // Selectable 标记接口, 可以作为select xxx 里面 的xxx
-// 有 Column
+// 有 Column 和 Window
 type Selectable interface {
 	selectable()
 }
+
+// OrderBy 排序, 例如 Asc("Id"), Desc("CreateTime")
+type OrderBy struct {
+	col   string
+	order string
+}
+
+func Asc(col string) OrderBy {
+	return OrderBy{col: col, order: "ASC"}
+}
+
+func Desc(col string) OrderBy {
+	return OrderBy{col: col, order: "DESC"}
+}
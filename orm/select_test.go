@@ -177,6 +177,29 @@ func TestSelector_Build(t *testing.T) {
 			},
 		},
 
+		{
+			// 使用 IN
+			name: "in",
+			q:    NewSelector[TestModel](db).Where(C("Id").In(1, 2, 3)),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `id` IN (?,?,?);",
+				Args: []any{1, 2, 3},
+			},
+		},
+		{
+			name: "order by limit offset",
+			q: NewSelector[TestModel](db).Where(C("Age").GT(18)).
+				OrderBy(Asc("Age"), Desc("Id")).Limit(10).Offset(20),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `test_model` WHERE `age` > ? ORDER BY `age` ASC,`id` DESC LIMIT ? OFFSET ?;",
+				Args: []any{18, 10, 20},
+			},
+		},
+		{
+			name:    "invalid order by",
+			q:       NewSelector[TestModel](db).OrderBy(Asc("Invalid")),
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
 		{
 			name:    "invalid column",
 			q:       NewSelector[TestModel](db).Where(Not(C("Unkown").GT(18))),
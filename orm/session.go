@@ -0,0 +1,61 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Session 会话, DB 和 Tx 都是 Session
+// Selector 这些只依赖 Session, 从而可以在事务内外复用
+type Session interface {
+	// getDB 拿到元数据注册中心, 方言这些配置
+	getDB() *DB
+	// conn 查询实际使用的连接, Explain 这种不经过 queryContext 的语句也要在同一个连接上执行
+	conn() sqlConn
+	queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	execContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// sqlConn 是 *sql.DB 和 *sql.Tx 的公共方法
+type sqlConn interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// queryContext 所有的查询都经过这里, 统一转换占位符, 做全表扫描检测和翻译驱动的错误
+func queryContext(ctx context.Context, db *DB, conn sqlConn, query string, args ...any) (*sql.Rows, error) {
+	query = db.dialect.rebind(query)
+	db.runStatementHooks(ctx, query, args)
+	if db.fullScan != nil {
+		if err := db.checkFullScan(ctx, conn, query, args); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, db.dialect.translateErr(err)
+	}
+	return rows, nil
+}
+
+// execContext 所有的写操作都经过这里, 统一转换占位符和翻译驱动的错误
+func execContext(ctx context.Context, db *DB, conn sqlConn, query string, args ...any) (sql.Result, error) {
+	query = db.dialect.rebind(query)
+	db.runStatementHooks(ctx, query, args)
+	res, err := conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, db.dialect.translateErr(err)
+	}
+	return res, nil
+}
+
+func (db *DB) runStatementHooks(ctx context.Context, query string, args []any) {
+	if len(db.stmtHooks) == 0 {
+		return
+	}
+	q := &Query{SQL: query, Args: args}
+	for _, hook := range db.stmtHooks {
+		hook(ctx, q)
+	}
+}
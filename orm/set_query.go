@@ -0,0 +1,298 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"strconv"
+	"strings"
+)
+
+type setOp string
+
+const (
+	setUnion     setOp = "UNION"
+	setUnionAll  setOp = "UNION ALL"
+	setIntersect setOp = "INTERSECT"
+	setExcept    setOp = "EXCEPT"
+)
+
+// SetOperand 可以参与 UNION 这些集合运算的查询, 有 Selector 和 SetQuery
+type SetOperand interface {
+	QueryBuilder
+	tenantInheritor
+	// columnCount 返回的列数, 用来在构造 SQL 的时候发现两边的列数不一致
+	columnCount() (int, error)
+	// standalone 能不能不加括号直接放进集合运算里面
+	// 带了 ORDER BY, LIMIT 这些子句的查询不行, 要包成子查询
+	standalone() bool
+	// compoundOp 集合运算的操作符, Selector 返回空字符串
+	compoundOp() setOp
+}
+
+// SetQuery 集合运算, 例如
+//
+//	NewSelector[User](db).Where(C("Age").LT(18)).
+//		Union(NewSelector[User](db).Where(C("Age").GT(60))).
+//		OrderBy(Asc("Id")).Limit(10)
+//
+// 链式调用按照从左到右的顺序计算, 即 a.Union(b).Intersect(c) 是 (a UNION b) INTERSECT c
+// 结果写回 T, 所以列名以最左边的查询为准
+type SetQuery[T any] struct {
+	builder
+	tenantScope
+	db   *DB
+	sess Session
+
+	left  SetOperand
+	op    setOp
+	right SetOperand
+
+	orderBy []OrderBy
+	limit   int
+	offset  int
+
+	// aliasCnt 子查询的别名的计数
+	aliasCnt int
+}
+
+func newSetQuery[T any](db *DB, sess Session, left SetOperand, op setOp, right SetOperand) *SetQuery[T] {
+	return &SetQuery[T]{
+		db:    db,
+		sess:  sess,
+		left:  left,
+		op:    op,
+		right: right,
+	}
+}
+
+func (s *Selector[T]) Union(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](s.db, s.sess, s, setUnion, other)
+}
+
+func (s *Selector[T]) UnionAll(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](s.db, s.sess, s, setUnionAll, other)
+}
+
+func (s *Selector[T]) Intersect(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](s.db, s.sess, s, setIntersect, other)
+}
+
+func (s *Selector[T]) Except(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](s.db, s.sess, s, setExcept, other)
+}
+
+func (s *Selector[T]) columnCount() (int, error) {
+	if len(s.columns) > 0 {
+		return len(s.columns), nil
+	}
+	m, err := s.db.r.Get(new(T))
+	if err != nil {
+		return 0, err
+	}
+	return len(m.Fields), nil
+}
+
+func (s *Selector[T]) standalone() bool {
+	return len(s.ctes) == 0 && len(s.orderBy) == 0 && s.limit == 0 && s.offset == 0 &&
+		s.lock.mode == lockNone
+}
+
+func (s *Selector[T]) compoundOp() setOp {
+	return ""
+}
+
+func (q *SetQuery[T]) Union(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](q.db, q.sess, q, setUnion, other)
+}
+
+func (q *SetQuery[T]) UnionAll(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](q.db, q.sess, q, setUnionAll, other)
+}
+
+func (q *SetQuery[T]) Intersect(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](q.db, q.sess, q, setIntersect, other)
+}
+
+func (q *SetQuery[T]) Except(other SetOperand) *SetQuery[T] {
+	return newSetQuery[T](q.db, q.sess, q, setExcept, other)
+}
+
+// OrderBy 对整个结果集排序
+func (q *SetQuery[T]) OrderBy(obs ...OrderBy) *SetQuery[T] {
+	q.orderBy = obs
+	return q
+}
+
+func (q *SetQuery[T]) Limit(limit int) *SetQuery[T] {
+	q.limit = limit
+	return q
+}
+
+func (q *SetQuery[T]) Offset(offset int) *SetQuery[T] {
+	q.offset = offset
+	return q
+}
+
+func (q *SetQuery[T]) columnCount() (int, error) {
+	return q.left.columnCount()
+}
+
+func (q *SetQuery[T]) standalone() bool {
+	return len(q.orderBy) == 0 && q.limit == 0 && q.offset == 0
+}
+
+func (q *SetQuery[T]) compoundOp() setOp {
+	return q.op
+}
+
+func (q *SetQuery[T]) Build() (*Query, error) {
+	q.reset()
+	q.dialect = q.db.dialect
+	q.aliasCnt = 0
+	var err error
+	q.m, err = q.db.r.Get(new(T))
+	if err != nil {
+		return nil, err
+	}
+
+	leftCnt, err := q.left.columnCount()
+	if err != nil {
+		return nil, err
+	}
+	rightCnt, err := q.right.columnCount()
+	if err != nil {
+		return nil, err
+	}
+	if leftCnt != rightCnt {
+		return nil, errs.NewErrSetColumnMismatch(leftCnt, rightCnt)
+	}
+
+	// 标准 SQL 里面 INTERSECT 的优先级比 UNION 和 EXCEPT 高, 但是 SQLite 是从左到右计算的
+	// 所以左边是 UNION, 右边是 INTERSECT 的时候, 左边要包成子查询, 保证在不同的数据库里面结果一样
+	leftOp := q.left.compoundOp()
+	wrapLeft := !q.left.standalone() || (q.op == setIntersect && leftOp != "" && leftOp != setIntersect)
+	if err = q.buildOperand(q.left, wrapLeft); err != nil {
+		return nil, err
+	}
+	q.sb.WriteByte(' ')
+	q.sb.WriteString(string(q.op))
+	q.sb.WriteByte(' ')
+	// 右边的集合运算都要包起来, 不然就变成从左到右计算了
+	wrapRight := !q.right.standalone() || q.right.compoundOp() != ""
+	if err = q.buildOperand(q.right, wrapRight); err != nil {
+		return nil, err
+	}
+
+	if len(q.orderBy) > 0 {
+		q.sb.WriteString(" ORDER BY ")
+		if err = q.buildOrderBy(q.orderBy); err != nil {
+			return nil, err
+		}
+	}
+	if q.limit > 0 {
+		q.sb.WriteString(" LIMIT ?")
+		q.addArgs(q.limit)
+	}
+	if q.offset > 0 {
+		q.sb.WriteString(" OFFSET ?")
+		q.addArgs(q.offset)
+	}
+	q.sb.WriteByte(';')
+	return &Query{
+		SQL:  q.sb.String(),
+		Args: q.args,
+	}, nil
+}
+
+// buildOperand 不能直接放进集合运算的查询包成 SELECT * FROM (...) AS `_tN`
+// SQLite 不支持 (SELECT ...) UNION (SELECT ...) 这种写法, 所以用子查询而不是括号
+func (q *SetQuery[T]) buildOperand(o SetOperand, wrap bool) error {
+	o.inherit(q.tenantScope)
+	query, err := o.Build()
+	if err != nil {
+		return err
+	}
+	if wrap {
+		q.sb.WriteString("SELECT * FROM (")
+	}
+	q.sb.WriteString(strings.TrimSuffix(query.SQL, ";"))
+	if wrap {
+		q.aliasCnt++
+		q.sb.WriteString(") AS ")
+		q.quote("_t" + strconv.Itoa(q.aliasCnt))
+	}
+	q.addArgs(query.Args...)
+	return nil
+}
+
+func (q *SetQuery[T]) Get(ctx context.Context) (*T, error) {
+	val := new(T)
+	if err := beforeQuery(ctx, val); err != nil {
+		return nil, err
+	}
+	q.from(ctx)
+	query, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.sess.queryContext(ctx, query.SQL, query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, q.db.dialect.translateErr(err)
+		}
+		return nil, ErrNoRows
+	}
+	if err = q.scan(rows, val); err != nil {
+		return nil, err
+	}
+	if err = afterQuery(ctx, val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (q *SetQuery[T]) GetMulti(ctx context.Context) ([]*T, error) {
+	if err := beforeQuery(ctx, new(T)); err != nil {
+		return nil, err
+	}
+	q.from(ctx)
+	query, err := q.Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.sess.queryContext(ctx, query.SQL, query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	res := make([]*T, 0, 8)
+	for rows.Next() {
+		val := new(T)
+		if err = q.scan(rows, val); err != nil {
+			return nil, err
+		}
+		if err = afterQuery(ctx, val); err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, q.db.dialect.translateErr(rows.Err())
+}
+
+func (q *SetQuery[T]) scan(rows *sql.Rows, val *T) error {
+	meta, err := q.db.r.Get(val)
+	if err != nil {
+		return err
+	}
+	return q.db.newValuer(val, meta).SetColumns(rows)
+}
@@ -0,0 +1,189 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type SetUser struct {
+	Id   int64
+	Name string
+}
+
+type SetAdmin struct {
+	Id   int64
+	Name string
+	Role string
+}
+
+func TestSetQuery_Build(t *testing.T) {
+	db := memoryDB(t)
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "union",
+			q: NewSelector[SetUser](db).Where(C("Id").LT(10)).
+				Union(NewSelector[SetUser](db).Where(C("Id").GT(100))),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `set_user` WHERE `id` < ? UNION SELECT * FROM `set_user` WHERE `id` > ?;",
+				Args: []any{10, 100},
+			},
+		},
+		{
+			name: "union all with different model",
+			q: NewSelector[SetUser](db).
+				UnionAll(NewSelector[SetAdmin](db).Select(C("Id"), C("Name"))).
+				OrderBy(Desc("Id")).Limit(10).Offset(20),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `set_user` UNION ALL SELECT `id`,`name` FROM `set_admin` ORDER BY `id` DESC LIMIT ? OFFSET ?;",
+				Args: []any{10, 20},
+			},
+		},
+		{
+			name: "chain",
+			q: NewSelector[SetUser](db).Where(C("Id").EQ(1)).
+				Except(NewSelector[SetUser](db).Where(C("Id").EQ(2))).
+				UnionAll(NewSelector[SetUser](db).Where(C("Id").EQ(3))),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `set_user` WHERE `id` = ? EXCEPT SELECT * FROM `set_user` WHERE `id` = ? UNION ALL SELECT * FROM `set_user` WHERE `id` = ?;",
+				Args: []any{1, 2, 3},
+			},
+		},
+		{
+			// 保证先算 UNION
+			name: "intersect after union",
+			q: NewSelector[SetUser](db).
+				Union(NewSelector[SetUser](db)).
+				Intersect(NewSelector[SetUser](db)),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM (SELECT * FROM `set_user` UNION SELECT * FROM `set_user`) AS `_t1` INTERSECT SELECT * FROM `set_user`;",
+			},
+		},
+		{
+			name: "nested right",
+			q: NewSelector[SetUser](db).
+				Except(NewSelector[SetUser](db).Where(C("Id").EQ(1)).Union(NewSelector[SetUser](db).Where(C("Id").EQ(2)))),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `set_user` EXCEPT SELECT * FROM (SELECT * FROM `set_user` WHERE `id` = ? UNION SELECT * FROM `set_user` WHERE `id` = ?) AS `_t1`;",
+				Args: []any{1, 2},
+			},
+		},
+		{
+			name: "operand with limit",
+			q: NewSelector[SetUser](db).OrderBy(Desc("Id")).Limit(1).
+				Union(NewSelector[SetUser](db).OrderBy(Asc("Id")).Limit(1)),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM (SELECT * FROM `set_user` ORDER BY `id` DESC LIMIT ?) AS `_t1` UNION SELECT * FROM (SELECT * FROM `set_user` ORDER BY `id` ASC LIMIT ?) AS `_t2`;",
+				Args: []any{1, 1},
+			},
+		},
+		{
+			name:    "column mismatch",
+			q:       NewSelector[SetUser](db).Union(NewSelector[SetAdmin](db)),
+			wantErr: errs.NewErrSetColumnMismatch(2, 3),
+		},
+		{
+			name:    "column mismatch with select",
+			q:       NewSelector[SetUser](db).Select(C("Id")).Union(NewSelector[SetUser](db)),
+			wantErr: errs.NewErrSetColumnMismatch(1, 2),
+		},
+		{
+			name: "invalid operand",
+			q: NewSelector[SetUser](db).
+				Union(NewSelector[SetUser](db).Where(C("Invalid").EQ(1))),
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestSetQuery_sqlite(t *testing.T) {
+	db, err := Open("sqlite3", "file:set_query.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE set_user(id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE set_admin(id INTEGER PRIMARY KEY, name TEXT, role TEXT)",
+		"INSERT INTO set_user VALUES (1, 'Tom'), (2, 'Jerry'), (3, 'Jack')",
+		"INSERT INTO set_admin VALUES (3, 'Jack', 'owner'), (4, 'Rose', 'viewer')",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+	admins := func() *Selector[SetAdmin] {
+		return NewSelector[SetAdmin](db).Select(C("Id"), C("Name"))
+	}
+
+	testCases := []struct {
+		name    string
+		q       *SetQuery[SetUser]
+		wantRes []*SetUser
+	}{
+		{
+			name: "union",
+			q:    NewSelector[SetUser](db).Union(admins()).OrderBy(Asc("Id")),
+			wantRes: []*SetUser{
+				{Id: 1, Name: "Tom"}, {Id: 2, Name: "Jerry"}, {Id: 3, Name: "Jack"}, {Id: 4, Name: "Rose"},
+			},
+		},
+		{
+			name: "union all",
+			q:    NewSelector[SetUser](db).UnionAll(admins()).OrderBy(Desc("Id")).Limit(2),
+			wantRes: []*SetUser{
+				{Id: 4, Name: "Rose"}, {Id: 3, Name: "Jack"},
+			},
+		},
+		{
+			name:    "intersect",
+			q:       NewSelector[SetUser](db).Intersect(admins()),
+			wantRes: []*SetUser{{Id: 3, Name: "Jack"}},
+		},
+		{
+			name:    "except",
+			q:       NewSelector[SetUser](db).Except(admins()).OrderBy(Asc("Id")),
+			wantRes: []*SetUser{{Id: 1, Name: "Tom"}, {Id: 2, Name: "Jerry"}},
+		},
+		{
+			name: "operand with limit",
+			q: NewSelector[SetUser](db).OrderBy(Asc("Id")).Limit(1).
+				Union(admins().OrderBy(Desc("Id")).Limit(1)).OrderBy(Asc("Id")),
+			wantRes: []*SetUser{{Id: 1, Name: "Tom"}, {Id: 4, Name: "Rose"}},
+		},
+		{
+			name: "intersect after union",
+			q: NewSelector[SetUser](db).Where(C("Id").EQ(1)).
+				Union(admins()).
+				Intersect(NewSelector[SetUser](db)).OrderBy(Asc("Id")),
+			wantRes: []*SetUser{{Id: 1, Name: "Tom"}, {Id: 3, Name: "Jack"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.q.GetMulti(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+
+	u, err := NewSelector[SetUser](db).Except(admins()).OrderBy(Desc("Id")).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &SetUser{Id: 2, Name: "Jerry"}, u)
+}
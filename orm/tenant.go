@@ -0,0 +1,87 @@
+package orm
+
+import (
+	"context"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/model"
+	"reflect"
+)
+
+type tenantKey struct{}
+
+// WithTenant 把租户放进 context
+// 声明了 orm:"tenant" 的模型, 查询会自动加上 tenant_id = ?, 写入会自动填充租户字段
+func WithTenant(ctx context.Context, tenant any) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom 从 context 中取出租户
+func TenantFrom(ctx context.Context) (any, bool) {
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+// tenantScope 记录一次操作的租户信息
+type tenantScope struct {
+	// cross 显式声明跨租户, 这时候不会注入任何条件
+	cross bool
+	// tenant 从 context 中取出来的租户, ok 代表 context 中有没有租户
+	tenant any
+	ok     bool
+}
+
+func (t *tenantScope) from(ctx context.Context) {
+	t.tenant, t.ok = TenantFrom(ctx)
+}
+
+// inherit 子查询没有自己的 context, 沿用外层查询的租户
+// cross 是子查询自己声明的, 所以不覆盖
+func (t *tenantScope) inherit(parent tenantScope) {
+	t.tenant, t.ok = parent.tenant, parent.ok
+}
+
+// predicate 返回需要注入的条件, 不需要注入的时候返回 nil
+func (t tenantScope) predicate(m *model.Model) (*Predicate, error) {
+	if m.Tenant == nil || t.cross {
+		return nil, nil
+	}
+	if !t.ok {
+		return nil, errs.ErrNoTenant
+	}
+	p := C(m.Tenant.FieldName).EQ(t.tenant)
+	return &p, nil
+}
+
+// fill 把租户写入 val 的租户字段
+// 如果 val 已经设置了别的租户, 返回 ErrTenantMismatch
+func (t tenantScope) fill(m *model.Model, val any) error {
+	if m.Tenant == nil || t.cross {
+		return nil
+	}
+	if !t.ok {
+		return errs.ErrNoTenant
+	}
+	fd := reflect.ValueOf(val).Elem().FieldByName(m.Tenant.FieldName)
+	tenant := reflect.ValueOf(t.tenant)
+	if !tenant.Type().ConvertibleTo(fd.Type()) {
+		return errs.ErrTenantMismatch
+	}
+	tenant = tenant.Convert(fd.Type())
+	if fd.IsZero() {
+		fd.Set(tenant)
+		return nil
+	}
+	if fd.Interface() != tenant.Interface() {
+		return errs.ErrTenantMismatch
+	}
+	return nil
+}
+
+// withTenant 在 ps 的基础上加上租户条件, 不会修改 ps
+func (t tenantScope) withTenant(m *model.Model, ps []Predicate) ([]Predicate, error) {
+	p, err := t.predicate(m)
+	if err != nil || p == nil {
+		return ps, err
+	}
+	return append(append(make([]Predicate, 0, len(ps)+1), ps...), *p), nil
+}
@@ -0,0 +1,179 @@
+package orm
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type TenantOrder struct {
+	Id       int64
+	TenantId int64 `orm:"tenant"`
+	Amount   int
+	Items    []*TenantItem `orm:"has_many,foreign_key=OrderId"`
+}
+
+type TenantItem struct {
+	Id       int64
+	OrderId  int64
+	TenantId int64 `orm:"tenant"`
+}
+
+func TestSelector_Tenant_Build(t *testing.T) {
+	db, err := OpenDB(nil)
+	require.NoError(t, err)
+	ctx := WithTenant(context.Background(), 12)
+
+	testCases := []struct {
+		name      string
+		ctx       context.Context
+		s         *Selector[TenantOrder]
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "no where",
+			ctx:  ctx,
+			s:    NewSelector[TenantOrder](db),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `tenant_order` WHERE `tenant_id` = ?;",
+				Args: []any{12},
+			},
+		},
+		{
+			name: "where",
+			ctx:  ctx,
+			s:    NewSelector[TenantOrder](db).Where(C("Amount").GT(100)),
+			wantQuery: &Query{
+				SQL:  "SELECT * FROM `tenant_order` WHERE (`amount` > ?) AND (`tenant_id` = ?);",
+				Args: []any{100, 12},
+			},
+		},
+		{
+			name:    "no tenant",
+			ctx:     context.Background(),
+			s:       NewSelector[TenantOrder](db),
+			wantErr: ErrNoTenant,
+		},
+		{
+			name: "cross tenant",
+			ctx:  context.Background(),
+			s:    NewSelector[TenantOrder](db).CrossTenant(),
+			wantQuery: &Query{
+				SQL: "SELECT * FROM `tenant_order`;",
+			},
+		},
+		{
+			// CTE 里面的查询沿用外层的租户
+			name: "cte",
+			ctx:  ctx,
+			s: NewSelector[TenantOrder](db).
+				With("big", NewSelector[TenantOrder](db).Where(C("Amount").GT(100))).From("big"),
+			wantQuery: &Query{
+				SQL:  "WITH `big` AS (SELECT * FROM `tenant_order` WHERE (`amount` > ?) AND (`tenant_id` = ?)) SELECT * FROM big WHERE `tenant_id` = ?;",
+				Args: []any{100, 12, 12},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.s.from(tc.ctx)
+			query, err := tc.s.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}
+
+func TestTenant(t *testing.T) {
+	db, err := Open("sqlite3", "file:tenant.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE tenant_order(id INTEGER PRIMARY KEY, tenant_id INTEGER, amount INTEGER)",
+		"CREATE TABLE tenant_item(id INTEGER PRIMARY KEY, order_id INTEGER, tenant_id INTEGER)",
+		// 脏数据, 订单属于租户 1, 但是有一个商品属于租户 2
+		"INSERT INTO tenant_item VALUES (1, 1, 1), (2, 1, 2)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	tenant1 := WithTenant(context.Background(), int64(1))
+	tenant2 := WithTenant(context.Background(), 2)
+
+	// 写入的时候自动填充租户
+	order1 := &TenantOrder{Id: 1, Amount: 100}
+	_, err = NewInserter[TenantOrder](db).Values(order1).Exec(tenant1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), order1.TenantId)
+	_, err = NewInserter[TenantOrder](db).Values(&TenantOrder{Id: 2, Amount: 200}).Exec(tenant2)
+	require.NoError(t, err)
+
+	// 不能写入别的租户的数据
+	_, err = NewInserter[TenantOrder](db).Values(&TenantOrder{Id: 3, TenantId: 2}).Exec(tenant1)
+	assert.Equal(t, ErrTenantMismatch, err)
+	// 没有租户
+	_, err = NewInserter[TenantOrder](db).Values(&TenantOrder{Id: 3}).Exec(context.Background())
+	assert.Equal(t, ErrNoTenant, err)
+	// 跨租户写入, 以用户设置的为准
+	_, err = NewInserter[TenantOrder](db).Values(&TenantOrder{Id: 3, TenantId: 2, Amount: 300}).
+		CrossTenant().Exec(tenant1)
+	require.NoError(t, err)
+
+	// 查询只能看到自己租户的数据, 预加载也一样
+	res, err := NewSelector[TenantOrder](db).Preload("Items").GetMulti(tenant1)
+	require.NoError(t, err)
+	assert.Equal(t, []*TenantOrder{
+		{Id: 1, TenantId: 1, Amount: 100, Items: []*TenantItem{{Id: 1, OrderId: 1, TenantId: 1}}},
+	}, res)
+
+	res, err = NewSelector[TenantOrder](db).GetMulti(tenant2)
+	require.NoError(t, err)
+	assert.Equal(t, []*TenantOrder{
+		{Id: 2, TenantId: 2, Amount: 200},
+		{Id: 3, TenantId: 2, Amount: 300},
+	}, res)
+
+	_, err = NewSelector[TenantOrder](db).Get(context.Background())
+	assert.Equal(t, ErrNoTenant, err)
+
+	res, err = NewSelector[TenantOrder](db).CrossTenant().GetMulti(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, res, 3)
+}
+
+func TestInserter_Tenant_Columns(t *testing.T) {
+	db, err := Open("sqlite3", "file:tenant_columns.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	_, err = db.db.Exec("CREATE TABLE tenant_order(id INTEGER PRIMARY KEY, tenant_id INTEGER NOT NULL DEFAULT 0, amount INTEGER)")
+	require.NoError(t, err)
+	ctx := WithTenant(context.Background(), int64(1))
+
+	// 指定的字段里面没有租户字段, 也会写入租户
+	_, err = NewInserter[TenantOrder](db).Columns("Id", "Amount").
+		Values(&TenantOrder{Id: 1, Amount: 100}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = NewInserter[TenantOrder](db).Columns("Id", "TenantId", "Amount").
+		Values(&TenantOrder{Id: 2, Amount: 200}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = BatchInsert[TenantOrder](ctx, db, []*TenantOrder{{Id: 3, Amount: 300}},
+		BatchOptions{Columns: []string{"Id", "Amount"}})
+	require.NoError(t, err)
+	// 跨租户写入, 只插入指定的字段
+	_, err = NewInserter[TenantOrder](db).Columns("Id", "Amount").
+		Values(&TenantOrder{Id: 4, TenantId: 2, Amount: 400}).CrossTenant().Exec(ctx)
+	require.NoError(t, err)
+
+	res, err := NewSelector[TenantOrder](db).CrossTenant().OrderBy(Asc("Id")).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*TenantOrder{
+		{Id: 1, TenantId: 1, Amount: 100},
+		{Id: 2, TenantId: 1, Amount: 200},
+		{Id: 3, TenantId: 1, Amount: 300},
+		{Id: 4, Amount: 400},
+	}, res)
+}
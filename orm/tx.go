@@ -0,0 +1,66 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+)
+
+var _ Session = &Tx{}
+
+// Tx 事务
+type Tx struct {
+	tx *sql.Tx
+	db *DB
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx: tx, db: db}, nil
+}
+
+// DoTx 在事务中执行 fn
+// fn 返回 error 或者 panic 都会回滚, 否则提交
+func (db *DB) DoTx(ctx context.Context, fn func(ctx context.Context, tx *Tx) error, opts *sql.TxOptions) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	err = fn(ctx, tx)
+	panicked = false
+	return err
+}
+
+func (t *Tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *Tx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+func (t *Tx) getDB() *DB {
+	return t.db
+}
+
+func (t *Tx) conn() sqlConn {
+	return t.tx
+}
+
+func (t *Tx) queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return queryContext(ctx, t.db, t.tx, query, args...)
+}
+
+func (t *Tx) execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return execContext(ctx, t.db, t.tx, query, args...)
+}
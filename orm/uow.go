@@ -0,0 +1,574 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"geektime-go-study/orm/internal/errs"
+	"geektime-go-study/orm/model"
+	"reflect"
+)
+
+var _ Session = &UnitOfWork{}
+
+// UnitOfWork 工作单元
+// 通过它查询出来的实体会被跟踪, Commit 的时候在一个事务里面
+// 对新增的实体执行 INSERT, 对修改过的实体只 UPDATE 变化的列, 对移除的实体执行 DELETE
+//
+//	uow := NewSession(db)
+//	u, err := NewSelector[User](uow).Where(C("Id").EQ(1)).Get(ctx)
+//	u.Age = 19
+//	err = uow.Add(&Order{UserId: u.Id})
+//	err = uow.Commit(ctx)
+//
+// 同一个主键的实体只会有一份, 重复查询拿到的是同一个指针
+// 预加载的关联实体不会被跟踪
+// 只有 Commit 在事务里面执行, 通过工作单元执行的查询和别的写操作都直接在 DB 上执行
+// UnitOfWork 不是并发安全的
+type UnitOfWork struct {
+	db *DB
+	// identities 主键到实体的映射
+	identities map[identity]*entity
+	// tracked 保留跟踪的顺序, 保证生成的 SQL 的顺序是稳定的
+	tracked []*entity
+	added   []*entity
+	removed []*entity
+}
+
+type identity struct {
+	typ reflect.Type
+	id  any
+}
+
+type entity struct {
+	m   *model.Model
+	val any
+	// snapshot 查询出来或者上一次提交之后各个字段的值, 顺序和 m.Fields 一致
+	snapshot []any
+}
+
+// NewSession 创建一个工作单元
+func NewSession(db *DB) *UnitOfWork {
+	return &UnitOfWork{
+		db:         db,
+		identities: map[identity]*entity{},
+	}
+}
+
+func (u *UnitOfWork) getDB() *DB {
+	return u.db
+}
+
+func (u *UnitOfWork) conn() sqlConn {
+	return u.db.conn()
+}
+
+// queryContext 查询直接在 DB 上执行, 不在 Commit 的事务里面, 只有 Commit 的时候才开启事务
+func (u *UnitOfWork) queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return u.db.queryContext(ctx, query, args...)
+}
+
+// execContext 同样直接在 DB 上执行, 例如 NewInserter(uow) 会立刻写入, 不会等到 Commit, 失败的时候也不会跟着回滚
+// 需要和 Commit 一起提交的写操作请用 Add 和 Remove 登记
+func (u *UnitOfWork) execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return u.db.execContext(ctx, query, args...)
+}
+
+// Add 登记新的实体, Commit 的时候插入
+func (u *UnitOfWork) Add(vals ...any) error {
+	for _, val := range vals {
+		m, err := u.db.r.Get(val)
+		if err != nil {
+			return err
+		}
+		u.added = append(u.added, &entity{m: m, val: val})
+	}
+	return nil
+}
+
+// Remove 登记要删除的实体, Commit 的时候删除
+// 如果实体是 Add 进来的, 那么只是撤销 Add
+func (u *UnitOfWork) Remove(vals ...any) error {
+	for _, val := range vals {
+		if u.cancelAdd(val) {
+			continue
+		}
+		m, err := u.db.r.Get(val)
+		if err != nil {
+			return err
+		}
+		id, err := u.identityOf(m, val)
+		if err != nil {
+			return err
+		}
+		e, ok := u.identities[id]
+		if !ok {
+			e = &entity{m: m, val: val}
+		}
+		u.removed = append(u.removed, e)
+	}
+	return nil
+}
+
+func (u *UnitOfWork) cancelAdd(val any) bool {
+	for i, e := range u.added {
+		if e.val == val {
+			u.added = append(u.added[:i], u.added[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (u *UnitOfWork) identityOf(m *model.Model, val any) (identity, error) {
+	// 工作单元通过主键来识别实体
+	if m.PrimaryKey == nil {
+		return identity{}, errs.NewErrNoPrimaryKey(m.TableName)
+	}
+	v := reflect.ValueOf(val)
+	return identity{typ: v.Type(), id: v.Elem().FieldByName(m.PrimaryKey.FieldName).Interface()}, nil
+}
+
+// track 跟踪查询出来的实体, 如果已经跟踪了同一个主键的实体, 返回之前的那个
+func (u *UnitOfWork) track(m *model.Model, val any) (any, error) {
+	id, err := u.identityOf(m, val)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := u.identities[id]; ok {
+		return e.val, nil
+	}
+	snapshot, err := u.values(m, val)
+	if err != nil {
+		return nil, err
+	}
+	e := &entity{m: m, val: val, snapshot: snapshot}
+	u.identities[id] = e
+	u.tracked = append(u.tracked, e)
+	return val, nil
+}
+
+// tracked 如果 sess 是工作单元, 就跟踪 val
+func tracked[T any](sess Session, m *model.Model, val *T) (*T, error) {
+	u, ok := sess.(*UnitOfWork)
+	// 嵌套的结构体只用来查询 JOIN 的结果, 不跟踪
+	if !ok || len(m.Nested) > 0 {
+		return val, nil
+	}
+	res, err := u.track(m, val)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*T), nil
+}
+
+func (u *UnitOfWork) values(m *model.Model, val any) ([]any, error) {
+	names := make([]string, 0, len(m.Fields))
+	for _, fd := range m.Fields {
+		names = append(names, fd.FieldName)
+	}
+	return u.db.plainValuer(val, m).Values(names)
+}
+
+// change 一个实体需要更新的列
+type change struct {
+	e      *entity
+	fields []*model.Field
+	vals   []any
+	old    []any
+	// current 提交成功之后作为新的快照
+	current []any
+}
+
+// changes 对比快照, 找出修改过的实体和列
+func (u *UnitOfWork) changes() ([]change, error) {
+	removed := make(map[*entity]struct{}, len(u.removed))
+	for _, e := range u.removed {
+		removed[e] = struct{}{}
+	}
+	var res []change
+	for _, e := range u.tracked {
+		if _, ok := removed[e]; ok {
+			continue
+		}
+		c, err := u.diff(e)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.fields) > 0 {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// diff 对比一个实体的快照和当前的值
+func (u *UnitOfWork) diff(e *entity) (change, error) {
+	current, err := u.values(e.m, e.val)
+	if err != nil {
+		return change{}, err
+	}
+	c := change{e: e, current: current}
+	for i, fd := range e.m.Fields {
+		// 主键是实体的标识, 不允许修改
+		if fd == e.m.PrimaryKey || reflect.DeepEqual(e.snapshot[i], current[i]) {
+			continue
+		}
+		c.fields = append(c.fields, fd)
+		c.vals = append(c.vals, current[i])
+		c.old = append(c.old, e.snapshot[i])
+	}
+	return c, nil
+}
+
+// Commit 在一个事务里面执行 INSERT, UPDATE 和 DELETE
+// INSERT 按照依赖顺序, 被依赖的模型先插入, 例如先插入 User 再插入 Order
+// DELETE 的顺序反过来
+// 失败的时候事务回滚, 工作单元的状态不变, 可以修正之后重新提交
+func (u *UnitOfWork) Commit(ctx context.Context) error {
+	changes, err := u.changes()
+	if err != nil {
+		return err
+	}
+	if len(u.added) == 0 && len(changes) == 0 && len(u.removed) == 0 {
+		return nil
+	}
+	var ts tenantScope
+	ts.from(ctx)
+
+	order, err := u.dependencyOrder()
+	if err != nil {
+		return err
+	}
+	added := sortByModel(u.added, order, false)
+	removed := sortByModel(u.removed, order, true)
+	// 回滚的时候要把写回的自增主键清掉, 不然重新提交的时候会带上这个主键
+	var autoIncr []*entity
+	for _, e := range added {
+		if isAutoIncrement(e.m, e.val) {
+			autoIncr = append(autoIncr, e)
+		}
+	}
+
+	err = u.db.DoTx(ctx, func(ctx context.Context, tx *Tx) error {
+		for _, e := range added {
+			if err := u.insert(ctx, tx, ts, e); err != nil {
+				return err
+			}
+		}
+		for i := range changes {
+			if err := u.update(ctx, tx, ts, &changes[i]); err != nil {
+				return err
+			}
+		}
+		for _, e := range removed {
+			if err := u.delete(ctx, tx, ts, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		for _, e := range autoIncr {
+			setAutoIncrement(e, 0)
+		}
+		return err
+	}
+
+	// 提交成功, 新增的实体开始被跟踪, 删除的实体不再跟踪
+	for _, c := range changes {
+		c.e.snapshot = c.current
+	}
+	for _, e := range u.removed {
+		if id, err := u.identityOf(e.m, e.val); err == nil {
+			delete(u.identities, id)
+		}
+	}
+	u.untrack(u.removed)
+	for _, e := range added {
+		if _, err = u.track(e.m, e.val); err != nil {
+			return err
+		}
+	}
+	u.added, u.removed = nil, nil
+	return nil
+}
+
+func (u *UnitOfWork) untrack(es []*entity) {
+	if len(es) == 0 {
+		return
+	}
+	removed := make(map[*entity]struct{}, len(es))
+	for _, e := range es {
+		removed[e] = struct{}{}
+	}
+	tracked := u.tracked[:0]
+	for _, e := range u.tracked {
+		if _, ok := removed[e]; !ok {
+			tracked = append(tracked, e)
+		}
+	}
+	u.tracked = tracked
+}
+
+func (u *UnitOfWork) insert(ctx context.Context, tx *Tx, ts tenantScope, e *entity) error {
+	if err := ts.fill(e.m, e.val); err != nil {
+		return err
+	}
+	if err := beforeSave(ctx, e.val); err != nil {
+		return err
+	}
+	// 主键是零值的时候不插入主键, 让数据库生成自增主键
+	autoIncr := isAutoIncrement(e.m, e.val)
+	fields := make([]*model.Field, 0, len(e.m.Fields))
+	names := make([]string, 0, len(e.m.Fields))
+	for _, fd := range e.m.Fields {
+		if autoIncr && fd == e.m.PrimaryKey {
+			continue
+		}
+		fields = append(fields, fd)
+		names = append(names, fd.FieldName)
+	}
+	vals, err := u.db.newValuer(e.val, e.m).Values(names)
+	if err != nil {
+		return err
+	}
+	b := builder{m: e.m, dialect: u.db.dialect}
+	b.sb.WriteString("INSERT INTO ")
+	b.quote(e.m.TableName)
+	b.sb.WriteByte('(')
+	for i, fd := range fields {
+		if i > 0 {
+			b.sb.WriteByte(',')
+		}
+		b.quote(fd.ColName)
+	}
+	b.sb.WriteString(") VALUES (")
+	for i := range fields {
+		if i > 0 {
+			b.sb.WriteByte(',')
+		}
+		b.sb.WriteByte('?')
+	}
+	b.sb.WriteString(");")
+	res, err := execInsert(ctx, tx, e.m, &Query{SQL: b.sb.String(), Args: vals})
+	if err != nil {
+		return err
+	}
+	if autoIncr {
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		setAutoIncrement(e, id)
+	}
+	if u.db.auditEnabled(e.val) {
+		err = u.db.audit(ctx, tx, []AuditRecord{{
+			Table:      e.m.TableName,
+			PrimaryKey: auditPK(e.m, e.val),
+			Op:         AuditInsert,
+			New:        auditValues(fields, vals),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return afterSave(ctx, e.val)
+}
+
+// isAutoIncrement 主键是整数 (包括无符号整数) 并且是零值
+func isAutoIncrement(m *model.Model, val any) bool {
+	if m.PrimaryKey == nil {
+		return false
+	}
+	fd := reflect.ValueOf(val).Elem().FieldByName(m.PrimaryKey.FieldName)
+	return (fd.CanInt() || fd.CanUint()) && fd.IsZero()
+}
+
+// setAutoIncrement 把自增主键写回实体
+func setAutoIncrement(e *entity, id int64) {
+	fd := reflect.ValueOf(e.val).Elem().FieldByName(e.m.PrimaryKey.FieldName)
+	if fd.CanUint() {
+		fd.SetUint(uint64(id))
+		return
+	}
+	fd.SetInt(id)
+}
+
+// update 执行钩子之后重新对比快照, 钩子里面修改的字段也要更新
+func (u *UnitOfWork) update(ctx context.Context, tx *Tx, ts tenantScope, c *change) error {
+	if err := beforeSave(ctx, c.e.val); err != nil {
+		return err
+	}
+	var err error
+	if *c, err = u.diff(c.e); err != nil {
+		return err
+	}
+	if len(c.fields) == 0 {
+		return afterSave(ctx, c.e.val)
+	}
+	// 快照里面加密字段是明文, 写入的时候要加密
+	vals := c.vals
+	if hasEncrypted(c.e.m) {
+		names := make([]string, 0, len(c.fields))
+		for _, fd := range c.fields {
+			names = append(names, fd.FieldName)
+		}
+		if vals, err = u.db.newValuer(c.e.val, c.e.m).Values(names); err != nil {
+			return err
+		}
+	}
+	b := builder{m: c.e.m, dialect: u.db.dialect}
+	b.sb.WriteString("UPDATE ")
+	b.quote(c.e.m.TableName)
+	b.sb.WriteString(" SET ")
+	for i, fd := range c.fields {
+		if i > 0 {
+			b.sb.WriteByte(',')
+		}
+		b.quote(fd.ColName)
+		b.sb.WriteString(" = ?")
+		b.addArgs(vals[i])
+	}
+	if err = u.buildWherePK(&b, ts, c.e); err != nil {
+		return err
+	}
+	if _, err = tx.execContext(ctx, b.sb.String(), b.args...); err != nil {
+		return err
+	}
+	if u.db.auditEnabled(c.e.val) {
+		err = u.db.audit(ctx, tx, []AuditRecord{{
+			Table:      c.e.m.TableName,
+			PrimaryKey: auditPK(c.e.m, c.e.val),
+			Op:         AuditUpdate,
+			Old:        auditValues(c.fields, c.old),
+			New:        auditValues(c.fields, c.vals),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return afterSave(ctx, c.e.val)
+}
+
+func (u *UnitOfWork) delete(ctx context.Context, tx *Tx, ts tenantScope, e *entity) error {
+	b := builder{m: e.m, dialect: u.db.dialect}
+	b.sb.WriteString("DELETE FROM ")
+	b.quote(e.m.TableName)
+	if err := u.buildWherePK(&b, ts, e); err != nil {
+		return err
+	}
+	if _, err := tx.execContext(ctx, b.sb.String(), b.args...); err != nil {
+		return err
+	}
+	if !u.db.auditEnabled(e.val) {
+		return nil
+	}
+	record := AuditRecord{
+		Table:      e.m.TableName,
+		PrimaryKey: auditPK(e.m, e.val),
+		Op:         AuditDelete,
+	}
+	// 没有被跟踪的实体没有快照, 拿不到旧值
+	if e.snapshot != nil {
+		record.Old = auditValues(e.m.Fields, e.snapshot)
+	}
+	return u.db.audit(ctx, tx, []AuditRecord{record})
+}
+
+// buildWherePK 按照主键更新和删除, 同样会注入租户条件
+func (u *UnitOfWork) buildWherePK(b *builder, ts tenantScope, e *entity) error {
+	id, err := u.identityOf(e.m, e.val)
+	if err != nil {
+		return err
+	}
+	where, err := ts.withTenant(e.m, []Predicate{C(e.m.PrimaryKey.FieldName).EQ(id.id)})
+	if err != nil {
+		return err
+	}
+	b.sb.WriteString(" WHERE ")
+	if err = b.buildPredicates(where); err != nil {
+		return err
+	}
+	b.sb.WriteByte(';')
+	return nil
+}
+
+// dependencyOrder 根据关联关系对涉及到的模型做拓扑排序, 返回每个模型的序号
+// HasOne 和 HasMany 是本模型在前, BelongsTo 是关联模型在前
+// 有环的时候, 环上的模型按照登记的顺序
+func (u *UnitOfWork) dependencyOrder() (map[*model.Model]int, error) {
+	var models []*model.Model
+	seen := map[*model.Model]struct{}{}
+	for _, es := range [][]*entity{u.added, u.removed} {
+		for _, e := range es {
+			if _, ok := seen[e.m]; !ok {
+				seen[e.m] = struct{}{}
+				models = append(models, e.m)
+			}
+		}
+	}
+
+	// edges[a] 是必须在 a 之后插入的模型
+	edges := map[*model.Model][]*model.Model{}
+	inDegree := map[*model.Model]int{}
+	for _, m := range models {
+		for _, rel := range m.Relations {
+			other, err := u.db.r.Get(reflect.New(rel.ElemType).Interface())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := seen[other]; !ok || other == m {
+				continue
+			}
+			from, to := m, other
+			if rel.Kind == model.BelongsTo {
+				from, to = other, m
+			}
+			edges[from] = append(edges[from], to)
+			inDegree[to]++
+		}
+	}
+
+	order := make(map[*model.Model]int, len(models))
+	for len(order) < len(models) {
+		next := -1
+		for i, m := range models {
+			if _, ok := order[m]; !ok && inDegree[m] == 0 {
+				next = i
+				break
+			}
+		}
+		// 有环, 取第一个还没有排好的
+		if next < 0 {
+			for i, m := range models {
+				if _, ok := order[m]; !ok {
+					next = i
+					break
+				}
+			}
+		}
+		m := models[next]
+		order[m] = len(order)
+		for _, to := range edges[m] {
+			inDegree[to]--
+		}
+	}
+	return order, nil
+}
+
+// sortByModel 按照模型的顺序稳定排序, reverse 为 true 的时候倒序
+func sortByModel(es []*entity, order map[*model.Model]int, reverse bool) []*entity {
+	res := make([]*entity, 0, len(es))
+	for i := 0; i < len(order); i++ {
+		rank := i
+		if reverse {
+			rank = len(order) - 1 - i
+		}
+		for _, e := range es {
+			if order[e.m] == rank {
+				res = append(res, e)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,221 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type UowUser struct {
+	Id     int64
+	Name   string
+	Age    int
+	Orders []*UowOrder `orm:"has_many,foreign_key=UserId"`
+}
+
+type UowOrder struct {
+	Id     int64
+	UserId int64
+	Amount int
+}
+
+type UowItem struct {
+	Id      int64
+	OrderId int64
+	Order   *UowOrder `orm:"belongs_to,foreign_key=OrderId"`
+}
+
+func TestUnitOfWork_Commit(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		_ = mockDB.Close()
+	}()
+	db, err := OpenDB(mockDB, DBWithDialect(DialectMySQL))
+	require.NoError(t, err)
+	ctx := context.Background()
+	uow := NewSession(db)
+
+	mock.ExpectQuery("SELECT \\* FROM `uow_user` WHERE `id` = \\?;").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "age"}).AddRow(1, "Tom", 18))
+	mock.ExpectQuery("SELECT \\* FROM `uow_user`;").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "age"}).
+			AddRow(1, "Tom", 18).AddRow(2, "Jerry", 20))
+	mock.ExpectQuery("SELECT \\* FROM `uow_order` WHERE `id` = \\?;").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "amount"}).AddRow(3, 2, 100))
+
+	u, err := NewSelector[UowUser](uow).Where(C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+	us, err := NewSelector[UowUser](uow).GetMulti(ctx)
+	require.NoError(t, err)
+	// 同一个主键拿到的是同一个实体
+	assert.Same(t, u, us[0])
+	o, err := NewSelector[UowOrder](uow).Where(C("Id").EQ(3)).Get(ctx)
+	require.NoError(t, err)
+
+	u.Age = 19
+	// 改回原来的值, 不需要更新
+	us[1].Name = "Jack"
+	us[1].Name = "Jerry"
+	// 被依赖的模型先插入, 所以 item 在 order 之后
+	require.NoError(t, uow.Add(&UowItem{Id: 10, OrderId: 11}, &UowOrder{Id: 11, UserId: 1, Amount: 5}))
+	require.NoError(t, uow.Remove(o))
+	// 撤销新增
+	canceled := &UowOrder{Id: 12}
+	require.NoError(t, uow.Add(canceled))
+	require.NoError(t, uow.Remove(canceled))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `uow_order`\\(`id`,`user_id`,`amount`\\) VALUES \\(\\?,\\?,\\?\\);").
+		WithArgs(int64(11), int64(1), 5).WillReturnResult(sqlmock.NewResult(11, 1))
+	mock.ExpectExec("INSERT INTO `uow_item`\\(`id`,`order_id`\\) VALUES \\(\\?,\\?\\);").
+		WithArgs(int64(10), int64(11)).WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec("UPDATE `uow_user` SET `age` = \\? WHERE `id` = \\?;").
+		WithArgs(19, int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM `uow_order` WHERE `id` = \\?;").
+		WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	require.NoError(t, uow.Commit(ctx))
+
+	// 提交之后快照更新, 没有修改就不会再执行 SQL
+	require.NoError(t, uow.Commit(ctx))
+
+	// 失败的时候回滚, 修改仍然保留, 可以再次提交
+	u.Name = "Tommy"
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `uow_user` SET `name` = \\? WHERE `id` = \\?;").
+		WithArgs("Tommy", int64(1)).WillReturnError(errors.New("mock error"))
+	mock.ExpectRollback()
+	assert.Equal(t, errors.New("mock error"), uow.Commit(ctx))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `uow_user` SET `name` = \\? WHERE `id` = \\?;").
+		WithArgs("Tommy", int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	require.NoError(t, uow.Commit(ctx))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnitOfWork_sqlite(t *testing.T) {
+	db, err := Open("sqlite3", "file:uow.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE uow_user(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, age INTEGER)",
+		"CREATE TABLE uow_order(id INTEGER PRIMARY KEY, user_id INTEGER, amount INTEGER)",
+		"INSERT INTO uow_order VALUES (1, 1, 10), (2, 1, 20)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+	uow := NewSession(db)
+
+	// 自增主键写回实体, 之后可以更新
+	u := &UowUser{Name: "Tom", Age: 18}
+	require.NoError(t, uow.Add(u))
+	require.NoError(t, uow.Commit(ctx))
+	assert.Equal(t, int64(1), u.Id)
+	u.Age = 20
+
+	orders, err := NewSelector[UowOrder](uow).OrderBy(Asc("Id")).GetMulti(ctx)
+	require.NoError(t, err)
+	orders[0].Amount = 15
+	require.NoError(t, uow.Remove(orders[1]))
+	require.NoError(t, uow.Commit(ctx))
+
+	got, err := NewSelector[UowUser](db).Where(C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &UowUser{Id: 1, Name: "Tom", Age: 20}, got)
+	gotOrders, err := NewSelector[UowOrder](db).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*UowOrder{{Id: 1, UserId: 1, Amount: 15}}, gotOrders)
+}
+
+// UowLegacy 主键不是 Id, 通过 orm:"primary_key" 声明
+type UowLegacy struct {
+	Code string `orm:"primary_key"`
+	Name string
+}
+
+func TestUnitOfWork_primaryKey(t *testing.T) {
+	db, err := Open("sqlite3", "file:uow_pk.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	_, err = db.db.Exec("CREATE TABLE uow_legacy(code TEXT PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	ctx := context.Background()
+	uow := NewSession(db)
+
+	require.NoError(t, uow.Add(&UowLegacy{Code: "a", Name: "Tom"}, &UowLegacy{Code: "b", Name: "Jerry"}))
+	require.NoError(t, uow.Commit(ctx))
+	b, err := NewSelector[UowLegacy](uow).Where(C("Code").EQ("b")).Get(ctx)
+	require.NoError(t, err)
+	b.Name = "Jack"
+	require.NoError(t, uow.Commit(ctx))
+
+	got, err := NewSelector[UowLegacy](db).OrderBy(Asc("Code")).GetMulti(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*UowLegacy{{Code: "a", Name: "Tom"}, {Code: "b", Name: "Jack"}}, got)
+}
+
+// UowUnsigned ormreverse 把无符号的主键生成为 uint64
+type UowUnsigned struct {
+	Id   uint64
+	Name string
+}
+
+func TestUnitOfWork_unsignedAutoIncrement(t *testing.T) {
+	db, err := Open("sqlite3", "file:uow_unsigned.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	_, err = db.db.Exec("CREATE TABLE uow_unsigned(id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)")
+	require.NoError(t, err)
+	ctx := context.Background()
+	uow := NewSession(db)
+
+	u := &UowUnsigned{Name: "Tom"}
+	require.NoError(t, uow.Add(u))
+	require.NoError(t, uow.Commit(ctx))
+	assert.Equal(t, uint64(1), u.Id)
+}
+
+// UowPost 每次保存都会在钩子里面增加版本号
+type UowPost struct {
+	Id      int64
+	Title   string
+	Version int
+}
+
+func (p *UowPost) BeforeSave(ctx context.Context) error {
+	p.Version++
+	return nil
+}
+
+func TestUnitOfWork_beforeSave(t *testing.T) {
+	db, err := Open("sqlite3", "file:uow_hook.db?cache=shared&mode=memory")
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		"CREATE TABLE uow_post(id INTEGER PRIMARY KEY, title TEXT, version INTEGER)",
+		"INSERT INTO uow_post VALUES (1, 'hello', 1)",
+	} {
+		_, err = db.db.Exec(stmt)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+	uow := NewSession(db)
+
+	p, err := NewSelector[UowPost](uow).Where(C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+	p.Title = "world"
+	require.NoError(t, uow.Commit(ctx))
+
+	// 钩子修改的字段同样写入数据库, 并且进入快照
+	got, err := NewSelector[UowPost](db).Where(C("Id").EQ(1)).Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &UowPost{Id: 1, Title: "world", Version: 2}, got)
+	require.NoError(t, uow.Commit(ctx))
+	assert.Equal(t, 2, p.Version)
+}
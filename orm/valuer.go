@@ -0,0 +1,40 @@
+package orm
+
+import (
+	"geektime-go-study/orm/internal/valuer"
+	"geektime-go-study/orm/model"
+	"reflect"
+)
+
+// Valuer 暴露给 ormgen 生成的代码使用
+// 生成的代码不依赖反射和 unsafe, 直接读写结构体字段
+type Valuer = valuer.Valuer
+
+// RegisterValuer 注册 ormgen 生成的 Valuer, 一般在生成代码的 init 里面调用
+// 注册之后 DB 会优先使用它, 而不是默认的 unsafe 实现; 使用了 DBWithReflectValuer 的 DB 不使用它
+// meta 是 DB 的注册中心解析出来的元数据, 列名要从这里找
+func RegisterValuer[T any](fn func(val *T, meta *model.Model) Valuer) {
+	valuer.Register(reflect.TypeOf((*T)(nil)), func(val any, meta *model.Model, _ valuer.Cipher) valuer.Valuer {
+		return fn(val.(*T), meta)
+	})
+}
+
+// newValuer 创建 val 的 Valuer, 优先使用生成的实现
+// 生成的代码不知道怎么加解密和处理嵌套的结构体, 所以这两种模型不使用生成的实现
+func (db *DB) newValuer(val any, meta *model.Model) valuer.Valuer {
+	if db.generatedValuer && !hasEncrypted(meta) && len(meta.Nested) == 0 {
+		if c, ok := valuer.Generated(reflect.TypeOf(val)); ok {
+			return c(val, meta, nil)
+		}
+	}
+	return db.valCreator(val, meta, db.cipher)
+}
+
+// plainValuer 读出来的加密字段是明文, 用于 UnitOfWork 的快照
+// 随机加密的字段每次加密的结果都不一样, 对比密文没办法知道字段有没有修改
+func (db *DB) plainValuer(val any, meta *model.Model) valuer.Valuer {
+	if !hasEncrypted(meta) {
+		return db.newValuer(val, meta)
+	}
+	return db.valCreator(val, meta, plainCipher{})
+}
@@ -0,0 +1,50 @@
+package orm
+
+import (
+	"geektime-go-study/orm/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type GenUser struct {
+	Id   int64
+	Name string
+}
+
+// genUserValuer 模拟 ormgen 生成的 Valuer, 只用来判断用的是哪个实现
+type genUserValuer struct {
+	Valuer
+}
+
+func TestDB_newValuer(t *testing.T) {
+	RegisterValuer(func(val *GenUser, meta *model.Model) Valuer {
+		return genUserValuer{}
+	})
+	testCases := []struct {
+		name          string
+		opts          []DBOption
+		wantGenerated bool
+	}{
+		{
+			name:          "generated",
+			wantGenerated: true,
+		},
+		{
+			// 用户明确要求使用反射, 就不能再用生成的实现
+			name: "reflect",
+			opts: []DBOption{DBWithReflectValuer()},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := OpenDB(nil, tc.opts...)
+			require.NoError(t, err)
+			val := &GenUser{}
+			meta, err := db.r.Get(val)
+			require.NoError(t, err)
+			_, ok := db.newValuer(val, meta).(genUserValuer)
+			assert.Equal(t, tc.wantGenerated, ok)
+		})
+	}
+}
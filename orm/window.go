@@ -0,0 +1,96 @@
+package orm
+
+// Window 窗口函数, 例如
+//
+//	RowNumber().Over(PartitionBy("UserId"), Desc("CreateTime")).As("rn")
+//
+// 生成 ROW_NUMBER() OVER (PARTITION BY `user_id` ORDER BY `create_time` DESC) AS `rn`
+// 窗口函数的结果要写回 T, 所以别名必须是 T 的某个列名
+type Window struct {
+	fn          string
+	partitionBy []string
+	orderBy     []OrderBy
+	alias       string
+}
+
+func (Window) selectable() {}
+
+func RowNumber() Window {
+	return Window{fn: "ROW_NUMBER"}
+}
+
+func Rank() Window {
+	return Window{fn: "RANK"}
+}
+
+func DenseRank() Window {
+	return Window{fn: "DENSE_RANK"}
+}
+
+// WindowSpec 可以作为 Over 的参数, 有 PartitionBy 和 OrderBy
+type WindowSpec interface {
+	windowSpec()
+}
+
+type partitionBy struct {
+	fields []string
+}
+
+func (partitionBy) windowSpec() {}
+
+// PartitionBy 传入的是字段名
+func PartitionBy(fields ...string) WindowSpec {
+	return partitionBy{fields: fields}
+}
+
+func (OrderBy) windowSpec() {}
+
+// Over 指定窗口, 例如 Over(PartitionBy("UserId"), Desc("CreateTime"), Asc("Id"))
+func (w Window) Over(specs ...WindowSpec) Window {
+	for _, spec := range specs {
+		switch sp := spec.(type) {
+		case partitionBy:
+			w.partitionBy = append(w.partitionBy, sp.fields...)
+		case OrderBy:
+			w.orderBy = append(w.orderBy, sp)
+		}
+	}
+	return w
+}
+
+// As 指定别名
+func (w Window) As(alias string) Window {
+	w.alias = alias
+	return w
+}
+
+func (b *builder) buildWindow(w Window) error {
+	b.sb.WriteString(w.fn)
+	b.sb.WriteString("() OVER (")
+	if len(w.partitionBy) > 0 {
+		b.sb.WriteString("PARTITION BY ")
+		for i, fd := range w.partitionBy {
+			if i > 0 {
+				b.sb.WriteByte(',')
+			}
+			if err := b.buildColumn(C(fd)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(w.orderBy) > 0 {
+		if len(w.partitionBy) > 0 {
+			b.sb.WriteByte(' ')
+		}
+		b.sb.WriteString("ORDER BY ")
+		if err := b.buildOrderBy(w.orderBy); err != nil {
+			return err
+		}
+	}
+	b.sb.WriteByte(')')
+	if w.alias != "" {
+		b.sb.WriteString(" AS ")
+		b.quote(w.alias)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package orm
+
+import (
+	"geektime-go-study/orm/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type WindowOrder struct {
+	Id     int64
+	UserId int64
+	Amount int
+	Rn     int
+}
+
+func TestSelector_Window(t *testing.T) {
+	db := memoryDB(t)
+	testCases := []struct {
+		name      string
+		q         QueryBuilder
+		wantQuery *Query
+		wantErr   error
+	}{
+		{
+			name: "row number",
+			q: NewSelector[WindowOrder](db).Select(C("Id"),
+				RowNumber().Over(PartitionBy("UserId"), Desc("Amount")).As("rn")),
+			wantQuery: &Query{
+				SQL: "SELECT `id`,ROW_NUMBER() OVER (PARTITION BY `user_id` ORDER BY `amount` DESC) AS `rn` FROM `window_order`;",
+			},
+		},
+		{
+			name: "rank order by only",
+			q:    NewSelector[WindowOrder](db).Select(C("Id"), Rank().Over(Desc("Amount"), Asc("Id")).As("rn")),
+			wantQuery: &Query{
+				SQL: "SELECT `id`,RANK() OVER (ORDER BY `amount` DESC,`id` ASC) AS `rn` FROM `window_order`;",
+			},
+		},
+		{
+			name: "dense rank empty window",
+			q:    NewSelector[WindowOrder](db).Select(DenseRank().Over()),
+			wantQuery: &Query{
+				SQL: "SELECT DENSE_RANK() OVER () FROM `window_order`;",
+			},
+		},
+		{
+			name:    "unknown field",
+			q:       NewSelector[WindowOrder](db).Select(RowNumber().Over(PartitionBy("Invalid"))),
+			wantErr: errs.NewErrUnknownField("Invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.q.Build()
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantQuery, query)
+		})
+	}
+}